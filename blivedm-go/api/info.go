@@ -66,7 +66,7 @@ type DanmuInfo struct {
 func GetUid(cookie string) (int, string, error) {
 	headers := &http.Header{}
 	headers.Set("cookie", cookie)
-	resp, err := HttpGet("https://api.bilibili.com/x/web-interface/nav", headers)
+	resp, err := HttpGet(apiURL(mainAPI, "/x/web-interface/nav"), headers)
 	if err != nil {
 		return 0, "", err
 	}
@@ -164,7 +164,7 @@ type BuvidData struct {
 
 func GetBuvid3A4() (buvid3, buvid4 string, err error) {
 	headers := &http.Header{}
-	roomIDurl := "https://api.bilibili.com/x/frontend/finger/spi"
+	roomIDurl := apiURL(mainAPI, "/x/frontend/finger/spi")
 	result := &BuvidData{}
 	err = GetJsonWithHeader(roomIDurl, headers, result)
 	if err != nil {
@@ -184,7 +184,7 @@ func GetDanmuInfo(roomID int, cookie string, wbiMixinKey string) (*DanmuInfo, er
 	//headers.Set("accept-language", "zh-CN,zh;q=0.9,en-US;q=0.8,en;q=0.7")
 	params := fmt.Sprintf("id=%d&type=0", roomID)
 	params = toWbiParamSafe(params, wbiMixinKey)
-	roomIDurl := fmt.Sprintf("https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?%s", params)
+	roomIDurl := apiURL(liveAPI, "/xlive/web-room/v1/index/getDanmuInfo?"+params)
 	err := GetJsonWithHeader(roomIDurl, headers, result)
 	if err != nil {
 		return nil, err
@@ -200,7 +200,7 @@ func GetDanmuInfo(roomID int, cookie string, wbiMixinKey string) (*DanmuInfo, er
 
 func GetRoomInfo(roomID int) (*RoomInfo, error) {
 	result := &RoomInfo{}
-	err := GetJson(fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/room_init?id=%d", roomID), result)
+	err := GetJson(apiURL(liveAPI, fmt.Sprintf("/room/v1/Room/room_init?id=%d", roomID)), result)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +38,6 @@ type BiliVerify struct {
 
 // SendDanmaku https://api.live.bilibili.com/msg/send
 func SendDanmaku(d *DanmakuRequest, v *BiliVerify) (*SendDanmakuResp, error) {
-	client := &http.Client{}
 	result := &SendDanmakuResp{}
 	form := url.Values{
 		"bubble":     {d.Bubble},
@@ -55,13 +54,16 @@ func SendDanmaku(d *DanmakuRequest, v *BiliVerify) (*SendDanmakuResp, error) {
 	if d.DmType != "" {
 		form.Add("dm_type", d.DmType)
 	}
-	req, err := http.NewRequest("POST", "https://api.live.bilibili.com/msg/send", strings.NewReader(form.Encode()))
+	req, err := http.NewRequest("POST", apiURL(liveAPI, "/msg/send"), strings.NewReader(form.Encode()))
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Cookie", fmt.Sprintf("bili_jct=%s;SESSDATA=%s", v.Csrf, v.SessData))
-	resp, err := client.Do(req)
+	resp, err := Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	defer resp.Body.Close()
 
 	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
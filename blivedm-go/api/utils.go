@@ -4,13 +4,42 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// 官方接口地址
+const (
+	liveAPI = "https://api.live.bilibili.com"
+	mainAPI = "https://api.bilibili.com"
+)
+
+// Client 所有接口共用的 http 客户端
+var Client = &http.Client{Timeout: 10 * time.Second}
+
+var baseURL atomic.Value
+
+// SetBaseURL 所有接口改为请求 base，用于本地测试或代理，为空时恢复官方接口
+func SetBaseURL(base string) {
+	baseURL.Store(strings.TrimRight(base, "/"))
+}
+
+// apiURL 拼接接口地址，host 为官方接口地址，path 以 / 开头
+func apiURL(host, path string) string {
+	if base, _ := baseURL.Load().(string); base != "" {
+		return base + path
+	}
+	return host + path
+}
+
 func HttpGet(url string, headers *http.Header) ([]byte, error) {
 	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
 	req.Header = *headers
-	c := &http.Client{}
-	resp, err := c.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -25,7 +54,7 @@ func HttpGet(url string, headers *http.Header) ([]byte, error) {
 }
 
 func GetJson(url string, result interface{}) error {
-	resp, err := http.Get(url)
+	resp, err := Client.Get(url)
 	if err != nil {
 		return err
 	}
@@ -40,11 +69,13 @@ func GetJson(url string, result interface{}) error {
 
 func GetJsonWithHeader(url string, headers *http.Header, result interface{}) error {
 	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
 	//fmt.Println(headers)
 	headers.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0")
 	req.Header = *headers
-	c := &http.Client{}
-	resp, err := c.Do(req)
+	resp, err := Client.Do(req)
 	if err != nil {
 		return err
 	}
@@ -5,10 +5,10 @@ import (
 	"errors"
 	"fmt"
 	log "github.com/zeromicro/go-zero/core/logx"
-	"net/http"
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -17,34 +17,49 @@ import (
 )
 
 type Client struct {
-	conn                *websocket.Conn
-	RoomID              int
-	Uid                 int
-	Buvid               string
-	Cookie              string
-	WbiMixinKey         string
-	token               string
-	host                string
-	hostList            []string
-	retryCount          int
-	eventHandlers       *eventHandlers
-	customEventHandlers *customEventHandlers
-	cancel              context.CancelFunc
-	done                <-chan struct{}
-	lock                sync.RWMutex
+	conn        *websocket.Conn
+	enc         *packet.Encoder // 当前连接的编码器，每个连接的序号单独计数
+	RoomID      int
+	Uid         int
+	Buvid       string
+	Cookie      string
+	WbiMixinKey string
+	token       string
+	host        string
+	hostList    []string
+	pinnedHosts []string // 通过 SetHost 或 UseDefaultHost 指定的服务器，不随 DanmuInfo 更新
+	retryCount  int
+	protover    uint16 // 希望服务器下发消息使用的协议版本
+	sendVersion uint16 // 发送给服务器的包使用的协议版本
+	bus         *EventBus
+	pool        atomic.Pointer[WorkerPool]
+	workers     int // 工作池的协程数和队列长度，为 0 时使用默认值
+	queueSize   int
+	popularity  atomic.Int64
+	lastReply   atomic.Int64 // 最近一次收到服务器数据的时间，UnixNano
+	lastMessage atomic.Int64 // 最近一次收到业务消息的时间，UnixNano
+	lastBeat    atomic.Int64 // 最近一次收到心跳回复的时间，UnixNano
+	recorder    atomic.Pointer[Recorder]
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        <-chan struct{}
+	loops       sync.WaitGroup // 读取和心跳的 goroutine
+	lock        sync.RWMutex
 }
 
 // NewClient 创建一个新的弹幕 client
 func NewClient(roomID int) *Client {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Client{
-		RoomID:              roomID,
-		retryCount:          0,
-		eventHandlers:       &eventHandlers{},
-		customEventHandlers: &customEventHandlers{},
-		done:                ctx.Done(),
-		cancel:              cancel,
-		lock:                sync.RWMutex{},
+		RoomID:      roomID,
+		retryCount:  0,
+		protover:    packet.Brotli,
+		sendVersion: packet.Popularity,
+		bus:         NewEventBus(),
+		ctx:         ctx,
+		done:        ctx.Done(),
+		cancel:      cancel,
+		lock:        sync.RWMutex{},
 	}
 }
 
@@ -80,82 +95,73 @@ func (c *Client) init() error {
 	roomInfo, err := api.GetRoomInfo(c.RoomID)
 	// 失败降级
 	if err != nil || roomInfo.Code != 0 {
-		return errors.New(fmt.Sprintf("room=%s init GetRoomInfo fialed, %s", c.RoomID, err))
+		return errors.New(fmt.Sprintf("room=%d init GetRoomInfo fialed, %v", c.RoomID, err))
 	}
 	c.RoomID = roomInfo.Data.RoomId
-	if c.host == "" {
-		info, err := api.GetDanmuInfo(c.RoomID, c.Cookie, c.WbiMixinKey)
-		if err != nil || info == nil || info.Data.HostList == nil {
-			log.Errorf("get DanmuInfo error: %v", err)
-			c.hostList = []string{"broadcastlv.chat.bilibili.com"}
-		} else {
-			for _, h := range info.Data.HostList {
-				c.hostList = append(c.hostList, h.Host)
-			}
-		}
-		c.token = info.Data.Token
-	}
-	return nil
-}
-
-func (c *Client) connect() error {
-	reqHeader := &http.Header{}
-	reqHeader.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.0.0 Safari/537.36")
-retry:
-	c.host = c.hostList[c.retryCount%len(c.hostList)]
-	c.retryCount++
-	conn, res, err := websocket.DefaultDialer.Dial(fmt.Sprintf("wss://%s/sub", c.host), *reqHeader)
-	if err != nil {
-		log.Errorf("connect dial failed, retry %d times", c.retryCount)
-		time.Sleep(2 * time.Second)
-		goto retry
+	if err = c.refreshDanmuInfo(); err != nil {
+		log.Errorf("get DanmuInfo error: %v", err)
 	}
-	c.conn = conn
-	_ = res.Body.Close()
-	if err = c.sendEnterPacket(); err != nil {
-		log.Errorf("failed to send enter packet, retry %d times", c.retryCount)
-		time.Sleep(2 * time.Second)
-		goto retry
+	if len(c.hostList) == 0 {
+		c.hostList = []string{defaultHost}
 	}
 	return nil
 }
 
-func (c *Client) wsLoop() {
+// wsLoop 读取弹幕消息，连接断开后重连，直到 client 停止
+func (c *Client) wsLoop(conn *websocket.Conn) {
 	for {
+		err := c.readLoop(conn)
 		select {
 		case <-c.done:
 			return
 		default:
-			msgType, data, err := c.conn.ReadMessage()
-			if err != nil {
-				log.Error("ws message read failed, reconnecting")
-				time.Sleep(time.Duration(3) * time.Millisecond)
-				_ = c.connect()
-				continue
-			}
-			if msgType != websocket.BinaryMessage {
-				log.Error("packet not binary")
-				continue
-			}
-			for _, pkt := range packet.DecodePacket(data).Parse() {
-				go c.Handle(pkt)
-			}
+		}
+		_ = conn.Close()
+		log.Errorf("room=%d ws disconnected: %v", c.RoomID, err)
+		c.publishConn(EventDisconnected, &ConnectionEvent{Host: c.host, Err: err})
+		if conn = c.reconnect(); conn == nil {
+			return
+		}
+	}
+}
+
+// readLoop 读取消息直到出错，超过 readTimeout 没有收到任何数据（包括心跳回复）视为断开
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.lastReply.Store(time.Now().UnixNano())
+		if msgType != websocket.BinaryMessage {
+			log.Error("packet not binary")
+			continue
+		}
+		packets, err := packet.DecodeAll(data)
+		if err != nil {
+			// 出错前解析出的包照常处理
+			log.Errorf("room=%d decode packet failed: %v", c.RoomID, err)
+		}
+		for _, pkt := range packets {
+			c.dispatch(pkt)
 		}
 	}
 }
 
 func (c *Client) heartBeatLoop() {
-	pkt := packet.NewHeartBeatPacket()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-c.done:
 			return
-		case <-time.After(30 * time.Second):
-			c.lock.Lock()
-			if err := c.conn.WriteMessage(websocket.BinaryMessage, pkt); err != nil {
-				log.Error(err)
+		case <-ticker.C:
+			// 写入失败时连接已被关闭，读循环会随之重连
+			if err := c.write(packet.HeartBeat, nil); err != nil {
+				log.Errorf("room=%d send HeartBeat failed: %v", c.RoomID, err)
+				continue
 			}
-			c.lock.Unlock()
 			log.Debug("send: HeartBeat")
 		}
 	}
@@ -166,33 +172,108 @@ func (c *Client) Start() error {
 	if err := c.init(); err != nil {
 		return err
 	}
-	if err := c.connect(); err != nil {
-		return err
+	conn, err := c.connectOnce()
+	if err != nil {
+		return fmt.Errorf("room=%d connect failed: %w", c.RoomID, err)
 	}
-	go c.wsLoop()
-	go c.heartBeatLoop()
+	c.publishConn(EventConnected, &ConnectionEvent{Host: c.host})
+	c.loops.Add(2)
+	go func() {
+		defer c.loops.Done()
+		c.wsLoop(conn)
+	}()
+	go func() {
+		defer c.loops.Done()
+		c.heartBeatLoop()
+	}()
 	return nil
 }
 
-// Stop 停止弹幕 Client
+// Stop 停止弹幕 Client，不再重连
 func (c *Client) Stop() {
 	c.cancel()
+	c.closeConn()
+	if p := c.pool.Load(); p != nil {
+		p.Close()
+	}
+}
+
+// Wait 等待 Stop 之后读取和心跳的 goroutine 退出、工作池中正在执行的事件处理结束，ctx 取消时返回 ctx.Err()
+func (c *Client) Wait(ctx context.Context) error {
+	exited := make(chan struct{})
+	go func() {
+		c.loops.Wait()
+		if p := c.pool.Load(); p != nil {
+			p.Wait()
+		}
+		close(exited)
+	}()
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
+// SetWorkers 设置处理事件的工作池，同一用户的事件由同一协程按顺序处理，在 Start 前调用
+func (c *Client) SetWorkers(workers, queueSize int) {
+	c.workers, c.queueSize = workers, queueSize
+}
+
+// workerPool 返回工作池，首次调用时创建
+func (c *Client) workerPool() *WorkerPool {
+	if p := c.pool.Load(); p != nil {
+		return p
+	}
+	p := NewWorkerPool(c.workers, c.queueSize)
+	if !c.pool.CompareAndSwap(nil, p) {
+		p.Close()
+		return c.pool.Load()
+	}
+	return p
+}
+
+// PoolStats 返回事件工作池的运行状态
+func (c *Client) PoolStats() PoolStats {
+	return c.workerPool().Stats()
+}
+
+// SetHost 只连接指定的弹幕服务器
 func (c *Client) SetHost(host string) {
-	c.host = host
+	c.pinnedHosts = []string{host}
 }
 
 // UseDefaultHost 使用默认 host broadcastlv.chat.bilibili.com
 func (c *Client) UseDefaultHost() {
-	c.hostList = []string{"broadcastlv.chat.bilibili.com"}
+	c.pinnedHosts = []string{defaultHost}
 }
 
-func (c *Client) sendEnterPacket() error {
-	pkt := packet.NewEnterPacket(c.Uid, c.Buvid, c.RoomID, c.token)
+// SetProtocol 设置协议协商，recv 为认证时希望服务器下发消息使用的协议版本，默认 Brotli；
+// send 为发送认证包和心跳包使用的协议版本，默认为未压缩的 Popularity，与网页端一致。
+// 在 Start 前调用，重连后对新连接生效
+func (c *Client) SetProtocol(recv, send uint16) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	if err := c.conn.WriteMessage(websocket.BinaryMessage, pkt); err != nil {
+	c.protover, c.sendVersion = recv, send
+}
+
+// newEncoder 为新连接创建编码器并构造认证包
+func (c *Client) newEncoder() (*packet.Encoder, []byte, error) {
+	c.lock.RLock()
+	protover, send := c.protover, c.sendVersion
+	c.lock.RUnlock()
+	enc := packet.NewEncoder(send)
+	pkt, err := enc.Enter(packet.NewEnter(c.Uid, c.Buvid, c.RoomID, c.token, protover))
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, pkt, nil
+}
+
+func (c *Client) sendEnterPacket(conn *websocket.Conn, pkt []byte) error {
+	_ = conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := conn.WriteMessage(websocket.BinaryMessage, pkt); err != nil {
 		return err
 	}
 	log.Debugf("send: EnterPacket")
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/api"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+	log "github.com/zeromicro/go-zero/core/logx"
+)
+
+// 连接状态事件，通过事件总线发布，Data 为 *ConnectionEvent
+const (
+	EventConnected    = "CLIENT_CONNECTED"    // 连接成功，包括首次连接和重连
+	EventDisconnected = "CLIENT_DISCONNECTED" // 连接断开，随后开始重连
+	EventReconnecting = "CLIENT_RECONNECTING" // 等待 Delay 后进行第 Attempt 次重连
+	EventPopularity   = "CLIENT_POPULARITY"   // 心跳回复的人气值，Data 为 int
+)
+
+// ErrAuthRejected 认证包被服务器拒绝，通常是 token 已失效
+var ErrAuthRejected = errors.New("enter packet rejected")
+
+const defaultHost = "broadcastlv.chat.bilibili.com"
+
+const (
+	heartbeatInterval = 30 * time.Second
+	// 服务器每次收到心跳都会回复，超过两个心跳周期没有收到任何数据视为连接已断开
+	readTimeout        = 2*heartbeatInterval + 10*time.Second
+	writeTimeout       = 10 * time.Second
+	enterTimeout       = 10 * time.Second
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = time.Minute
+)
+
+// ConnectionEvent 连接状态变化
+type ConnectionEvent struct {
+	RoomID  int
+	Host    string
+	Attempt int           // 第几次重连，首次连接为 0
+	Delay   time.Duration // 本次重连前的等待时间
+	Err     error         // 断开的原因
+}
+
+// backoff 第 attempt 次重连前的等待时间，指数增长并加入随机抖动，避免多个直播间同时重连
+func backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := reconnectMaxDelay
+	if attempt <= 16 {
+		if e := reconnectBaseDelay << (attempt - 1); e < d {
+			d = e
+		}
+	}
+	// 在 [d/2, d) 之间随机
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)))
+}
+
+func (c *Client) publishConn(cmd string, e *ConnectionEvent) {
+	e.RoomID = c.RoomID
+	c.bus.Publish(&Event{Cmd: cmd, Data: e, Err: e.Err})
+}
+
+// refreshDanmuInfo 获取新的弹幕服务器列表和认证 token，每次重连前调用
+func (c *Client) refreshDanmuInfo() error {
+	info, err := api.GetDanmuInfo(c.RoomID, c.Cookie, c.WbiMixinKey)
+	if err != nil {
+		return err
+	}
+	if info.Code != 0 {
+		return fmt.Errorf("getDanmuInfo code=%d: %s", info.Code, info.Message)
+	}
+	c.token = info.Data.Token
+	if len(c.pinnedHosts) > 0 {
+		return nil
+	}
+	var hosts []string
+	for _, h := range info.Data.HostList {
+		if h.Host != "" {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	if len(hosts) > 0 {
+		c.hostList = hosts
+	}
+	return nil
+}
+
+// dial 连接下一个弹幕服务器并发送认证包
+func (c *Client) dial() (*websocket.Conn, error) {
+	hosts := c.hostList
+	if len(c.pinnedHosts) > 0 {
+		hosts = c.pinnedHosts
+	}
+	if len(hosts) == 0 {
+		hosts = []string{defaultHost}
+	}
+	c.host = hosts[c.retryCount%len(hosts)]
+	c.retryCount++
+	reqHeader := http.Header{}
+	reqHeader.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/102.0.0.0 Safari/537.36")
+	conn, res, err := websocket.DefaultDialer.DialContext(c.ctx, fmt.Sprintf("wss://%s/sub", c.host), reqHeader)
+	if err != nil {
+		return nil, err
+	}
+	_ = res.Body.Close()
+	enc, enter, err := c.newEncoder()
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err = c.sendEnterPacket(conn, enter); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err = c.waitEnterResponse(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !c.setConn(conn, enc) {
+		return nil, errors.New("client stopped")
+	}
+	// 认证后立即发送一次心跳，服务器随即回复人气值
+	if err = c.write(packet.HeartBeat, nil); err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixNano()
+	c.lastMessage.Store(now)
+	c.lastBeat.Store(now)
+	return conn, nil
+}
+
+// waitEnterResponse 等待认证回复，认证前收到的其他消息照常处理
+func (c *Client) waitEnterResponse(conn *websocket.Conn) error {
+	_ = conn.SetReadDeadline(time.Now().Add(enterTimeout))
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return fmt.Errorf("wait enter response: %w", err)
+		}
+		c.lastReply.Store(time.Now().UnixNano())
+		if msgType != websocket.BinaryMessage {
+			continue
+		}
+		packets, err := packet.DecodeAll(data)
+		if err != nil {
+			log.Errorf("room=%d decode packet failed: %v", c.RoomID, err)
+		}
+		entered := false
+		for _, pkt := range packets {
+			if pkt.Operation != packet.RoomEnterResponse {
+				c.dispatch(pkt)
+				continue
+			}
+			c.record(pkt)
+			code, err := packet.ParseEnterResponse(pkt.Body)
+			if err != nil {
+				return fmt.Errorf("parse enter response: %w", err)
+			}
+			if code != 0 {
+				return fmt.Errorf("%w: code=%d", ErrAuthRejected, code)
+			}
+			entered = true
+		}
+		if entered {
+			log.Debugf("room=%d enter accepted", c.RoomID)
+			return nil
+		}
+	}
+}
+
+// connectOnce 依次尝试每个弹幕服务器，全部失败时返回最后一个错误
+func (c *Client) connectOnce() (*websocket.Conn, error) {
+	n := len(c.hostList)
+	if len(c.pinnedHosts) > 0 {
+		n = len(c.pinnedHosts)
+	}
+	if n == 0 {
+		n = 1
+	}
+	var err error
+	for i := 0; i < n; i++ {
+		var conn *websocket.Conn
+		if conn, err = c.dial(); err == nil {
+			return conn, nil
+		}
+		log.Errorf("room=%d connect %s failed: %v", c.RoomID, c.host, err)
+	}
+	return nil, err
+}
+
+// reconnect 按退避时间不断重连，直到成功或 client 停止，停止时返回 nil
+func (c *Client) reconnect() *websocket.Conn {
+	for attempt := 1; ; attempt++ {
+		delay := backoff(attempt)
+		c.publishConn(EventReconnecting, &ConnectionEvent{Host: c.host, Attempt: attempt, Delay: delay})
+		log.Infof("room=%d reconnecting in %v, attempt %d", c.RoomID, delay, attempt)
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+		// 旧的 token 可能已经失效，重新获取 token 和服务器列表
+		if err := c.refreshDanmuInfo(); err != nil {
+			log.Errorf("room=%d refresh DanmuInfo failed: %v", c.RoomID, err)
+		}
+		conn, err := c.dial()
+		if err != nil {
+			// 认证被拒绝时下次重连前会重新获取 token
+			log.Errorf("room=%d reconnect %s failed: %v", c.RoomID, c.host, err)
+			continue
+		}
+		log.Infof("room=%d reconnected to %s", c.RoomID, c.host)
+		c.publishConn(EventConnected, &ConnectionEvent{Host: c.host, Attempt: attempt})
+		return conn
+	}
+}
+
+// setConn 替换当前连接，client 已停止时关闭连接并返回 false
+func (c *Client) setConn(conn *websocket.Conn, enc *packet.Encoder) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.done:
+		_ = conn.Close()
+		return false
+	default:
+	}
+	c.conn, c.enc = conn, enc
+	return true
+}
+
+// write 用当前连接的编码器构造一个包并写入，写入失败时关闭连接，由读循环负责重连
+func (c *Client) write(operation uint32, body []byte) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	pkt, err := c.enc.Encode(operation, body)
+	if err != nil {
+		return err
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, pkt); err != nil {
+		_ = c.conn.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *Client) closeConn() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.conn != nil {
+		_ = c.conn.Close()
+	}
+}
+
+// Reconnect 主动断开当前连接，随后按正常流程重新获取 token 并重连
+func (c *Client) Reconnect() {
+	c.closeConn()
+}
+
+// Popularity 最近一次心跳回复的人气值
+func (c *Client) Popularity() int {
+	return int(c.popularity.Load())
+}
+
+// LastReply 最近一次收到服务器数据的时间，包括心跳回复
+func (c *Client) LastReply() time.Time {
+	return unixNano(c.lastReply.Load())
+}
+
+// LastMessage 最近一次收到业务消息的时间，连接成功时重置为连接时间
+// 冷门直播间可能很久没有业务消息，不能据此判断连接是否正常
+func (c *Client) LastMessage() time.Time {
+	return unixNano(c.lastMessage.Load())
+}
+
+// LastHeartbeat 最近一次收到心跳回复的时间，连接成功时重置为连接时间
+// 连接仍有数据但长时间没有心跳回复时，多半是认证被服务器静默拒绝
+func (c *Client) LastHeartbeat() time.Time {
+	return unixNano(c.lastBeat.Load())
+}
+
+func unixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
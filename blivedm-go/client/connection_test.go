@@ -0,0 +1,85 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+)
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 100; attempt++ {
+		want := reconnectMaxDelay
+		if attempt <= 6 {
+			want = reconnectBaseDelay << (attempt - 1)
+		}
+		for i := 0; i < 20; i++ {
+			d := backoff(attempt)
+			if d < want/2 || d >= want {
+				t.Fatalf("attempt %d: %v not in [%v, %v)", attempt, d, want/2, want)
+			}
+		}
+	}
+	if d := backoff(0); d >= time.Second {
+		t.Errorf("attempt 0 should be treated as the first retry, got %v", d)
+	}
+}
+
+func TestHandleHeartBeatResponse(t *testing.T) {
+	c := NewClient(1)
+	got := -1
+	c.OnPopularity(func(popularity int) { got = popularity })
+	c.Handle(packet.NewPacket(packet.Plain, packet.Notification, []byte(`{"cmd":"DANMU_MSG","info":[]}`)))
+	if !c.LastHeartbeat().IsZero() {
+		t.Error("notification should not count as a heartbeat reply")
+	}
+	c.Handle(packet.NewPacket(packet.Popularity, packet.HeartBeatResponse, []byte{0, 1, 0, 1}))
+	if c.LastHeartbeat().IsZero() {
+		t.Error("heartbeat reply time not recorded")
+	}
+	if got != 65537 || c.Popularity() != 65537 {
+		t.Errorf("want popularity 65537, got %d / %d", got, c.Popularity())
+	}
+	// 过短的回复不应该覆盖已有的人气值
+	c.Handle(packet.NewPacket(packet.Popularity, packet.HeartBeatResponse, []byte{1}))
+	if c.Popularity() != 65537 {
+		t.Errorf("short reply changed popularity to %d", c.Popularity())
+	}
+}
+
+func TestParseEnterResponse(t *testing.T) {
+	if code, err := packet.ParseEnterResponse([]byte(`{"code":0}`)); err != nil || code != 0 {
+		t.Errorf("accepted: got %d, %v", code, err)
+	}
+	if code, err := packet.ParseEnterResponse([]byte(`{"code":-101}`)); err != nil || code != -101 {
+		t.Errorf("rejected: got %d, %v", code, err)
+	}
+	if _, err := packet.ParseEnterResponse([]byte(`{}`)); err == nil {
+		t.Error("missing code should be an error")
+	}
+}
+
+func TestEnterPacketProtocol(t *testing.T) {
+	c := NewClient(1)
+	c.SetProtocol(packet.Zlib, packet.Brotli)
+	enc, data, err := c.newEncoder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outer, _ := packet.Split(data); len(outer) != 1 || outer[0].ProtocolVersion != packet.Brotli {
+		t.Fatalf("enter packet not compressed: %+v", outer)
+	}
+	packets, err := packet.DecodeAll(data)
+	if err != nil || len(packets) != 1 {
+		t.Fatalf("got %d packets, %v", len(packets), err)
+	}
+	var enter packet.Enter
+	if err = packets[0].Unmarshal(&enter); err != nil || enter.ProtoVer != packet.Zlib || enter.RoomID != 1 {
+		t.Fatalf("enter = %+v, %v", enter, err)
+	}
+	// 心跳包沿用同一个编码器，序号紧接认证包
+	hb, _ := enc.HeartBeat()
+	if p, _ := packet.DecodeAll(hb); p[0].SequenceID != 2 {
+		t.Fatalf("heartbeat seq = %d", p[0].SequenceID)
+	}
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/utils"
+	log "github.com/zeromicro/go-zero/core/logx"
+)
+
+// AllEvents 订阅该 cmd 可以收到所有事件
+const AllEvents = "*"
+
+// Event 事件总线上传递的事件
+type Event struct {
+	Cmd  string
+	Body []byte
+	// Data 已解析的消息，如 DANMU_MSG 为 *message.Danmaku，未内置解析的 cmd 为 nil
+	Data interface{}
+	// Err 内置解析失败时的错误，此时 Data 为 nil
+	Err error
+}
+
+// String 返回原始报文
+func (e *Event) String() string {
+	return utils.BytesToString(e.Body)
+}
+
+// EventFilter 事件过滤条件，返回 false 时跳过该订阅者
+type EventFilter func(e *Event) bool
+
+type subscriber struct {
+	id       uint64
+	priority int
+	filters  []EventFilter
+	handler  func(e *Event)
+}
+
+// SubscribeOption 订阅选项
+type SubscribeOption func(s *subscriber)
+
+// WithPriority 设置订阅优先级，数值越大越先执行，默认为 0
+func WithPriority(priority int) SubscribeOption {
+	return func(s *subscriber) {
+		s.priority = priority
+	}
+}
+
+// WithFilter 添加过滤条件，多个条件需同时满足
+func WithFilter(filter EventFilter) SubscribeOption {
+	return func(s *subscriber) {
+		s.filters = append(s.filters, filter)
+	}
+}
+
+// Subscription 订阅句柄，用于取消订阅
+type Subscription struct {
+	bus  *EventBus
+	cmd  string
+	id   uint64
+	once sync.Once
+}
+
+// Unsubscribe 取消订阅，可重复调用
+func (s *Subscription) Unsubscribe() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		s.bus.remove(s.cmd, s.id)
+	})
+}
+
+// EventBus 按 cmd 分发事件的发布订阅总线
+//
+// 同一 cmd 可以有多个订阅者，按优先级从高到低依次执行，优先级相同时按订阅顺序执行
+type EventBus struct {
+	lock   sync.RWMutex
+	nextID uint64
+	subs   map[string][]*subscriber
+}
+
+// NewEventBus 创建一个事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subs: make(map[string][]*subscriber),
+	}
+}
+
+// Subscribe 订阅事件，cmd 为 AllEvents 时订阅所有事件
+func (b *EventBus) Subscribe(cmd string, handler func(e *Event), opts ...SubscribeOption) *Subscription {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.nextID++
+	s := &subscriber{id: b.nextID, handler: handler}
+	for _, opt := range opts {
+		opt(s)
+	}
+	// 写时复制，发布时可以无锁遍历
+	old := b.subs[cmd]
+	subs := make([]*subscriber, 0, len(old)+1)
+	subs = append(subs, old...)
+	subs = append(subs, s)
+	sort.SliceStable(subs, func(i, j int) bool {
+		return subs[i].priority > subs[j].priority
+	})
+	b.subs[cmd] = subs
+	return &Subscription{bus: b, cmd: cmd, id: s.id}
+}
+
+// SubscribeRaw 订阅事件的原始报文
+func (b *EventBus) SubscribeRaw(cmd string, handler func(s string), opts ...SubscribeOption) *Subscription {
+	return b.Subscribe(cmd, func(e *Event) {
+		handler(e.String())
+	}, opts...)
+}
+
+func (b *EventBus) remove(cmd string, id uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	old := b.subs[cmd]
+	subs := make([]*subscriber, 0, len(old))
+	for _, s := range old {
+		if s.id != id {
+			subs = append(subs, s)
+		}
+	}
+	if len(subs) == 0 {
+		delete(b.subs, cmd)
+		return
+	}
+	b.subs[cmd] = subs
+}
+
+// HasSubscribers 判断 cmd 是否有订阅者
+func (b *EventBus) HasSubscribers(cmd string) bool {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.subs[cmd]) > 0 || len(b.subs[AllEvents]) > 0
+}
+
+// Publish 发布事件，在当前 goroutine 中按优先级依次调用订阅者，返回实际调用的订阅者数量
+//
+// 单个订阅者 panic 不影响后续订阅者
+func (b *EventBus) Publish(e *Event) int {
+	b.lock.RLock()
+	subs := b.subs[e.Cmd]
+	if all := b.subs[AllEvents]; len(all) > 0 {
+		merged := make([]*subscriber, 0, len(subs)+len(all))
+		merged = append(merged, subs...)
+		merged = append(merged, all...)
+		sort.SliceStable(merged, func(i, j int) bool {
+			return merged[i].priority > merged[j].priority
+		})
+		subs = merged
+	}
+	b.lock.RUnlock()
+
+	n := 0
+	for _, s := range subs {
+		if !s.accept(e) {
+			continue
+		}
+		n++
+		cover(func() { s.handler(e) })
+	}
+	return n
+}
+
+func (s *subscriber) accept(e *Event) (ok bool) {
+	defer func() {
+		if pan := recover(); pan != nil {
+			log.Errorf("event filter error: %v", pan)
+			ok = false
+		}
+	}()
+	for _, f := range s.filters {
+		if !f(e) {
+			return false
+		}
+	}
+	return true
+}
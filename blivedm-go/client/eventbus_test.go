@@ -0,0 +1,64 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+)
+
+func TestEventBusPriorityAndUnsubscribe(t *testing.T) {
+	bus := NewEventBus()
+	var order []string
+	bus.Subscribe("DANMU_MSG", func(e *Event) { order = append(order, "low") }, WithPriority(-1))
+	sub := bus.Subscribe("DANMU_MSG", func(e *Event) { order = append(order, "default") })
+	bus.Subscribe("DANMU_MSG", func(e *Event) { order = append(order, "high") }, WithPriority(10))
+	bus.Subscribe(AllEvents, func(e *Event) { order = append(order, "all") }, WithPriority(5))
+
+	if n := bus.Publish(&Event{Cmd: "DANMU_MSG"}); n != 4 {
+		t.Fatalf("want 4 subscribers called, got %d", n)
+	}
+	want := []string{"high", "all", "default", "low"}
+	if len(order) != len(want) {
+		t.Fatalf("unexpected order %v", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("unexpected order %v", order)
+		}
+	}
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	order = nil
+	bus.Publish(&Event{Cmd: "DANMU_MSG"})
+	if len(order) != 3 {
+		t.Fatalf("unsubscribe failed: %v", order)
+	}
+}
+
+func TestEventBusFilterAndPanic(t *testing.T) {
+	bus := NewEventBus()
+	called := 0
+	bus.Subscribe("SEND_GIFT", func(e *Event) { panic("boom") })
+	bus.Subscribe("SEND_GIFT", func(e *Event) { called++ }, WithFilter(func(e *Event) bool {
+		return e.String() == "ok"
+	}))
+
+	bus.Publish(&Event{Cmd: "SEND_GIFT", Body: []byte("skip")})
+	bus.Publish(&Event{Cmd: "SEND_GIFT", Body: []byte("ok")})
+	if called != 1 {
+		t.Fatalf("want filtered handler called once, got %d", called)
+	}
+}
+
+func TestClientHandleMultipleHandlers(t *testing.T) {
+	c := NewClient(1)
+	got := make(chan string, 2)
+	c.RegisterCustomEventHandler("DANMU_MSG", func(s string) { got <- "custom1" })
+	c.RegisterCustomEventHandler("DANMU_MSG", func(s string) { got <- "custom2" })
+
+	c.Handle(packet.Packet{Operation: packet.Notification, Body: []byte(`{"cmd":"DANMU_MSG","info":[]}`)})
+	if len(got) != 2 {
+		t.Fatalf("want both custom handlers called, got %d", len(got))
+	}
+}
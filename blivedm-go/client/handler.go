@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"runtime/debug"
 	"strings"
+	"time"
 
 	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/message"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
@@ -167,18 +168,6 @@ var (
 	cmdReg      = regexp.MustCompile(`"cmd":"([^"]+)"`)
 )
 
-type eventHandlers struct {
-	danmakuMessageHandlers []func(*message.Danmaku)
-	superChatHandlers      []func(*message.SuperChat)
-	giftHandlers           []func(*message.Gift)
-	guardBuyHandlers       []func(*message.GuardBuy)
-	liveStartHandlers      []func(start *message.LiveStart)
-	liveStopHandlers       []func(start *message.LiveStop)
-	userToastHandlers      []func(*message.UserToast)
-}
-
-type customEventHandlers map[string]func(s string)
-
 func init() {
 	knownCMDMap = make(map[string]int)
 	for _, c := range knownCMD {
@@ -186,123 +175,176 @@ func init() {
 	}
 }
 
+// parsers 内置解析的事件，解析结果放在 Event.Data 中
+var parsers = map[string]func(body []byte) (interface{}, error){
+	// 弹幕
+	"DANMU_MSG": func(body []byte) (interface{}, error) {
+		return message.ParseDanmaku(body)
+	},
+	// 醒目留言
+	"SUPER_CHAT_MESSAGE": func(body []byte) (interface{}, error) {
+		s := new(message.SuperChat)
+		s.Parse(body)
+		return s, nil
+	},
+	// 礼物
+	"SEND_GIFT": func(body []byte) (interface{}, error) {
+		g := new(message.Gift)
+		g.Parse(body)
+		return g, nil
+	},
+	// 大航海
+	"GUARD_BUY": func(body []byte) (interface{}, error) {
+		g := new(message.GuardBuy)
+		g.Parse(body)
+		return g, nil
+	},
+	// 开播
+	"LIVE": func(body []byte) (interface{}, error) {
+		l := new(message.LiveStart)
+		l.Parse(body)
+		return l, nil
+	},
+	//下播
+	"PREPARING": func(body []byte) (interface{}, error) {
+		l := new(message.LiveStop)
+		l.Parse(body)
+		return l, nil
+	},
+	// 用户 toast
+	"USER_TOAST_MSG": func(body []byte) (interface{}, error) {
+		u := new(message.UserToast)
+		u.Parse(body)
+		return u, nil
+	},
+}
+
+// EventBus 返回 client 使用的事件总线
+func (c *Client) EventBus() *EventBus {
+	return c.bus
+}
+
+// SetEventBus 替换 client 使用的事件总线，用于在重建 client 后保留已有的订阅
+func (c *Client) SetEventBus(bus *EventBus) {
+	c.bus = bus
+}
+
+// Subscribe 订阅事件，见 EventBus.Subscribe
+func (c *Client) Subscribe(cmd string, handler func(e *Event), opts ...SubscribeOption) *Subscription {
+	return c.bus.Subscribe(cmd, handler, opts...)
+}
+
 // RegisterCustomEventHandler 注册 自定义事件 的处理器
 //
-// 需要提供事件名，可参考 knownCMD
-func (c *Client) RegisterCustomEventHandler(cmd string, handler func(s string)) {
-	(*c.customEventHandlers)[cmd] = handler
+// 需要提供事件名，可参考 knownCMD。同一事件可注册多个处理器，与 OnDanmaku 等处理器同时生效
+func (c *Client) RegisterCustomEventHandler(cmd string, handler func(s string)) *Subscription {
+	return c.bus.SubscribeRaw(cmd, handler)
+}
+
+// parsed 过滤解析失败的事件
+func parsed(e *Event) bool {
+	return e.Err == nil && e.Data != nil
 }
 
 // OnDanmaku 添加 弹幕事件 的处理器
-func (c *Client) OnDanmaku(f func(*message.Danmaku)) {
-	c.eventHandlers.danmakuMessageHandlers = append(c.eventHandlers.danmakuMessageHandlers, f)
+func (c *Client) OnDanmaku(f func(*message.Danmaku)) *Subscription {
+	return c.bus.Subscribe("DANMU_MSG", func(e *Event) {
+		f(e.Data.(*message.Danmaku))
+	}, WithFilter(parsed))
 }
 
 // OnSuperChat 添加 醒目留言事件 的处理器
-func (c *Client) OnSuperChat(f func(*message.SuperChat)) {
-	c.eventHandlers.superChatHandlers = append(c.eventHandlers.superChatHandlers, f)
+func (c *Client) OnSuperChat(f func(*message.SuperChat)) *Subscription {
+	return c.bus.Subscribe("SUPER_CHAT_MESSAGE", func(e *Event) {
+		f(e.Data.(*message.SuperChat))
+	}, WithFilter(parsed))
 }
 
 // OnGift 添加 礼物事件 的处理器
-func (c *Client) OnGift(f func(gift *message.Gift)) {
-	c.eventHandlers.giftHandlers = append(c.eventHandlers.giftHandlers, f)
+func (c *Client) OnGift(f func(gift *message.Gift)) *Subscription {
+	return c.bus.Subscribe("SEND_GIFT", func(e *Event) {
+		f(e.Data.(*message.Gift))
+	}, WithFilter(parsed))
 }
 
 // OnGuardBuy 添加 开通大航海事件 的处理器
-func (c *Client) OnGuardBuy(f func(*message.GuardBuy)) {
-	c.eventHandlers.guardBuyHandlers = append(c.eventHandlers.guardBuyHandlers, f)
+func (c *Client) OnGuardBuy(f func(*message.GuardBuy)) *Subscription {
+	return c.bus.Subscribe("GUARD_BUY", func(e *Event) {
+		f(e.Data.(*message.GuardBuy))
+	}, WithFilter(parsed))
 }
 
 // OnLiveStart 添加 开播事件 的处理器
-func (c *Client) OnLiveStart(f func(start *message.LiveStart)) {
-	c.eventHandlers.liveStartHandlers = append(c.eventHandlers.liveStartHandlers, f)
+func (c *Client) OnLiveStart(f func(start *message.LiveStart)) *Subscription {
+	return c.bus.Subscribe("LIVE", func(e *Event) {
+		f(e.Data.(*message.LiveStart))
+	}, WithFilter(parsed))
 }
 
 // OnLiveStop 添加 关播事件 的处理器
-func (c *Client) OnLiveStop(f func(start *message.LiveStop)) {
-	c.eventHandlers.liveStopHandlers = append(c.eventHandlers.liveStopHandlers, f)
+func (c *Client) OnLiveStop(f func(start *message.LiveStop)) *Subscription {
+	return c.bus.Subscribe("PREPARING", func(e *Event) {
+		f(e.Data.(*message.LiveStop))
+	}, WithFilter(parsed))
+}
+
+// OnPopularity 添加人气值的处理器，每次心跳回复时调用
+func (c *Client) OnPopularity(f func(popularity int)) *Subscription {
+	return c.bus.Subscribe(EventPopularity, func(e *Event) {
+		f(e.Data.(int))
+	})
 }
 
-// OnUserToast 添加 UserToast 的处理
 // OnUserToast 添加 UserToast 的处理器
-func (c *Client) OnUserToast(f func(*message.UserToast)) {
-	c.eventHandlers.userToastHandlers = append(c.eventHandlers.userToastHandlers, f)
+func (c *Client) OnUserToast(f func(*message.UserToast)) *Subscription {
+	return c.bus.Subscribe("USER_TOAST_MSG", func(e *Event) {
+		f(e.Data.(*message.UserToast))
+	}, WithFilter(parsed))
 }
 
 // Handle 处理一个包
 func (c *Client) Handle(p packet.Packet) {
 	switch p.Operation {
 	case packet.Notification:
+		c.lastMessage.Store(time.Now().UnixNano())
 		cmd := parseCmd(p.Body)
-		sb := utils.BytesToString(p.Body)
 		// 新的弹幕 cmd 可能带参数
 		if ind := strings.Index(cmd, ":"); ind >= 0 {
 			cmd = cmd[:ind]
 		}
-		// 优先执行自定义 eventHandler ，会覆盖库内自带的 handler
-		f, ok := (*c.customEventHandlers)[cmd]
-		if ok {
-			go cover(func() { f(sb) })
+		if !c.bus.HasSubscribers(cmd) {
+			if _, ok := knownCMDMap[cmd]; !ok {
+				log.Errorf("unknown cmd(%s), body: %s", cmd, p.Body)
+			}
 			return
 		}
-		switch cmd {
-		// 弹幕
-		case "DANMU_MSG":
-			d := new(message.Danmaku)
-			d.Parse(p.Body)
-			for _, fn := range c.eventHandlers.danmakuMessageHandlers {
-				go cover(func() { fn(d) })
-			}
-		// 醒目留言
-		case "SUPER_CHAT_MESSAGE":
-			s := new(message.SuperChat)
-			s.Parse(p.Body)
-			for _, fn := range c.eventHandlers.superChatHandlers {
-				go cover(func() { fn(s) })
-			}
-		// 礼物
-		case "SEND_GIFT":
-			g := new(message.Gift)
-			g.Parse(p.Body)
-			for _, fn := range c.eventHandlers.giftHandlers {
-				go cover(func() { fn(g) })
-			}
-		// 大航海
-		case "GUARD_BUY":
-			g := new(message.GuardBuy)
-			g.Parse(p.Body)
-			for _, fn := range c.eventHandlers.guardBuyHandlers {
-				go cover(func() { fn(g) })
-			}
-		// 开播
-		case "LIVE":
-			l := new(message.LiveStart)
-			l.Parse(p.Body)
-			for _, fn := range c.eventHandlers.liveStartHandlers {
-				go cover(func() { fn(l) })
-			}
-		//下播
-		case "PREPARING":
-			l := new(message.LiveStop)
-			l.Parse(p.Body)
-			for _, fn := range c.eventHandlers.liveStopHandlers {
-				go cover(func() { fn(l) })
+		e := &Event{Cmd: cmd, Body: p.Body}
+		if parse, ok := parsers[cmd]; ok {
+			cover(func() { e.Data, e.Err = parse(p.Body) })
+			if e.Err != nil {
+				e.Data = nil
+				log.Errorf("parse cmd(%s) failed: %v", cmd, e.Err)
 			}
-		// 用户 toast
-		case "USER_TOAST_MSG":
-			u := new(message.UserToast)
-			u.Parse(p.Body)
-			for _, fn := range c.eventHandlers.userToastHandlers {
-				go cover(func() { fn(u) })
-			}
-		default:
-			if _, ok := knownCMDMap[cmd]; ok {
-				return
-			}
-			log.Errorf("unknown cmd(%s), body: %s", cmd, p.Body)
 		}
+		c.bus.Publish(e)
 	case packet.HeartBeatResponse:
+		c.lastBeat.Store(time.Now().UnixNano())
+		popularity, err := packet.ParseHeartBeatResponse(p.Body)
+		if err != nil {
+			log.Errorf("parse heartbeat response failed: %v", err)
+			return
+		}
+		c.popularity.Store(int64(popularity))
+		if c.bus.HasSubscribers(EventPopularity) {
+			c.bus.Publish(&Event{Cmd: EventPopularity, Body: p.Body, Data: popularity})
+		}
 	case packet.RoomEnterResponse:
+		// 连接时已经处理过认证回复，之后再收到拒绝说明认证失效，断开重连以重新认证
+		code, err := packet.ParseEnterResponse(p.Body)
+		if err != nil || code != 0 {
+			log.Errorf("room=%d enter rejected: code=%d err=%v, reconnecting", c.RoomID, code, err)
+			c.Reconnect()
+		}
 	default:
 		log.Errorf("%s", fmt.Sprintf("protover: %v data: %v unknown protover", p.ProtocolVersion, p.Body))
 	}
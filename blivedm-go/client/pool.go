@@ -0,0 +1,181 @@
+package client
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tidwall/gjson"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+	log "github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	DefaultWorkers   = 8
+	DefaultQueueSize = 256
+)
+
+// LowValueCmds 过载时可以丢弃的低价值事件，丢失后不影响其他功能
+var LowValueCmds = map[string]bool{
+	"INTERACT_WORD":       true,
+	"INTERACT_WORD_V2":    true,
+	"ENTRY_EFFECT":        true,
+	"ONLINE_RANK_V2":      true,
+	"ONLINE_RANK_TOP3":    true,
+	"ONLINE_RANK_COUNT":   true,
+	"WATCHED_CHANGE":      true,
+	"LIKE_INFO_V3_CLICK":  true,
+	"LIKE_INFO_V3_UPDATE": true,
+	"STOP_LIVE_ROOM_LIST": true,
+}
+
+// PoolStats 工作池的运行状态
+type PoolStats struct {
+	Workers   int
+	QueueSize int   // 每个协程的队列长度
+	Queued    int   // 当前排队的任务数
+	Submitted int64 // 已提交的任务数，包括被丢弃的
+	Dropped   int64 // 过载时丢弃的任务数
+	Blocked   int64 // 队列已满、提交方等待的次数
+}
+
+// WorkerPool 固定数量的协程处理任务，相同 key 的任务由同一个协程按提交顺序执行
+//
+// 可丢弃的任务在队列超过 3/4 时直接丢弃，其他任务在队列满时等待，使读取方感受到背压
+type WorkerPool struct {
+	queues  []chan func()
+	done    chan struct{}
+	once    sync.Once
+	workers sync.WaitGroup
+
+	submitted atomic.Int64
+	dropped   atomic.Int64
+	blocked   atomic.Int64
+}
+
+// NewWorkerPool 创建工作池，参数不大于 0 时使用默认值
+func NewWorkerPool(workers, queueSize int) *WorkerPool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	p := &WorkerPool{
+		queues: make([]chan func(), workers),
+		done:   make(chan struct{}),
+	}
+	p.workers.Add(workers)
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+		go p.work(p.queues[i])
+	}
+	return p
+}
+
+func (p *WorkerPool) work(queue chan func()) {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.done:
+			return
+		case task := <-queue:
+			// 关闭和取出任务同时就绪时 select 随机选择，关闭后不再执行新的任务
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+			cover(task)
+		}
+	}
+}
+
+// Submit 提交任务，返回是否已加入队列；droppable 为 true 的任务在过载时被丢弃，工作池关闭后提交的任务也被丢弃
+func (p *WorkerPool) Submit(key uint64, droppable bool, task func()) bool {
+	p.submitted.Add(1)
+	select {
+	case <-p.done:
+		return false
+	default:
+	}
+	queue := p.queues[key%uint64(len(p.queues))]
+	if droppable && len(queue) >= cap(queue)*3/4 {
+		p.drop()
+		return false
+	}
+	select {
+	case queue <- task:
+		return true
+	default:
+	}
+	p.blocked.Add(1)
+	select {
+	case <-p.done:
+		return false
+	case queue <- task:
+		return true
+	}
+}
+
+func (p *WorkerPool) drop() {
+	if n := p.dropped.Add(1); n%1000 == 1 {
+		log.Errorf("worker pool overloaded, dropped %d low value events", n)
+	}
+}
+
+// Stats 返回工作池的运行状态
+func (p *WorkerPool) Stats() PoolStats {
+	s := PoolStats{
+		Workers:   len(p.queues),
+		QueueSize: cap(p.queues[0]),
+		Submitted: p.submitted.Load(),
+		Dropped:   p.dropped.Load(),
+		Blocked:   p.blocked.Load(),
+	}
+	for _, q := range p.queues {
+		s.Queued += len(q)
+	}
+	return s
+}
+
+// Close 停止工作池，正在执行的任务继续执行完，未执行的任务被丢弃，可重复调用
+// 不等待任务结束，可以在任务中调用，需要等待时调用 Wait
+func (p *WorkerPool) Close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// Wait 等待 Close 之后所有协程退出，即正在执行的任务全部结束；不能在任务中调用
+func (p *WorkerPool) Wait() {
+	p.workers.Wait()
+}
+
+// HashKey 将字符串转换为工作池的 key
+func HashKey(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// packetKey 按发送者 uid 分配协程，同一用户的消息保持顺序；没有 uid 的消息按 cmd 分配
+func packetKey(p packet.Packet) (key uint64, cmd string) {
+	if p.Operation != packet.Notification {
+		return 0, ""
+	}
+	cmd = parseCmd(p.Body)
+	if ind := strings.Index(cmd, ":"); ind >= 0 {
+		cmd = cmd[:ind]
+	}
+	uid := gjson.GetBytes(p.Body, "data.uid").Uint()
+	if uid == 0 {
+		// 弹幕的 uid 在 info[2][0]
+		uid = gjson.GetBytes(p.Body, "info.2.0").Uint()
+	}
+	if uid != 0 {
+		return uid, cmd
+	}
+	return HashKey(cmd), cmd
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+)
+
+func TestWorkerPoolKeepsOrderPerKey(t *testing.T) {
+	p := NewWorkerPool(4, 8)
+	defer p.Close()
+	var (
+		lock sync.Mutex
+		got  = make(map[uint64][]int)
+		wg   sync.WaitGroup
+	)
+	for i := 0; i < 100; i++ {
+		key, i := uint64(i%5), i
+		wg.Add(1)
+		p.Submit(key, false, func() {
+			defer wg.Done()
+			lock.Lock()
+			got[key] = append(got[key], i)
+			lock.Unlock()
+		})
+	}
+	wg.Wait()
+	for key, seq := range got {
+		for j := 1; j < len(seq); j++ {
+			if seq[j] < seq[j-1] {
+				t.Fatalf("key %d out of order: %v", key, seq)
+			}
+		}
+	}
+	if s := p.Stats(); s.Submitted != 100 || s.Dropped != 0 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestWorkerPoolWaitForRunningTask(t *testing.T) {
+	p := NewWorkerPool(1, 4)
+	started := make(chan struct{})
+	var finished, queuedRan atomic.Bool
+	p.Submit(1, false, func() {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	})
+	p.Submit(1, false, func() { queuedRan.Store(true) })
+	<-started
+	p.Close()
+	p.Wait()
+	if !finished.Load() {
+		t.Fatal("Wait returned before the running task finished")
+	}
+	if queuedRan.Load() {
+		t.Fatal("queued task ran after Close")
+	}
+}
+
+func TestWorkerPoolDropsLowValueWhenOverloaded(t *testing.T) {
+	p := NewWorkerPool(1, 4)
+	defer p.Close()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p.Submit(0, false, func() { close(started); <-release })
+	<-started
+	// 队列中已有 3 个任务，超过 3/4 后低价值任务被丢弃
+	for i := 0; i < 3; i++ {
+		if !p.Submit(0, false, func() {}) {
+			t.Fatal("normal task rejected")
+		}
+	}
+	if p.Submit(0, true, func() {}) {
+		t.Fatal("low value task accepted when overloaded")
+	}
+	// 普通任务在队列满时等待
+	done := make(chan bool)
+	go func() {
+		p.Submit(0, false, func() {})
+		done <- p.Submit(0, false, func() {})
+	}()
+	select {
+	case <-done:
+		t.Fatal("submit did not block on full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if !<-done {
+		t.Fatal("blocked task rejected")
+	}
+	s := p.Stats()
+	if s.Dropped != 1 || s.Blocked < 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+	p.Close()
+	if p.Submit(0, false, func() {}) {
+		t.Fatal("closed pool accepted task")
+	}
+}
+
+func TestPacketKey(t *testing.T) {
+	notify := func(body string) packet.Packet {
+		return packet.NewPacket(packet.Plain, packet.Notification, []byte(body))
+	}
+	if key, cmd := packetKey(notify(`{"cmd":"INTERACT_WORD","data":{"uid":42}}`)); key != 42 || !LowValueCmds[cmd] {
+		t.Errorf("interact: %d %q", key, cmd)
+	}
+	if key, cmd := packetKey(notify(`{"cmd":"DANMU_MSG:4:0:2:2:2:0","info":[[],"hi",[42,"a"]]}`)); key != 42 || cmd != "DANMU_MSG" {
+		t.Errorf("danmaku: %d %q", key, cmd)
+	}
+	if key, _ := packetKey(notify(`{"cmd":"PK_BATTLE_START","data":{}}`)); key != HashKey("PK_BATTLE_START") {
+		t.Errorf("no uid: %d", key)
+	}
+}
+
+func TestClientWaitForPoolTasks(t *testing.T) {
+	c := NewClient(1)
+	started := make(chan struct{})
+	var finished atomic.Bool
+	c.bus.Subscribe("DANMU_MSG", func(*Event) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		finished.Store(true)
+	})
+	c.dispatch(packet.NewPacket(packet.Plain, packet.Notification, []byte(`{"cmd":"DANMU_MSG","info":[]}`)))
+	<-started
+	c.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Fatal("Wait returned before the event handler finished")
+	}
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+	log "github.com/zeromicro/go-zero/core/logx"
+)
+
+// Frame 录制的一个已解码的包，每行一个 json
+// Body 为 json 时原样保存便于阅读和编辑，否则以 base64 保存在 Raw 中
+type Frame struct {
+	Time      time.Time       `json:"time"`
+	Operation uint32          `json:"op"`
+	Version   uint16          `json:"ver"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Raw       []byte          `json:"raw,omitempty"`
+}
+
+// NewFrame 将包转换为录制帧
+func NewFrame(t time.Time, p packet.Packet) Frame {
+	f := Frame{Time: t, Operation: p.Operation, Version: p.ProtocolVersion}
+	if len(p.Body) > 0 && json.Valid(p.Body) {
+		f.Body = append(json.RawMessage(nil), p.Body...)
+	} else {
+		f.Raw = append([]byte(nil), p.Body...)
+	}
+	return f
+}
+
+// Packet 还原为包
+func (f Frame) Packet() packet.Packet {
+	body := []byte(f.Body)
+	if len(body) == 0 {
+		body = f.Raw
+	}
+	return packet.NewPacket(f.Version, f.Operation, body)
+}
+
+// Recorder 将收到的包逐帧写入 json lines 文件，用于离线回放
+type Recorder struct {
+	locked sync.Mutex
+	enc    *json.Encoder
+	closer io.Closer
+}
+
+// NewRecorder 录制到 w
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{enc: json.NewEncoder(w)}
+	if c, ok := w.(io.Closer); ok {
+		r.closer = c
+	}
+	return r
+}
+
+// CreateRecorder 录制到文件，文件已存在时追加
+func CreateRecorder(path string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecorder(f), nil
+}
+
+// Record 录制一个包
+func (r *Recorder) Record(p packet.Packet) error {
+	r.locked.Lock()
+	defer r.locked.Unlock()
+	return r.enc.Encode(NewFrame(time.Now(), p))
+}
+
+// Close 关闭录制文件
+func (r *Recorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// SetRecorder 录制之后收到的所有包，为 nil 时停止录制
+func (c *Client) SetRecorder(r *Recorder) {
+	c.recorder.Store(r)
+}
+
+func (c *Client) record(p packet.Packet) {
+	if r := c.recorder.Load(); r != nil {
+		if err := r.Record(p); err != nil {
+			log.Errorf("record packet failed: %v", err)
+		}
+	}
+}
+
+// dispatch 录制收到的包，交给工作池处理，过载时丢弃低价值事件
+func (c *Client) dispatch(p packet.Packet) {
+	c.record(p)
+	key, cmd := packetKey(p)
+	c.workerPool().Submit(key, LowValueCmds[cmd], func() { c.Handle(p) })
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf)
+	packets := []packet.Packet{
+		packet.NewPacket(packet.Plain, packet.Notification, []byte(`{"cmd":"INTERACT_WORD","data":{"uname":"a"}}`)),
+		packet.NewPacket(packet.Popularity, packet.HeartBeatResponse, []byte{0, 0, 0x30, 0x39}),
+		packet.NewPacket(packet.Plain, packet.Notification, []byte(`{"cmd":"SEND_GIFT","data":{"uname":"b"}}`)),
+	}
+	for _, p := range packets {
+		if err := rec.Record(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReplayer(1, &buf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Frames() != len(packets) {
+		t.Fatalf("frames = %d, want %d", r.Frames(), len(packets))
+	}
+	var cmds []string
+	r.EventBus().SubscribeRaw("INTERACT_WORD", func(s string) { cmds = append(cmds, "INTERACT_WORD") })
+	r.EventBus().SubscribeRaw("SEND_GIFT", func(s string) { cmds = append(cmds, "SEND_GIFT") })
+	if err = r.Replay(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 2 || cmds[0] != "INTERACT_WORD" || cmds[1] != "SEND_GIFT" {
+		t.Fatalf("cmds = %v", cmds)
+	}
+	if r.Popularity() != 12345 {
+		t.Fatalf("popularity = %d, want 12345", r.Popularity())
+	}
+}
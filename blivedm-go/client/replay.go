@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Source 弹幕消息来源，Client 连接直播间，Replayer 回放录制的消息
+type Source interface {
+	Start() error
+	Stop()
+	// Wait 等待 Stop 后后台的 goroutine 全部退出，ctx 到期时返回 ctx.Err()
+	Wait(ctx context.Context) error
+	EventBus() *EventBus
+	SetEventBus(bus *EventBus)
+}
+
+var (
+	_ Source = (*Client)(nil)
+	_ Source = (*Replayer)(nil)
+)
+
+// Replayer 按录制时的时间间隔回放录制的包，不连接网络
+// 包在同一个 goroutine 中依次交给 Handle 处理，订阅者收到的顺序与录制时一致
+type Replayer struct {
+	*Client
+	frames   []Frame
+	speed    float64
+	cancel   context.CancelFunc
+	finished chan struct{}
+	err      error
+}
+
+// NewReplayer 读取 r 中录制的所有帧，speed 为回放倍速，小于等于 0 时不等待
+func NewReplayer(roomID int, r io.Reader, speed float64) (*Replayer, error) {
+	var frames []Frame
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var f Frame
+		if err := json.Unmarshal(sc.Bytes(), &f); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		frames = append(frames, f)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return &Replayer{
+		Client:   NewClient(roomID),
+		frames:   frames,
+		speed:    speed,
+		finished: make(chan struct{}),
+	}, nil
+}
+
+// OpenReplayer 读取录制文件
+func OpenReplayer(roomID int, path string, speed float64) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return NewReplayer(roomID, f, speed)
+}
+
+// Frames 录制的帧数
+func (r *Replayer) Frames() int {
+	return len(r.frames)
+}
+
+// Start 在后台开始回放，回放结束后 Done 关闭
+func (r *Replayer) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	go func() {
+		defer close(r.finished)
+		r.err = r.Replay(ctx)
+	}()
+	return nil
+}
+
+// Stop 停止回放
+func (r *Replayer) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Wait 等待回放结束或停止，没有调用 Start 时直接返回
+func (r *Replayer) Wait(ctx context.Context) error {
+	if r.cancel == nil {
+		return nil
+	}
+	select {
+	case <-r.finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done 回放结束或停止后关闭
+func (r *Replayer) Done() <-chan struct{} {
+	return r.finished
+}
+
+// Err Done 关闭后返回回放的结果，被 Stop 时为 context.Canceled
+func (r *Replayer) Err() error {
+	return r.err
+}
+
+// Replay 在当前 goroutine 中回放所有帧，ctx 取消时返回
+func (r *Replayer) Replay(ctx context.Context) error {
+	var last time.Time
+	for _, f := range r.frames {
+		if r.speed > 0 && !last.IsZero() && f.Time.After(last) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(float64(f.Time.Sub(last)) / r.speed)):
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		last = f.Time
+		r.Handle(f.Packet())
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package message
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/tidwall/gjson"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/pb"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/utils"
@@ -15,8 +18,10 @@ const (
 
 type (
 	Danmaku struct {
+		ID        string // 弹幕 id，回复弹幕时使用
 		Sender    *User
 		Content   string
+		Reply     *Reply // 回复的用户，没有回复时为 nil
 		Extra     *Extra
 		Emoticon  *Emoticon
 		Type      int
@@ -24,6 +29,12 @@ type (
 		Raw       string
 	}
 
+	// Reply 弹幕中 @ 的用户
+	Reply struct {
+		Uid   int
+		Uname string
+	}
+
 	Extra struct {
 		SendFromMe     bool   `json:"send_from_me"`
 		Mode           int    `json:"mode"`
@@ -39,6 +50,9 @@ type (
 		PkDirection    int    `json:"pk_direction"`
 		SpaceType      string `json:"space_type"`
 		SpaceUrl       string `json:"space_url"`
+		IdStr          string `json:"id_str"`
+		ReplyMid       int    `json:"reply_mid"`
+		ReplyUname     string `json:"reply_uname"`
 	}
 	Emoticon struct {
 		BulgeDisplay   int    `json:"bulge_display"`
@@ -60,6 +74,37 @@ type (
 	}
 )
 
+// ErrMalformedDanmaku DANMU_MSG 报文结构不符合预期
+var ErrMalformedDanmaku = errors.New("malformed danmaku")
+
+// ParseDanmaku 校验并解析 DANMU_MSG 报文，结构不符合预期时返回 ErrMalformedDanmaku
+func ParseDanmaku(data []byte) (*Danmaku, error) {
+	if !gjson.ValidBytes(data) {
+		return nil, fmt.Errorf("%w: invalid json", ErrMalformedDanmaku)
+	}
+	info := gjson.GetBytes(data, "info")
+	switch {
+	case !info.IsArray():
+		return nil, fmt.Errorf("%w: info is not an array", ErrMalformedDanmaku)
+	case !info.Get("0").IsArray():
+		return nil, fmt.Errorf("%w: info.0 is not an array", ErrMalformedDanmaku)
+	case info.Get("1").Type != gjson.String:
+		return nil, fmt.Errorf("%w: content is not a string", ErrMalformedDanmaku)
+	case !info.Get("2").IsArray():
+		return nil, fmt.Errorf("%w: sender is not an array", ErrMalformedDanmaku)
+	case info.Get("2.0").Type != gjson.Number:
+		return nil, fmt.Errorf("%w: sender uid is not a number", ErrMalformedDanmaku)
+	case info.Get("2.1").Type != gjson.String:
+		return nil, fmt.Errorf("%w: sender name is not a string", ErrMalformedDanmaku)
+	}
+	if medal := info.Get("3"); medal.Exists() && !medal.IsArray() {
+		return nil, fmt.Errorf("%w: medal is not an array", ErrMalformedDanmaku)
+	}
+	d := new(Danmaku)
+	d.Parse(data)
+	return d, nil
+}
+
 func (d *Danmaku) Parse(data []byte) {
 	sb := utils.BytesToString(data)
 	parsed := gjson.Parse(sb)
@@ -68,13 +113,15 @@ func (d *Danmaku) Parse(data []byte) {
 	ext := new(Extra)
 	emo := new(Emoticon)
 	//扩展字段
-	err := utils.UnmarshalStr(info.Get("0.15.extra").String(), ext)
-	if err != nil {
-		log.Error("parse danmaku extra failed")
+	if extra := info.Get("0.15.extra").String(); extra != "" {
+		if err := utils.UnmarshalStr(extra, ext); err != nil {
+			log.Error("parse danmaku extra failed")
+		}
 	}
-	err = utils.UnmarshalStr(info.Get("0.13").String(), emo)
-	if err != nil {
-		log.Error("parse danmaku emoticon failed")
+	if emoticon := info.Get("0.13"); emoticon.IsObject() {
+		if err := utils.UnmarshalStr(emoticon.Raw, emo); err != nil {
+			log.Error("parse danmaku emoticon failed")
+		}
 	}
 	i2 := info.Get("2")
 	i3 := info.Get("3")
@@ -100,6 +147,10 @@ func (d *Danmaku) Parse(data []byte) {
 	}
 	d.Extra = ext
 	d.Emoticon = emo
+	d.ID = ext.IdStr
+	if ext.ReplyMid > 0 {
+		d.Reply = &Reply{Uid: ext.ReplyMid, Uname: ext.ReplyUname}
+	}
 	d.Type = int(info.Get("0.12").Int()) //弹幕类型
 	d.Timestamp = info.Get("0.4").Int()  //时间戳
 	d.Raw = sb
@@ -110,7 +161,7 @@ func (d *Danmaku) Parse(data []byte) {
 		dmv2 := new(pb.Dm)
 
 		err := proto.Unmarshal(decoded, dmv2)
-		if err != nil {
+		if err != nil || dmv2.Content == "" {
 			return
 		}
 		d.Content = dmv2.Content
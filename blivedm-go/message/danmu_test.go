@@ -0,0 +1,43 @@
+package message
+
+import (
+	"errors"
+	"testing"
+)
+
+const sampleDanmaku = `{"cmd":"DANMU_MSG","info":[[0,1,25,16777215,1700000000000,0,0,"abc",0,0,0,"",0,"{}","{}",{"mode":0,"extra":"{\"send_from_me\":false,\"content\":\"@主播 你好\",\"id_str\":\"dm123\",\"reply_mid\":42,\"reply_uname\":\"主播\"}"}],"@主播 你好",[1001,"观众",1,0,0,10000,1,""],[21,"粉丝团","主播",12345,398668,"",0,0,0,0,0,0,42],[10,0,9868950,">50000"],["",""],0,3,null,{"ts":1700000000,"ct":"x"},0,0,null,null,0,105]}`
+
+func TestParseDanmaku(t *testing.T) {
+	d, err := ParseDanmaku([]byte(sampleDanmaku))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ID != "dm123" || d.Content != "@主播 你好" {
+		t.Fatalf("unexpected danmaku: %+v", d)
+	}
+	if d.Sender.Uid != 1001 || d.Sender.Uname != "观众" || d.Sender.GuardLevel != 3 {
+		t.Fatalf("unexpected sender: %+v", d.Sender)
+	}
+	if d.Sender.Medal.Level != 21 || d.Sender.Medal.Name != "粉丝团" || d.Sender.Medal.UpUid != 42 {
+		t.Fatalf("unexpected medal: %+v", d.Sender.Medal)
+	}
+	if d.Reply == nil || d.Reply.Uid != 42 || d.Reply.Uname != "主播" {
+		t.Fatalf("unexpected reply: %+v", d.Reply)
+	}
+}
+
+func TestParseDanmakuMalformed(t *testing.T) {
+	cases := []string{
+		`not json`,
+		`{"cmd":"DANMU_MSG"}`,
+		`{"cmd":"DANMU_MSG","info":{}}`,
+		`{"cmd":"DANMU_MSG","info":[[],1,[1,"a"]]}`,
+		`{"cmd":"DANMU_MSG","info":[[],"hi",["1","a"]]}`,
+		`{"cmd":"DANMU_MSG","info":[[],"hi",[1,"a"],{}]}`,
+	}
+	for _, c := range cases {
+		if _, err := ParseDanmaku([]byte(c)); !errors.Is(err, ErrMalformedDanmaku) {
+			t.Errorf("%s: want ErrMalformedDanmaku, got %v", c, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package packet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/andybalholm/brotli"
+)
+
+// HeaderLength 包头长度
+const HeaderLength = 16
+
+const (
+	// MaxPacketLength 单个包的最大长度，超过时视为数据错误
+	MaxPacketLength = 16 << 20
+	// MaxDecompressedLength 一个包解压后（包括嵌套的压缩包）的最大总长度，防止压缩炸弹
+	MaxDecompressedLength = 16 << 20
+	// 压缩包的最大嵌套层数，服务器只会压缩一层
+	maxDepth = 3
+)
+
+var (
+	ErrShortPacket     = errors.New("packet: truncated packet")
+	ErrHeaderLength    = errors.New("packet: invalid header length")
+	ErrPacketLength    = errors.New("packet: invalid packet length")
+	ErrVersion         = errors.New("packet: unknown protocol version")
+	ErrOperation       = errors.New("packet: unknown operation")
+	ErrTooLarge        = errors.New("packet: decompressed data too large")
+	ErrTooDeep         = errors.New("packet: compressed packets nested too deep")
+	ErrCompressedFrame = errors.New("packet: broken compressed body")
+)
+
+// validOperation 协议中定义的操作码
+func validOperation(op uint32) bool {
+	switch op {
+	case HandShake, HandShakeResponse, HeartBeat, HeartBeatResponse, Notification, RoomEnter, RoomEnterResponse:
+		return true
+	}
+	return false
+}
+
+// Decoder 从数据流中逐个读取包，校验包头但不解压
+type Decoder struct {
+	r      io.Reader
+	header [HeaderLength]byte
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Next 读取下一个包，数据流正好结束时返回 io.EOF，包不完整时返回 ErrShortPacket
+func (d *Decoder) Next() (Packet, error) {
+	if _, err := io.ReadFull(d.r, d.header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return Packet{}, ErrShortPacket
+		}
+		return Packet{}, err
+	}
+	h := d.header[:]
+	p := Packet{
+		PacketLength:    int(binary.BigEndian.Uint32(h[0:4])),
+		HeaderLength:    int(binary.BigEndian.Uint16(h[4:6])),
+		ProtocolVersion: binary.BigEndian.Uint16(h[6:8]),
+		Operation:       binary.BigEndian.Uint32(h[8:12]),
+		SequenceID:      int(binary.BigEndian.Uint32(h[12:16])),
+	}
+	if p.HeaderLength < HeaderLength {
+		return Packet{}, fmt.Errorf("%w: %d", ErrHeaderLength, p.HeaderLength)
+	}
+	if p.PacketLength < p.HeaderLength || p.PacketLength > MaxPacketLength {
+		return Packet{}, fmt.Errorf("%w: %d", ErrPacketLength, p.PacketLength)
+	}
+	if p.ProtocolVersion > Brotli {
+		return Packet{}, fmt.Errorf("%w: %d", ErrVersion, p.ProtocolVersion)
+	}
+	if !validOperation(p.Operation) {
+		return Packet{}, fmt.Errorf("%w: %d", ErrOperation, p.Operation)
+	}
+	// 跳过包头中未知的扩展部分
+	if extra := int64(p.HeaderLength - HeaderLength); extra > 0 {
+		if n, err := io.CopyN(io.Discard, d.r, extra); err != nil || n != extra {
+			return Packet{}, ErrShortPacket
+		}
+	}
+	// 长度字段可能是错的，按实际读到的数据分配内存
+	n := int64(p.PacketLength - p.HeaderLength)
+	body, err := io.ReadAll(io.LimitReader(d.r, n))
+	if err != nil {
+		return Packet{}, err
+	}
+	if int64(len(body)) != n {
+		return Packet{}, ErrShortPacket
+	}
+	p.Body = body
+	return p, nil
+}
+
+// Split 将一段数据拆分为多个包，不解压，数据不完整或有错误时返回已拆出的包和错误
+func Split(data []byte) ([]Packet, error) {
+	var packets []Packet
+	d := NewDecoder(bytes.NewReader(data))
+	for {
+		p, err := d.Next()
+		if err == io.EOF {
+			return packets, nil
+		}
+		if err != nil {
+			return packets, err
+		}
+		packets = append(packets, p)
+	}
+}
+
+// Decompress 解压包，返回其中所有未压缩的包；未压缩的包原样返回
+func (p Packet) Decompress() ([]Packet, error) {
+	budget := MaxDecompressedLength
+	return p.decompress(0, &budget)
+}
+
+func (p Packet) decompress(depth int, budget *int) ([]Packet, error) {
+	var r io.Reader
+	switch p.ProtocolVersion {
+	case Plain, Popularity:
+		return []Packet{p}, nil
+	case Zlib:
+		zr, err := zlib.NewReader(bytes.NewReader(p.Body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCompressedFrame, err)
+		}
+		defer zr.Close()
+		r = zr
+	case Brotli:
+		r = brotli.NewReader(bytes.NewReader(p.Body))
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrVersion, p.ProtocolVersion)
+	}
+	if depth >= maxDepth {
+		return nil, ErrTooDeep
+	}
+	data, err := readLimited(r, budget)
+	if err != nil {
+		return nil, err
+	}
+	inner, err := Split(data)
+	var packets []Packet
+	for _, ip := range inner {
+		ps, perr := ip.decompress(depth+1, budget)
+		packets = append(packets, ps...)
+		if perr != nil {
+			return packets, perr
+		}
+	}
+	return packets, err
+}
+
+// readLimited 读取解压后的全部数据，超过剩余额度时返回 ErrTooLarge
+func readLimited(r io.Reader, budget *int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(*budget)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCompressedFrame, err)
+	}
+	if len(data) > *budget {
+		return nil, ErrTooLarge
+	}
+	*budget -= len(data)
+	return data, nil
+}
+
+// DecodeAll 解析一条 websocket 消息，拆分并解压其中所有的包
+// 出错时返回出错前已解析出的包和错误
+func DecodeAll(data []byte) ([]Packet, error) {
+	outer, err := Split(data)
+	var packets []Packet
+	budget := MaxDecompressedLength
+	for _, p := range outer {
+		ps, perr := p.decompress(0, &budget)
+		packets = append(packets, ps...)
+		if perr != nil {
+			return packets, perr
+		}
+	}
+	return packets, err
+}
@@ -0,0 +1,189 @@
+package packet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func zlibBytes(t testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func brotliBytes(t testing.TB, data []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func build(ver uint16, op uint32, body []byte) []byte {
+	p := NewPacket(ver, op, body)
+	return p.Build()
+}
+
+// notifications 两条拼接在一起的弹幕消息
+func notifications() []byte {
+	return append(
+		build(Plain, Notification, []byte(`{"cmd":"DANMU_MSG"}`)),
+		build(Plain, Notification, []byte(`{"cmd":"SEND_GIFT"}`))...,
+	)
+}
+
+func TestDecodeAll(t *testing.T) {
+	inner := notifications()
+	cases := map[string][]byte{
+		"plain":  inner,
+		"zlib":   build(Zlib, Notification, zlibBytes(t, inner)),
+		"brotli": build(Brotli, Notification, brotliBytes(t, inner)),
+		// 服务器不会这样发，但嵌套层数在限制内时应当正常解析
+		"nested": build(Brotli, Notification, brotliBytes(t, build(Zlib, Notification, zlibBytes(t, inner)))),
+	}
+	for name, data := range cases {
+		packets, err := DecodeAll(data)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(packets) != 2 || string(packets[1].Body) != `{"cmd":"SEND_GIFT"}` {
+			t.Fatalf("%s: got %d packets %+v", name, len(packets), packets)
+		}
+		if packets[0].HeaderLength != HeaderLength || packets[0].SequenceID != 1 {
+			t.Fatalf("%s: bad header %+v", name, packets[0])
+		}
+	}
+}
+
+func TestDecodeAllErrors(t *testing.T) {
+	valid := build(Plain, Notification, []byte(`{}`))
+	set16 := func(b []byte, off int, v uint16) []byte {
+		b = append([]byte(nil), b...)
+		binary.BigEndian.PutUint16(b[off:], v)
+		return b
+	}
+	set32 := func(b []byte, off int, v uint32) []byte {
+		b = append([]byte(nil), b...)
+		binary.BigEndian.PutUint32(b[off:], v)
+		return b
+	}
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"truncated header", valid[:10], ErrShortPacket},
+		{"truncated body", valid[:len(valid)-1], ErrShortPacket},
+		{"zero length", set32(valid, 0, 0), ErrPacketLength},
+		{"length shorter than header", set32(valid, 0, 8), ErrPacketLength},
+		{"length too large", set32(valid, 0, MaxPacketLength+1), ErrPacketLength},
+		{"header too short", set16(valid, 4, 4), ErrHeaderLength},
+		{"header beyond packet", set16(valid, 4, 64), ErrPacketLength},
+		{"unknown version", set16(valid, 6, 9), ErrVersion},
+		{"unknown operation", set32(valid, 8, 4), ErrOperation},
+		{"broken zlib", build(Zlib, Notification, []byte("not zlib")), ErrCompressedFrame},
+		{"truncated zlib", build(Zlib, Notification, zlibBytes(t, notifications())[:10]), ErrCompressedFrame},
+	}
+	for _, c := range cases {
+		if _, err := DecodeAll(c.data); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	// 出错前解析出的包仍然返回
+	packets, err := DecodeAll(append(append([]byte(nil), valid...), valid[:5]...))
+	if !errors.Is(err, ErrShortPacket) || len(packets) != 1 {
+		t.Fatalf("partial: got %d packets, %v", len(packets), err)
+	}
+}
+
+func TestDecompressLimits(t *testing.T) {
+	// 压缩炸弹：32MB 的 0 压缩后只有几十 KB
+	bomb := build(Zlib, Notification, zlibBytes(t, make([]byte, 2*MaxDecompressedLength)))
+	if _, err := DecodeAll(bomb); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("zip bomb: got %v", err)
+	}
+
+	data := notifications()
+	for i := 0; i <= maxDepth; i++ {
+		data = build(Zlib, Notification, zlibBytes(t, data))
+	}
+	if _, err := DecodeAll(data); !errors.Is(err, ErrTooDeep) {
+		t.Fatalf("deep nesting: got %v", err)
+	}
+}
+
+func TestBuildRoundTrip(t *testing.T) {
+	p := NewPacket(Plain, RoomEnter, []byte(`{"roomid":1}`))
+	p.SequenceID = 7
+	packets, err := Split(p.Build())
+	if err != nil || len(packets) != 1 {
+		t.Fatalf("got %d packets, %v", len(packets), err)
+	}
+	got := packets[0]
+	if got.Operation != RoomEnter || got.SequenceID != 7 || got.PacketLength != HeaderLength+len(p.Body) || string(got.Body) != string(p.Body) {
+		t.Fatalf("round trip: %+v", got)
+	}
+}
+
+func FuzzDecodeAll(f *testing.F) {
+	inner := notifications()
+	f.Add(inner)
+	f.Add(build(Popularity, HeartBeatResponse, []byte{0, 0, 0, 1}))
+	f.Add(build(Zlib, Notification, zlibBytes(f, inner)))
+	f.Add(build(Brotli, Notification, brotliBytes(f, inner)))
+	f.Add(build(Brotli, Notification, brotliBytes(f, build(Zlib, Notification, zlibBytes(f, inner)))))
+	f.Add(build(Zlib, Notification, zlibBytes(f, inner))[:30])
+	f.Add([]byte{0, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		packets, err := DecodeAll(data)
+		for _, p := range packets {
+			if p.ProtocolVersion != Plain && p.ProtocolVersion != Popularity {
+				t.Fatalf("compressed packet returned: %+v", p)
+			}
+			if !validOperation(p.Operation) {
+				t.Fatalf("invalid operation returned: %+v", p)
+			}
+		}
+		if err == nil && len(data) > 0 && len(packets) == 0 {
+			// 非空数据至少包含一个包，除非是压缩后为空的包
+			if outer, _ := Split(data); len(outer) == 0 {
+				t.Fatalf("no packets and no error for %d bytes", len(data))
+			}
+		}
+	})
+}
+
+func FuzzBuildSplit(f *testing.F) {
+	f.Add(uint16(Plain), uint32(Notification), []byte(`{"cmd":"DANMU_MSG"}`))
+	f.Add(uint16(Popularity), uint32(HeartBeatResponse), []byte{0, 0, 0, 1})
+	f.Add(uint16(Zlib), uint32(Notification), []byte{})
+	f.Fuzz(func(t *testing.T, ver uint16, op uint32, body []byte) {
+		data := build(ver, op, body)
+		packets, err := Split(data)
+		if ver > Brotli || !validOperation(op) {
+			if err == nil {
+				t.Fatalf("invalid header accepted: ver=%d op=%d", ver, op)
+			}
+			return
+		}
+		if err != nil || len(packets) != 1 || !bytes.Equal(packets[0].Body, body) {
+			t.Fatalf("round trip failed: %v %+v", err, packets)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package packet
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ParseProtocol 解析协议名称 plain、zlib、brotli，plain 对应协议版本 1，与网页端发送的包一致
+func ParseProtocol(name string) (uint16, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "plain":
+		return Popularity, nil
+	case "zlib":
+		return Zlib, nil
+	case "brotli":
+		return Brotli, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrVersion, name)
+}
+
+// Compress 按协议版本压缩数据，Plain 和 Popularity 原样返回
+func Compress(version uint16, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch version {
+	case Plain, Popularity:
+		return data, nil
+	case Zlib:
+		w := zlib.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case Brotli:
+		w := brotli.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrVersion, version)
+	}
+	return buf.Bytes(), nil
+}
+
+// Encoder 构造发送给服务器的包，每个连接使用一个，序号从 1 开始递增
+// 版本为 Zlib 或 Brotli 时先构造未压缩的包，压缩后放在对应版本的外层包中，与服务器下发的格式一致
+type Encoder struct {
+	version uint16
+	seq     atomic.Uint32
+}
+
+func NewEncoder(version uint16) *Encoder {
+	return &Encoder{version: version}
+}
+
+// Version 发送时使用的协议版本
+func (e *Encoder) Version() uint16 {
+	return e.version
+}
+
+// Encode 构造一个包，外层包和内层包使用同一个序号
+func (e *Encoder) Encode(operation uint32, body []byte) ([]byte, error) {
+	seq := int(e.seq.Add(1))
+	if e.version != Zlib && e.version != Brotli {
+		p := Packet{ProtocolVersion: e.version, Operation: operation, SequenceID: seq, Body: body}
+		return p.Build(), nil
+	}
+	inner := Packet{ProtocolVersion: Popularity, Operation: operation, SequenceID: seq, Body: body}
+	compressed, err := Compress(e.version, inner.Build())
+	if err != nil {
+		return nil, err
+	}
+	outer := Packet{ProtocolVersion: e.version, Operation: operation, SequenceID: seq, Body: compressed}
+	return outer.Build(), nil
+}
+
+// Enter 构造认证包
+func (e *Encoder) Enter(enter *Enter) ([]byte, error) {
+	m, err := enter.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return e.Encode(RoomEnter, m)
+}
+
+// HeartBeat 构造心跳包
+func (e *Encoder) HeartBeat() ([]byte, error) {
+	return e.Encode(HeartBeat, nil)
+}
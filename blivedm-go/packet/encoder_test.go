@@ -0,0 +1,59 @@
+package packet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncoderRoundTrip(t *testing.T) {
+	body := []byte(`{"roomid":1,"protover":3}`)
+	for _, ver := range []uint16{Plain, Popularity, Zlib, Brotli} {
+		enc := NewEncoder(ver)
+		for seq := 1; seq <= 3; seq++ {
+			data, err := enc.Encode(RoomEnter, body)
+			if err != nil {
+				t.Fatalf("ver=%d: %v", ver, err)
+			}
+			outer, err := Split(data)
+			if err != nil || len(outer) != 1 || outer[0].ProtocolVersion != ver || outer[0].SequenceID != seq {
+				t.Fatalf("ver=%d seq=%d: outer %+v, %v", ver, seq, outer, err)
+			}
+			packets, err := DecodeAll(data)
+			if err != nil || len(packets) != 1 {
+				t.Fatalf("ver=%d: got %d packets, %v", ver, len(packets), err)
+			}
+			p := packets[0]
+			if p.Operation != RoomEnter || p.SequenceID != seq || string(p.Body) != string(body) {
+				t.Fatalf("ver=%d seq=%d: got %+v", ver, seq, p)
+			}
+		}
+	}
+}
+
+func TestEncoderSeparateSequences(t *testing.T) {
+	a, b := NewEncoder(Popularity), NewEncoder(Popularity)
+	_, _ = a.HeartBeat()
+	data, _ := a.HeartBeat()
+	if p, _ := Split(data); p[0].SequenceID != 2 {
+		t.Fatalf("a seq = %d", p[0].SequenceID)
+	}
+	data, _ = b.HeartBeat()
+	if p, _ := Split(data); p[0].SequenceID != 1 || p[0].Operation != HeartBeat {
+		t.Fatalf("b = %+v", p[0])
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	cases := map[string]uint16{"": Popularity, "plain": Popularity, "zlib": Zlib, "Brotli": Brotli}
+	for name, want := range cases {
+		if got, err := ParseProtocol(name); err != nil || got != want {
+			t.Errorf("%q: got %d, %v", name, got, err)
+		}
+	}
+	if _, err := ParseProtocol("gzip"); !errors.Is(err, ErrVersion) {
+		t.Errorf("gzip: got %v", err)
+	}
+	if _, err := Compress(9, nil); !errors.Is(err, ErrVersion) {
+		t.Errorf("Compress(9): got %v", err)
+	}
+}
@@ -16,19 +16,28 @@ type Enter struct {
 	Key      string `json:"key"`
 }
 
-// NewEnterPacket 构造进入房间的包
+// NewEnter 构造认证包的内容，protover 为希望服务器下发消息使用的协议版本
 // uid 可以为 0, key 在使用 broadcastlv 服务器的时候不需要
-func NewEnterPacket(uid int, buvid string, roomID int, key string) []byte {
-	ent := &Enter{
+func NewEnter(uid int, buvid string, roomID int, key string, protover uint16) *Enter {
+	return &Enter{
 		UID:      uid,
 		Buvid:    buvid,
 		RoomID:   roomID,
-		ProtoVer: 3,
+		ProtoVer: int(protover),
 		Platform: "danmuji",
 		Type:     2,
 		Key:      key,
 	}
-	m, err := json.Marshal(ent)
+}
+
+func (e *Enter) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// NewEnterPacket 构造进入房间的包，使用 brotli 协议
+// uid 可以为 0, key 在使用 broadcastlv 服务器的时候不需要
+func NewEnterPacket(uid int, buvid string, roomID int, key string) []byte {
+	m, err := NewEnter(uid, buvid, roomID, key, Brotli).Marshal()
 	if err != nil {
 		log.Error("NewEnterPacket JsonMarshal failed", err)
 	}
@@ -1,14 +1,8 @@
 package packet
 
 import (
-	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	"encoding/json"
-	"io"
-
-	"github.com/andybalholm/brotli"
-	log "github.com/zeromicro/go-zero/core/logx"
 )
 
 const (
@@ -32,7 +26,7 @@ const (
 
 type Packet struct {
 	PacketLength    int // PacketLength 在 build 时会计算
-	HeaderLength    int // HeaderLength 大概是固定值 16
+	HeaderLength    int // HeaderLength 解析时读取，build 时固定为 16
 	ProtocolVersion uint16
 	Operation       uint32
 	SequenceID      int
@@ -53,48 +47,23 @@ func NewPlainPacket(operation int, body []byte) Packet {
 	return NewPacket(1, uint32(operation), body)
 }
 
+// NewPacketFromBytes 解析一个完整的包，数据有误时返回空包
+//
+// Deprecated: 使用 Split 或 DecodeAll，可以得到具体的错误
 func NewPacketFromBytes(data []byte) Packet {
-	if len(data) == 0 {
-		log.Error("error packet")
-		return Packet{ProtocolVersion: 1, Operation: uint32(3), Body: make([]byte, 0)}
+	packets, err := Split(data)
+	if err != nil || len(packets) != 1 {
+		return Packet{}
 	}
-
-	packLen := binary.BigEndian.Uint32(data[0:4])
-
-	if int(packLen) == 0 || int(packLen) != len(data) {
-		log.Error("error packet")
-		return Packet{ProtocolVersion: 1, Operation: uint32(3), Body: make([]byte, 0)}
-	}
-
-	pv := binary.BigEndian.Uint16(data[6:8])
-	op := binary.BigEndian.Uint32(data[8:12])
-	body := data[16:packLen]
-	packet := NewPacket(pv, op, body)
-	return packet
+	return packets[0]
 }
 
+// Parse 解压包，出错时只返回出错前解析出的包
+//
+// Deprecated: 使用 Decompress
 func (p Packet) Parse() []Packet {
-	switch p.ProtocolVersion {
-	case Popularity:
-		fallthrough
-	case Plain:
-		return []Packet{p}
-	case Zlib:
-		z, err := zlibParser(p.Body)
-		if err != nil {
-			log.Error("zlib error", err)
-		}
-		return Slice(z)
-	case Brotli:
-		b, err := brotliParser(p.Body)
-		if err != nil {
-			log.Error("brotli error", err)
-		}
-		return Slice(b)
-	default:
-		log.Error("unknown protocolVersion")
-	}
-	return nil
+	packets, _ := p.Decompress()
+	return packets
 }
 
 func (p *Packet) Unmarshal(v interface{}) error {
@@ -102,21 +71,17 @@ func (p *Packet) Unmarshal(v interface{}) error {
 }
 
 func (p *Packet) Build() []byte {
-	// default packet with some constants
-	// raw header length: buf[5] = 16
-	// seq: buf[16] = 1
-	rawBuf := []byte{0, 0, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}
-
-	// protocol version
+	rawBuf := make([]byte, HeaderLength, HeaderLength+len(p.Body))
+	binary.BigEndian.PutUint16(rawBuf[4:], HeaderLength)
 	binary.BigEndian.PutUint16(rawBuf[6:], p.ProtocolVersion)
-
-	// operation code
 	binary.BigEndian.PutUint32(rawBuf[8:], p.Operation)
-
-	// append payload
+	// 未指定时序号为 1
+	seq := p.SequenceID
+	if seq == 0 {
+		seq = 1
+	}
+	binary.BigEndian.PutUint32(rawBuf[12:], uint32(seq))
 	rawBuf = append(rawBuf, p.Body...)
-
-	// payload length
 	binary.BigEndian.PutUint32(rawBuf, uint32(len(rawBuf)))
 	return rawBuf
 }
@@ -131,33 +96,10 @@ func EncodePacket(packet Packet) []byte {
 	return packet.Build()
 }
 
+// Slice 拆分多个包，出错时只返回出错前拆出的包
+//
+// Deprecated: 使用 Split
 func Slice(data []byte) []Packet {
-	var packets []Packet
-	total := len(data)
-	cursor := 0
-	for cursor < total {
-		packLen := int(binary.BigEndian.Uint32(data[cursor : cursor+4]))
-		packets = append(packets, DecodePacket(data[cursor:cursor+packLen]))
-		cursor += packLen
-	}
+	packets, _ := Split(data)
 	return packets
 }
-
-func zlibParser(b []byte) ([]byte, error) {
-	var rdBuf []byte
-	zr, err := zlib.NewReader(bytes.NewReader(b))
-	if err != nil {
-		return nil, err
-	}
-	rdBuf, err = io.ReadAll(zr)
-	return rdBuf, nil
-}
-
-func brotliParser(b []byte) ([]byte, error) {
-	zr := brotli.NewReader(bytes.NewReader(b))
-	rdBuf, err := io.ReadAll(zr)
-	if err != nil {
-		return nil, err
-	}
-	return rdBuf, nil
-}
@@ -0,0 +1,29 @@
+package packet
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// ParseHeartBeatResponse 解析心跳回复，返回人气值
+func ParseHeartBeatResponse(body []byte) (int, error) {
+	if len(body) < 4 {
+		return 0, errors.New("heartbeat response too short")
+	}
+	return int(binary.BigEndian.Uint32(body[:4])), nil
+}
+
+// ParseEnterResponse 解析认证回复，code 不为 0 表示认证被拒绝
+func ParseEnterResponse(body []byte) (int, error) {
+	var r struct {
+		Code *int `json:"code"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return 0, err
+	}
+	if r.Code == nil {
+		return 0, errors.New("enter response without code")
+	}
+	return *r.Code, nil
+}
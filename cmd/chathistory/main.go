@@ -0,0 +1,92 @@
+// chathistory 导出、导入机器人的对话记录
+//
+//	chathistory -room 123 export > room_123.json
+//	chathistory import db/history/room_123.json db/history/room_123_users.json
+//
+// 导入时没有指定 -room 则从文件名 room_<直播间号> 中读取直播间号
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+var roomFile = regexp.MustCompile(`^room_(\d+)`)
+
+// errUsage 参数错误，已经打印用法
+var errUsage = errors.New("usage")
+
+func main() {
+	var c config.Config
+	flag.StringVar(&c.DBPath, "dbpath", "./db", "数据库目录")
+	flag.StringVar(&c.DBName, "dbname", "sqliteDataBase.db", "数据库文件名")
+	room := flag.Int64("room", 0, "直播间号")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "用法：%s [选项] export | import 文件...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(c, *room); err != nil {
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// run 执行命令，返回后数据库已经关闭
+func run(c config.Config, room int64) error {
+	switch flag.Arg(0) {
+	case "export", "import":
+	default:
+		flag.Usage()
+		return errUsage
+	}
+	if flag.Arg(0) == "import" && flag.NArg() < 2 {
+		flag.Usage()
+		return errUsage
+	}
+	if flag.Arg(0) == "export" && room == 0 {
+		return fmt.Errorf("导出时需要指定 -room")
+	}
+
+	db, err := svc.OpenDB(c)
+	if err != nil {
+		return err
+	}
+	defer svc.CloseDB(db)
+	ctx := context.Background()
+
+	if flag.Arg(0) == "export" {
+		return http.ExportChatHistory(ctx, model.NewChatHistoryModel(db, room), os.Stdout)
+	}
+	for _, file := range flag.Args()[1:] {
+		id := room
+		if id == 0 {
+			m := roomFile.FindStringSubmatch(filepath.Base(file))
+			if m == nil {
+				return fmt.Errorf("%s：无法从文件名读取直播间号，请指定 -room", file)
+			}
+			id, _ = strconv.ParseInt(m[1], 10, 64)
+		}
+		n, err := http.ImportChatHistoryFile(ctx, model.NewChatHistoryModel(db, id), file)
+		if err != nil {
+			return fmt.Errorf("%s：%w", file, err)
+		}
+		fmt.Printf("%s：导入直播间 %d 的对话记录 %d 条\n", file, id, n)
+	}
+	return nil
+}
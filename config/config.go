@@ -6,45 +6,90 @@ import (
 
 type Config struct {
 	//rest.RestConf
-	Log logx.LogConf
+	Log logx.LogConf `reload:"restart"`
 
 	// 核心设置
-	RoomId      int    `json:",default=4699397"`
-	WsServerUrl string `json:",default=wss://broadcastlv.chat.bilibili.com:2245/sub"`
+	RoomId         int          `json:",default=4699397" reload:"connection"`
+	WsServerUrl    string       `json:",default=wss://broadcastlv.chat.bilibili.com:2245/sub" reload:"connection"`
+	Rooms          []RoomConfig `json:",optional"`                                                     // 同时接管的直播间列表，为空时只接管 RoomId
+	BiliAPIBase    string       `json:",optional" reload:"connection"`                                 // B站接口地址，为空时使用官方接口，用于本地测试或代理
+	WsProtocol     string       `json:",default=brotli,options=plain|zlib|brotli" reload:"connection"` // 弹幕服务器下发消息的压缩方式
+	WsSendProtocol string       `json:",default=plain,options=plain|zlib|brotli" reload:"connection"`  // 发送认证包和心跳包的压缩方式，网页端为 plain
 
 	// 常规设置
-	DanmuLen     int    `json:",default=20"`    // 弹幕限制长度
-	EntryMsg     string `json:",default=off"`   // 进房间自动发送的文本
-	PKNotice     bool   `json:",default=true"`  // PK信息开关
-	ShowBlockMsg bool   `json:",default=false"` // 禁言提醒开关
-	GoodbyeInfo  string `json:",optional"`      // 下播自动发送的话
+	DanmuLen     int    `json:",default=20"`                   // 弹幕限制长度
+	EntryMsg     string `json:",default=off"`                  // 进房间自动发送的文本
+	PKNotice     bool   `json:",default=true"`                 // PK信息开关
+	ShowBlockMsg bool   `json:",default=false"`                // 禁言提醒开关
+	GoodbyeInfo  string `json:",optional"`                     // 下播自动发送的话
+	RecordDir    string `json:",optional" reload:"connection"` // 录制弹幕消息的目录，用于离线回放，为空时不录制
+	ConfigWatch  int    `json:",default=5" reload:"restart"`   // 检查配置文件变化的间隔(秒)，变化后自动重载，0 为不检查，修改后重新启动生效
+
+	// 弹幕发送限速
+	DanmuRate     float64 `json:",default=1" reload:"pipeline"` // 每秒最多发送的弹幕条数
+	DanmuBurst    int     `json:",default=2" reload:"pipeline"` // 允许连续发送的弹幕条数
+	DanmuMaxRetry int     `json:",default=2"`                   // 弹幕发送失败的最大重试次数
+
+	// 事件处理
+	EventWorkers   int `json:",default=8" reload:"connection,pipeline"`   // 处理事件的协程数，同一用户的事件由同一协程按顺序处理
+	EventQueueSize int `json:",default=256" reload:"connection,pipeline"` // 每个协程的队列长度，过载时丢弃进场等低价值事件
+
+	// 弹幕合并去重
+	DanmuMergeWindow  int `json:",default=3"`  // 合并窗口(秒)，同模板的第一条立即发送，之后窗口内的欢迎、感谢合并为一条，最多延迟一个窗口，0 为不合并
+	DanmuRepeatWindow int `json:",default=10"` // 相同内容在多少秒内再次发送时自动加上变化，0 为不处理
 
 	// 关键字回复
 	KeywordReply     bool              `json:",default=false"` //关键词回复开关
 	KeywordReplyList map[string]string `json:",optional"`      // 关键词回复列表
 
 	// AI聊天相关
-	TalkRobotCmd  string   `json:",default=test"`                                // 机器人聊天关键字
-	FuzzyMatchCmd bool     `json:",default=false"`                               // 模糊匹配关键字
-	RobotName     string   `json:",default=花花"`                                  // 机器人名称
-	RobotMode     string   `json:",default=DeepSeek,options=QingYunKe|ChatGPT|DeepSeek"` // 机器人服务
-	ChatGPT       struct { // GPT的配置
+	TalkRobotCmd      string   `json:",default=test"`           // 机器人聊天关键字
+	FuzzyMatchCmd     bool     `json:",default=false"`          // 模糊匹配关键字
+	RobotName         string   `json:",default=花花"`             // 机器人名称
+	RobotMode         string   `json:",default=DeepSeek"`       // 机器人服务，不区分大小写，可选值见 RobotModes
+	RobotFallback     []string `json:",optional"`               // 机器人服务失败时依次尝试的服务，如 [ChatGPT, QingYunKe]
+	RobotTimeout      int      `json:",default=20"`             // 每个机器人服务的超时(秒)
+	RobotStream       bool     `json:",default=true"`           // 流式回复，收到完整的一句就先发送
+	RobotTools        bool     `json:",default=true"`           // 机器人可以查询提问用户的签到、弹幕、盲盒数据以及 PK 对手和直播间信息
+	RobotFailMsg      string   `json:",default=不好意思，机器人坏掉了..."` // 所有机器人服务都失败时的回复，为空时不回复
+	RobotMemoryTokens int      `json:",default=1000"`           // 每个用户对话记忆的 token 预算(估算)，超出时忘记最早的对话，0 为不记忆
+	RobotMemoryTTL    int      `json:",default=30"`             // 用户超过多少分钟没有和机器人聊天时忘记之前的对话
+	RobotHistoryDays  int      `json:",default=30"`             // 对话记录在数据库中保留的天数，0 为永久保留
+	RobotHistoryUser  int      `json:",default=200"`            // 每个用户在数据库中最多保留的对话记录条数，0 为不限制
+	ChatGPT           struct { // GPT的配置
 		APIUrl   string `json:",default=https://api.openai.com/v1"`
-		APIToken string `json:",optional"`
+		APIToken string `json:",optional"` // 已弃用，启动时迁移到凭据库，凭据库中已有令牌时以凭据库为准
 		Prompt   string `json:",default=你是一个非常幽默的机器人助理，可以使用emoji表情符号，可以使用颜文字"`
 		Limit    bool   `json:",default=true"`
 		Model    string `json:",default=gpt-3.5-turbo"`
+		Timeout  int    `json:",optional"` // 超时(秒)，为 0 时使用 RobotTimeout
 	}
 	DeepSeek struct { // DeepSeek的配置
 		APIUrl             string   `json:",default=https://api.deepseek.com/v1"`
-		APIToken           string   `json:",optional"`
+		APIToken           string   `json:",optional"` // 已弃用，启动时迁移到凭据库，凭据库中已有令牌时以凭据库为准
 		Prompt             string   `json:",default=你是一个非常幽默的机器人助理，可以使用emoji表情符号，可以使用颜文字"`
 		Limit              bool     `json:",default=true"`
 		Model              string   `json:",default=deepseek-chat"`
-		MaxHistoryMessages int      `json:",default=100"`                             // 最大历史记录消息数
+		MaxHistoryMessages int      `json:",default=100"`                             // 已不再使用，对话记忆的长度由 RobotMemoryTokens 限制
+		Timeout            int      `json:",optional"`                                // 超时(秒)，为 0 时使用 RobotTimeout
 		BlockedWords       []string `json:",default=["色情", "政治", "暴力", "涉政", "希特勒"]"` // 屏蔽词列表
 	}
 
+	RobotFilter struct { // 机器人回复的安全过滤，处理方式可选 reject 拒绝整条回复、rewrite 替换为 Replacement、mask 替换为 *、off 不检查
+		BlockedWords    []string `json:",optional"`            // 屏蔽词，与 DeepSeek.BlockedWords 一起检查
+		Patterns        []string `json:",optional"`            // 屏蔽的正则表达式，与屏蔽词使用相同的处理方式
+		BlockedAction   string   `json:",default=reject"`      // 命中屏蔽词或正则时的处理方式
+		SensitiveWords  bool     `json:",default=true"`        // 检查内置的B站敏感词表
+		SensitiveFile   string   `json:",optional"`            // 额外的敏感词表文件，每行一个词
+		SensitiveAction string   `json:",default=mask"`        // 命中敏感词时的处理方式
+		URLAction       string   `json:",default=rewrite"`     // 回复中包含网址时的处理方式
+		PhoneAction     string   `json:",default=rewrite"`     // 回复中包含手机号时的处理方式
+		Replacement     string   `json:",optional"`            // rewrite 替换成的文字，为空时删除
+		MaxLen          int      `json:",default=100"`         // 一次回复最多发送的字数，0 为不限制
+		MaxEmoji        int      `json:",default=3"`           // 一次回复最多保留的 emoji 数量，0 为不限制，-1 为全部删除
+		SafeReply       string   `json:",default=这个话题我们换一个吧~"` // 回复被拒绝时的安全回复，为空时不回复
+	}
+
 	// 欢迎配置
 	InteractWord       bool       `json:",default=false"`         // 欢迎弹幕开关
 	WelcomeUseAt       bool       `json:",default=false"`         // 使用@模式欢迎
@@ -70,17 +115,17 @@ type Config struct {
 	WelcomeBlacklist        []string          `json:",optional"`      // 不欢迎黑名单精确匹配
 
 	// 答谢设置
-	ThanksGift             bool `json:",default=false"` // 感谢送礼
-	ThanksGiftTimeout      int  `json:",default=3"`     // 礼物统计时间
-	ThanksBlindBoxTimeout  int  `json:",default=6"`     // 盲盒统计时间
-	ThanksMinCost          int  `json:",default=0"`     // 最小感谢礼物价值
-	BlindBoxProfitLossStat bool `json:",default=true"`  // 盲盒盈亏统计
-	ThanksGiftUseAt        bool `json:",default=false"` // 使用@模式感谢
+	ThanksGift             bool `json:",default=false"`               // 感谢送礼
+	ThanksGiftTimeout      int  `json:",default=3" reload:"pipeline"` // 礼物统计时间
+	ThanksBlindBoxTimeout  int  `json:",default=6"`                   // 盲盒统计时间
+	ThanksMinCost          int  `json:",default=0"`                   // 最小感谢礼物价值
+	BlindBoxProfitLossStat bool `json:",default=true"`                // 盲盒盈亏统计
+	ThanksGiftUseAt        bool `json:",default=false"`               // 使用@模式感谢
 
 	// 定时弹幕配置
-	CronDanmu bool `json:",default=false"` // 定时弹幕开关
+	CronDanmu bool `json:",default=false" reload:"pipeline"` // 定时弹幕开关
 	// CronSupportSec bool `json:",default=false"`
-	CronDanmuList []CronDanmuList `json:",optional"` // 定时弹幕列表
+	CronDanmuList []CronDanmuList `json:",optional" reload:"pipeline"` // 定时弹幕列表
 
 	// 抽签设置
 	// 抽签开关
@@ -94,8 +139,8 @@ type Config struct {
 	DanmuCntEnable bool `json:",default=false"` // 弹幕统计提醒功能
 	// 盲盒统计
 	BlindBoxStat bool   `json:",default=true"` // 盲盒统计开关(只影响是否输出结果, 不影响记录)
-	DBPath       string `json:",default=./db"`
-	DBName       string `json:",default=sqliteDataBase.db"`
+	DBPath       string `json:",default=./db" reload:"restart"`
+	DBName       string `json:",default=sqliteDataBase.db" reload:"restart"`
 
 	// 杂项设置 GUI无界面配置
 	CustomizeBullet bool `json:",default=false"` // 手动弹幕发送(命令行)	GUI不要有选项
@@ -104,8 +149,12 @@ type Config struct {
 	LotteryEnable bool   `json:",default=true"` // 抽奖开关
 	LotteryUrl    string `json:",optional"`     // 抽奖地址
 }
+type RoomConfig struct {
+	RoomId   int                    `json:",optional"` // 直播间号
+	Override map[string]interface{} `json:",optional"` // 覆盖全局配置的字段，键为配置项名称
+}
 type CronDanmuList struct {
 	Cron   string   `json:",optional"`      // 定时表达式
 	Random bool     `json:",default=false"` // 是否随机发送
 	Danmu  []string `json:",optional"`
-}
\ No newline at end of file
+}
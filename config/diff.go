@@ -0,0 +1,119 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Reload 配置项变化后需要执行的操作，没有标记的配置项替换后直接生效
+// 在字段上用 reload 标签标记，如 `reload:"connection"`，多个操作用逗号分隔
+type Reload uint8
+
+const (
+	ReloadPipeline   Reload = 1 << iota // 重启处理逻辑和定时弹幕
+	ReloadConnection                    // 重建弹幕连接
+	ReloadRestart                       // 只在启动时读取，重载时保留之前的值，需要重新启动才能生效
+)
+
+func (r Reload) String() string {
+	var parts []string
+	if r&ReloadPipeline != 0 {
+		parts = append(parts, "pipeline")
+	}
+	if r&ReloadConnection != 0 {
+		parts = append(parts, "connection")
+	}
+	if r&ReloadRestart != 0 {
+		parts = append(parts, "restart")
+	}
+	if len(parts) == 0 {
+		return "hot"
+	}
+	return strings.Join(parts, "|")
+}
+
+// Change 一个发生变化的配置项
+type Change struct {
+	Field  string
+	Reload Reload
+}
+
+// Diff 新旧配置之间发生变化的配置项，按字段定义的顺序排列
+type Diff []Change
+
+// Reload 所有变化需要执行的操作
+func (d Diff) Reload() Reload {
+	var r Reload
+	for _, c := range d {
+		r |= c.Reload
+	}
+	return r
+}
+
+// Fields 发生变化的配置项名称
+func (d Diff) Fields() []string {
+	fields := make([]string, len(d))
+	for i, c := range d {
+		fields[i] = c.Field
+	}
+	return fields
+}
+
+func (d Diff) String() string {
+	parts := make([]string, len(d))
+	for i, c := range d {
+		parts[i] = c.Field + "(" + c.Reload.String() + ")"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// reloadOf 解析字段的 reload 标签
+func reloadOf(f reflect.StructField) Reload {
+	var r Reload
+	for _, v := range strings.Split(f.Tag.Get("reload"), ",") {
+		switch strings.TrimSpace(v) {
+		case "pipeline":
+			r |= ReloadPipeline
+		case "connection":
+			r |= ReloadConnection
+		case "restart":
+			r |= ReloadRestart
+		}
+	}
+	return r
+}
+
+// Compare 逐个对比配置项，返回发生变化的配置项
+func Compare(old, new *Config) Diff {
+	var d Diff
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			d = append(d, Change{Field: f.Name, Reload: reloadOf(f)})
+		}
+	}
+	return d
+}
+
+// RetainRestart 将 new 中标记为 restart 且发生变化的配置项恢复为 old 的值，返回这些配置项
+func RetainRestart(old, new *Config) []string {
+	var kept []string
+	ov, nv := reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem()
+	t := ov.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || reloadOf(f)&ReloadRestart == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(ov.Field(i).Interface(), nv.Field(i).Interface()) {
+			nv.Field(i).Set(ov.Field(i))
+			kept = append(kept, f.Name)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	old := Config{RoomId: 1, WelcomeDanmu: []string{"欢迎 {user} ~"}, CronDanmuList: []CronDanmuList{{Cron: "0 * * * *"}}}
+	if d := Compare(&old, &old); len(d) != 0 {
+		t.Fatalf("same config: %v", d)
+	}
+
+	c := old
+	c.WelcomeDanmu = []string{"来了 {user}"}
+	c.DanmuMaxRetry = 3
+	d := Compare(&old, &c)
+	if strings.Join(d.Fields(), ",") != "DanmuMaxRetry,WelcomeDanmu" || d.Reload() != 0 {
+		t.Fatalf("hot: %v", d)
+	}
+
+	// 限速在发送循环启动时读取
+	c.DanmuRate = 2
+	c.CronDanmuList = []CronDanmuList{{Cron: "30 * * * *"}}
+	if d = Compare(&old, &c); d.Reload() != ReloadPipeline {
+		t.Fatalf("pipeline: %v", d)
+	}
+
+	c.RoomId = 2
+	c.EventWorkers = 4
+	d = Compare(&old, &c)
+	if d.Reload() != ReloadPipeline|ReloadConnection {
+		t.Fatalf("connection: %v", d)
+	}
+	if got := d.String(); !strings.Contains(got, "RoomId(connection)") || !strings.Contains(got, "EventWorkers(pipeline|connection)") {
+		t.Fatalf("String() = %s", got)
+	}
+}
+
+func TestRetainRestart(t *testing.T) {
+	old := Config{RoomId: 1, DBPath: "./db", ConfigWatch: 5}
+	c := old
+	c.DBPath = "./other"
+	c.ConfigWatch = 0
+	c.Log.Level = "error"
+	c.WelcomeDanmu = []string{"欢迎"}
+	kept := RetainRestart(&old, &c)
+	if strings.Join(kept, ",") != "Log,ConfigWatch,DBPath" {
+		t.Fatalf("kept = %v", kept)
+	}
+	if d := Compare(&old, &c); strings.Join(d.Fields(), ",") != "WelcomeDanmu" {
+		t.Fatalf("diff after retain = %v", d)
+	}
+}
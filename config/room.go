@@ -0,0 +1,52 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// RoomList 返回需要接管的直播间列表，未配置 Rooms 时退化为单个 RoomId
+func (c Config) RoomList() []RoomConfig {
+	if len(c.Rooms) > 0 {
+		return c.Rooms
+	}
+	return []RoomConfig{{RoomId: c.RoomId}}
+}
+
+// ForRoom 以全局配置为基础，叠加房间自己的覆盖项，得到该房间实际使用的配置
+func (c Config) ForRoom(room RoomConfig) (Config, error) {
+	base := c
+	base.Rooms = nil
+	if len(room.Override) > 0 {
+		data, err := json.Marshal(base)
+		if err != nil {
+			return c, err
+		}
+		merged := make(map[string]interface{})
+		if err = json.Unmarshal(data, &merged); err != nil {
+			return c, err
+		}
+		for k, v := range room.Override {
+			// 配置文件中的键不区分大小写，这里统一换成字段名
+			for field := range merged {
+				if strings.EqualFold(field, k) {
+					k = field
+					break
+				}
+			}
+			merged[k] = v
+		}
+		if data, err = json.Marshal(merged); err != nil {
+			return c, err
+		}
+		var out Config
+		if err = json.Unmarshal(data, &out); err != nil {
+			return c, err
+		}
+		base = out
+	}
+	if room.RoomId > 0 {
+		base.RoomId = room.RoomId
+	}
+	return base, nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import "testing"
+
+func TestForRoomOverride(t *testing.T) {
+	c := Config{RoomId: 1, DanmuLen: 20, WelcomeDanmu: []string{"欢迎 {user} ~"}, InteractWord: true}
+	c.Rooms = []RoomConfig{
+		{RoomId: 2},
+		{RoomId: 3, Override: map[string]interface{}{"danmulen": 30, "WelcomeDanmu": []interface{}{"来了 {user}"}}},
+	}
+
+	rooms := c.RoomList()
+	if len(rooms) != 2 {
+		t.Fatalf("want 2 rooms, got %d", len(rooms))
+	}
+
+	r2, err := c.ForRoom(rooms[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r2.RoomId != 2 || r2.DanmuLen != 20 || !r2.InteractWord || r2.Rooms != nil {
+		t.Fatalf("unexpected config for room 2: %+v", r2)
+	}
+
+	r3, err := c.ForRoom(rooms[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r3.RoomId != 3 || r3.DanmuLen != 30 || len(r3.WelcomeDanmu) != 1 || r3.WelcomeDanmu[0] != "来了 {user}" {
+		t.Fatalf("override not applied: %+v", r3)
+	}
+	if c.DanmuLen != 20 || c.WelcomeDanmu[0] != "欢迎 {user} ~" {
+		t.Fatal("base config modified")
+	}
+}
+
+func TestRoomListFallback(t *testing.T) {
+	c := Config{RoomId: 42}
+	rooms := c.RoomList()
+	if len(rooms) != 1 || rooms[0].RoomId != 42 {
+		t.Fatalf("unexpected rooms: %+v", rooms)
+	}
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+	"github.com/zeromicro/go-zero/core/conf"
+)
+
+const (
+	MinDanmuLen = 1
+	MaxDanmuLen = 100 // B站弹幕长度上限为 40，留出余量
+)
+
+var (
+	robotModesMu sync.RWMutex
+	robotModes   = map[string]string{"qingyunke": "QingYunKe", "chatgpt": "ChatGPT", "deepseek": "DeepSeek"}
+)
+
+// RegisterRobotMode 登记可用的机器人服务名称，名称不区分大小写；注册聊天服务时自动调用
+func RegisterRobotMode(name string) {
+	robotModesMu.Lock()
+	defer robotModesMu.Unlock()
+	robotModes[strings.ToLower(name)] = name
+}
+
+// RobotModes 支持的机器人服务
+func RobotModes() []string {
+	robotModesMu.RLock()
+	defer robotModesMu.RUnlock()
+	names := make([]string, 0, len(robotModes))
+	for _, name := range robotModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 机器人回复过滤的处理方式
+const (
+	FilterOff     = "off"     // 不检查
+	FilterReject  = "reject"  // 拒绝整条回复，改为安全回复
+	FilterRewrite = "rewrite" // 替换为 Replacement
+	FilterMask    = "mask"    // 每个字替换为 *
+)
+
+// FilterActions 支持的回复过滤处理方式
+var FilterActions = []string{FilterOff, FilterReject, FilterRewrite, FilterMask}
+
+// CronParser 定时弹幕表达式的解析器，秒可以省略
+var CronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow,
+)
+
+// FieldError 一个配置项的校验错误
+type FieldError struct {
+	Field   string // 配置项，如 CronDanmuList[1].Cron
+	Value   any    // 错误的值
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s = %v: %s", e.Field, e.Value, e.Message)
+}
+
+// ValidationError 配置校验失败，包含所有错误的配置项
+type ValidationError struct {
+	RoomID int // 直播间的覆盖配置出错时为直播间号，全局配置为 0
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Error()
+	}
+	prefix := "配置校验失败"
+	if e.RoomID != 0 {
+		prefix = fmt.Sprintf("直播间 %d 配置校验失败", e.RoomID)
+	}
+	return prefix + "：" + strings.Join(parts, "; ")
+}
+
+// Validate 校验配置，所有配置项都检查完后返回 *ValidationError，没有错误时返回 nil
+func (c *Config) Validate() error {
+	var errs []FieldError
+	add := func(field string, value any, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Value: value, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.RoomId <= 0 {
+		add("RoomId", c.RoomId, "直播间号必须大于 0")
+	}
+	for i, room := range c.Rooms {
+		if room.RoomId <= 0 {
+			add(fmt.Sprintf("Rooms[%d].RoomId", i), room.RoomId, "直播间号必须大于 0")
+		}
+	}
+	if c.DanmuLen < MinDanmuLen || c.DanmuLen > MaxDanmuLen {
+		add("DanmuLen", c.DanmuLen, "弹幕长度必须在 %d 到 %d 之间", MinDanmuLen, MaxDanmuLen)
+	}
+	if c.DanmuRate <= 0 {
+		add("DanmuRate", c.DanmuRate, "每秒发送条数必须大于 0")
+	}
+	if c.EventWorkers < 0 || c.EventQueueSize < 0 {
+		add("EventWorkers", c.EventWorkers, "协程数和队列长度不能为负数")
+	}
+
+	if !validRobotMode(c.RobotMode) {
+		add("RobotMode", c.RobotMode, "可选值为 %s", strings.Join(RobotModes(), "、"))
+	}
+	for i, m := range c.RobotFallback {
+		if !validRobotMode(m) {
+			add(fmt.Sprintf("RobotFallback[%d]", i), m, "可选值为 %s", strings.Join(RobotModes(), "、"))
+		}
+	}
+	if c.RobotTimeout <= 0 {
+		add("RobotTimeout", c.RobotTimeout, "机器人超时必须大于 0")
+	}
+	if c.RobotMemoryTokens < 0 || c.RobotMemoryTTL < 0 {
+		add("RobotMemoryTokens", c.RobotMemoryTokens, "对话记忆的预算和保留时间不能为负数")
+	}
+	if c.RobotHistoryDays < 0 || c.RobotHistoryUser < 0 {
+		add("RobotHistoryDays", c.RobotHistoryDays, "对话记录的保留天数和条数不能为负数")
+	}
+	f := c.RobotFilter
+	for _, a := range []struct{ field, action string }{
+		{"RobotFilter.BlockedAction", f.BlockedAction},
+		{"RobotFilter.SensitiveAction", f.SensitiveAction},
+		{"RobotFilter.URLAction", f.URLAction},
+		{"RobotFilter.PhoneAction", f.PhoneAction},
+	} {
+		if a.action != "" && !validFilterAction(a.action) {
+			add(a.field, a.action, "可选值为 %s", strings.Join(FilterActions, "、"))
+		}
+	}
+	for i, p := range f.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			add(fmt.Sprintf("RobotFilter.Patterns[%d]", i), p, "正则表达式错误：%v", err)
+		}
+	}
+	if f.MaxLen < 0 {
+		add("RobotFilter.MaxLen", f.MaxLen, "回复长度不能为负数")
+	}
+	if f.MaxEmoji < -1 {
+		add("RobotFilter.MaxEmoji", f.MaxEmoji, "emoji 数量不能小于 -1")
+	}
+
+	if c.InteractWord && !hasText(c.WelcomeDanmu) {
+		add("WelcomeDanmu", c.WelcomeDanmu, "开启欢迎弹幕时欢迎语不能为空")
+	}
+	if c.InteractWordByTime {
+		for i, w := range c.WelcomeDanmuByTime {
+			if w.Enabled && !hasText(w.Danmu) {
+				add(fmt.Sprintf("WelcomeDanmuByTime[%d].Danmu", i), w.Danmu, "启用的时间段欢迎语不能为空")
+			}
+		}
+	}
+	// 不使用@模式时感谢语为空会使用默认的感谢语，@模式下必须配置
+	if (c.ThanksFocus || c.ThanksShare) && c.WelcomeUseAt && !hasText(c.FocusDanmu) {
+		add("FocusDanmu", c.FocusDanmu, "使用@模式感谢关注、分享时感谢语不能为空")
+	}
+
+	for i, d := range c.CronDanmuList {
+		if _, err := CronParser.Parse(d.Cron); err != nil {
+			add(fmt.Sprintf("CronDanmuList[%d].Cron", i), d.Cron, "定时表达式错误：%v", err)
+		}
+		if c.CronDanmu && !hasText(d.Danmu) {
+			add(fmt.Sprintf("CronDanmuList[%d].Danmu", i), d.Danmu, "定时弹幕内容不能为空")
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: errs}
+}
+
+// ValidateRooms 校验全局配置和每个直播间叠加覆盖项后的配置
+func (c *Config) ValidateRooms() error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	for _, room := range c.RoomList() {
+		rc, err := c.ForRoom(room)
+		if err != nil {
+			return &ValidationError{RoomID: room.RoomId, Errors: []FieldError{{Field: "Override", Value: room.Override, Message: err.Error()}}}
+		}
+		if err = rc.Validate(); err != nil {
+			err.(*ValidationError).RoomID = rc.RoomId
+			return err
+		}
+	}
+	return nil
+}
+
+// Load 读取配置文件并校验，文件格式错误或校验失败时返回错误，不会 panic
+func Load(path string) (Config, error) {
+	var c Config
+	if err := conf.Load(path, &c, conf.UseEnv()); err != nil {
+		return c, err
+	}
+	return c, c.ValidateRooms()
+}
+
+// validRobotMode 机器人服务名称不区分大小写
+func validRobotMode(mode string) bool {
+	robotModesMu.RLock()
+	defer robotModesMu.RUnlock()
+	_, ok := robotModes[strings.ToLower(strings.TrimSpace(mode))]
+	return ok
+}
+
+func validFilterAction(action string) bool {
+	for _, a := range FilterActions {
+		if strings.EqualFold(action, a) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasText(list []string) bool {
+	for _, s := range list {
+		if strings.TrimSpace(s) != "" {
+			return true
+		}
+	}
+	return false
+}
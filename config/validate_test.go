@@ -0,0 +1,162 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const validYaml = `
+RoomId: 1
+InteractWord: true
+CronDanmu: true
+CronDanmuList:
+  - Cron: "*/5 * * * *"
+    Danmu: ["点点关注"]
+`
+
+// writeConfig 先写临时文件再替换，Watch 不会读到写了一半的文件
+func writeConfig(t *testing.T, path, yaml string) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, validYaml)
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("default config rejected: %v", err)
+	}
+
+	c.DanmuLen = 0
+	c.RobotMode = "Tuling"
+	c.WelcomeDanmu = []string{" "}
+	c.ThanksFocus = true
+	c.WelcomeUseAt = true
+	c.CronDanmuList = []CronDanmuList{{Cron: "*/5 * * * *", Danmu: []string{"ok"}}, {Cron: "every day"}}
+	c.RobotFilter.URLAction = "block"
+	c.RobotFilter.PhoneAction = "MASK"
+	c.RobotFilter.Patterns = []string{"ok", "("}
+	err = c.Validate()
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("want *ValidationError, got %v", err)
+	}
+	var fields []string
+	for _, fe := range ve.Errors {
+		fields = append(fields, fe.Field)
+	}
+	sort.Strings(fields)
+	want := []string{"CronDanmuList[1].Cron", "CronDanmuList[1].Danmu", "DanmuLen", "FocusDanmu", "RobotFilter.Patterns[1]", "RobotFilter.URLAction", "RobotMode", "WelcomeDanmu"}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Fatalf("fields = %v, want %v", fields, want)
+		}
+	}
+}
+
+func TestValidateRoomOverride(t *testing.T) {
+	c := Config{RoomId: 1, DanmuLen: 20, DanmuRate: 1, RobotMode: "DeepSeek", RobotTimeout: 20}
+	c.Rooms = []RoomConfig{{RoomId: 2}, {RoomId: 3, Override: map[string]interface{}{"DanmuLen": 500}}}
+	var ve *ValidationError
+	if err := c.ValidateRooms(); !errors.As(err, &ve) || ve.RoomID != 3 || ve.Errors[0].Field != "DanmuLen" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestRobotModeRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, validYaml+"RobotMode: deepseek\nRobotFallback: [CustomBot]\n")
+	var ve *ValidationError
+	if _, err := Load(path); !errors.As(err, &ve) || ve.Errors[0].Field != "RobotFallback[0]" {
+		t.Fatalf("unregistered fallback: %v", err)
+	}
+	RegisterRobotMode("CustomBot")
+	t.Cleanup(func() {
+		robotModesMu.Lock()
+		delete(robotModes, "custombot")
+		robotModesMu.Unlock()
+	})
+	if c, err := Load(path); err != nil || c.RobotMode != "deepseek" {
+		t.Fatalf("registered fallback: %v", err)
+	}
+}
+
+func TestLoadBadYaml(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "RoomId: [1")
+	if _, err := Load(path); err == nil {
+		t.Fatal("broken yaml accepted")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, validYaml)
+	changes := make(chan Config, 1)
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, path, 10*time.Millisecond, func(c Config) { changes <- c }, func(err error) { errs <- err })
+
+	wait := func() (Config, error) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case c := <-changes:
+				if c.DanmuLen == 30 {
+					// 第一次修改重试写入时可能触发多次
+					continue
+				}
+				return c, nil
+			case err := <-errs:
+				return Config{}, err
+			case <-timeout:
+				t.Fatal("no reload")
+			}
+		}
+	}
+
+	// 启动时的内容视为已经加载，写入可能早于 Watch 读取初始内容，每次写入不同的注释直到被检测到
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; ; i++ {
+		writeConfig(t, path, fmt.Sprintf("%sDanmuLen: 30\n# %d\n", validYaml, i))
+		select {
+		case c := <-changes:
+			if c.DanmuLen != 30 {
+				t.Fatalf("valid change: %d", c.DanmuLen)
+			}
+		case err := <-errs:
+			t.Fatalf("valid change: %v", err)
+		case <-time.After(20 * time.Millisecond):
+			if time.Now().After(deadline) {
+				t.Fatal("no reload")
+			}
+			continue
+		}
+		break
+	}
+	writeConfig(t, path, validYaml+"DanmuLen: 0\n")
+	if _, err := wait(); err == nil {
+		t.Fatal("invalid change accepted")
+	}
+	writeConfig(t, path, validYaml+"DanmuLen: 25\n")
+	if c, err := wait(); err != nil || c.DanmuLen != 25 {
+		t.Fatalf("fixed change: %v %d", err, c.DanmuLen)
+	}
+}
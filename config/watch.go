@@ -0,0 +1,47 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// Watch 每隔 interval 检查一次配置文件，内容变化后读取并校验
+// 校验通过时调用 onChange，文件格式错误或校验失败时调用 onError，调用方应继续使用之前的配置
+// 编辑器保存到一半时可能读到不完整的文件，报错后下一次检查到完整内容会再次读取；ctx 取消后返回
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func(Config), onError func(error)) {
+	last := fileSum(path)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sum := fileSum(path)
+		if sum == nil || bytes.Equal(sum, last) {
+			// 文件暂时不存在时不处理，可能正在被替换
+			continue
+		}
+		last = sum
+		c, err := Load(path)
+		if err != nil {
+			onError(err)
+			continue
+		}
+		onChange(c)
+	}
+}
+
+// fileSum 文件内容的摘要，读取失败时返回 nil
+func fileSum(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
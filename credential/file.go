@@ -0,0 +1,246 @@
+package credential
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	fileVersion = 1
+	kdfIter     = 200000
+	keyLen      = 32
+	saltLen     = 16
+)
+
+// ErrDecrypt 口令错误或文件被修改
+var ErrDecrypt = errors.New("凭据库解密失败，口令错误或文件已损坏")
+
+// sealedFile 凭据库文件格式，Data 为 AES-256-GCM 加密的 json
+type sealedFile struct {
+	Version int    `json:"version"`
+	Iter    int    `json:"iter"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// FileStore 加密保存在单个文件中的凭据库
+//
+// 密钥由口令经 PBKDF2 派生，口令为空时使用本机密钥；文件权限为 0600，先写临时文件再重命名，
+// 写入中途退出不会损坏原有文件
+type FileStore struct {
+	path   string
+	locked sync.Mutex
+	salt   []byte
+	key    []byte
+	data   map[string]string
+}
+
+// NewFileStore 打开凭据库，文件不存在时在首次写入时创建
+func NewFileStore(path, passphrase string) (*FileStore, error) {
+	if passphrase == "" {
+		secret, err := machineSecret(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("读取本机密钥失败：%w", err)
+		}
+		passphrase = secret
+	}
+	s := &FileStore{path: path, data: make(map[string]string)}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.salt = make([]byte, saltLen)
+		if _, err = rand.Read(s.salt); err != nil {
+			return nil, err
+		}
+		s.key, err = deriveKey(passphrase, s.salt, kdfIter)
+		return s, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	checkPerm(path)
+	var f sealedFile
+	if err = json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("凭据库格式错误：%w", err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("不支持的凭据库版本：%d", f.Version)
+	}
+	s.salt = f.Salt
+	if s.key, err = deriveKey(passphrase, f.Salt, f.Iter); err != nil {
+		return nil, err
+	}
+	plain, err := s.open(f.Nonce, f.Data)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(plain, &s.data); err != nil {
+		return nil, ErrDecrypt
+	}
+	return s, nil
+}
+
+func (s *FileStore) Get(key string) (string, error) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	v, ok := s.data[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *FileStore) Set(key, value string) error {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	old, ok := s.data[key]
+	s.data[key] = value
+	if err := s.flush(); err != nil {
+		// 写入失败时保持内存和文件一致
+		if ok {
+			s.data[key] = old
+		} else {
+			delete(s.data, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Delete(key string) error {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	old, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	delete(s.data, key)
+	if err := s.flush(); err != nil {
+		s.data[key] = old
+		return err
+	}
+	return nil
+}
+
+// flush 加密后原子写入文件
+func (s *FileStore) flush() error {
+	plain, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	nonce, sealed, err := s.seal(plain)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(sealedFile{
+		Version: fileVersion,
+		Iter:    kdfIter,
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    sealed,
+	})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, raw)
+}
+
+func (s *FileStore) seal(plain []byte) ([]byte, []byte, error) {
+	gcm, err := s.aead()
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, gcm.Seal(nil, nonce, plain, nil), nil
+}
+
+func (s *FileStore) open(nonce, sealed []byte) ([]byte, error) {
+	gcm, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+func (s *FileStore) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func deriveKey(passphrase string, salt []byte, iter int) ([]byte, error) {
+	if iter <= 0 || len(salt) == 0 {
+		return nil, errors.New("凭据库参数错误")
+	}
+	return pbkdf2.Key(sha256.New, passphrase, salt, iter, keyLen)
+}
+
+// writeFileAtomic 写入同目录下的临时文件后重命名，文件权限为 0600
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	name := tmp.Name()
+	defer os.Remove(name)
+	if err = tmp.Chmod(0600); err != nil && runtime.GOOS != "windows" {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(name, path)
+}
+
+// checkPerm 其他用户可读时收紧权限
+func checkPerm(path string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+	logx.Errorf("凭据库 %s 权限过宽（%v），已修改为 0600", path, info.Mode().Perm())
+	if err = os.Chmod(path, 0600); err != nil {
+		logx.Errorf("修改凭据库权限失败：%v", err)
+	}
+}
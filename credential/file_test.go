@@ -0,0 +1,80 @@
+package credential
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token", "credentials.enc")
+	s, err := NewFileStore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Get(KeyBiliCookie); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("want ErrNotFound, got %v", err)
+	}
+	if err = s.Set(KeyBiliCookie, "SESSDATA=secret;"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(KeyDeepSeekAPIToken, "sk-123"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Delete(KeyDeepSeekAPIToken); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "secret") {
+		t.Error("credentials should not be stored in plaintext")
+	}
+	if runtime.GOOS != "windows" {
+		info, _ := os.Stat(path)
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("want mode 0600, got %v", perm)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+
+	s, err = NewFileStore(path, "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get(KeyBiliCookie); err != nil || v != "SESSDATA=secret;" {
+		t.Errorf("reopen: got %q, %v", v, err)
+	}
+	if _, err = s.Get(KeyDeepSeekAPIToken); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted entry should be gone, got %v", err)
+	}
+
+	if _, err = NewFileStore(path, "wrong"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("wrong passphrase: want ErrDecrypt, got %v", err)
+	}
+}
+
+func TestFileStoreMachineKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	s, err := NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Set(KeyChatGPTAPIToken, "token"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewFileStore(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Get(KeyChatGPTAPIToken); v != "token" {
+		t.Errorf("got %q", v)
+	}
+}
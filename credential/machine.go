@@ -0,0 +1,46 @@
+package credential
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 没有系统机器标识时生成的本机密钥文件
+const machineKeyFile = ".machine_key"
+
+// machineSecret 返回本机密钥：优先使用系统的机器标识，没有时在 dir 下生成随机密钥并保存
+//
+// 本机密钥只能防止凭据库被复制到其他机器后直接读取，需要防范本机其他用户时应设置口令
+func machineSecret(dir string) (string, error) {
+	for _, p := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := os.ReadFile(p); err == nil {
+			if id := strings.TrimSpace(string(b)); id != "" {
+				return "machine-id:" + id, nil
+			}
+		}
+	}
+	path := filepath.Join(dir, machineKeyFile)
+	b, err := os.ReadFile(path)
+	if err == nil {
+		checkPerm(path)
+		if key := strings.TrimSpace(string(b)); key != "" {
+			return "machine-key:" + key, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err = rand.Read(buf); err != nil {
+		return "", err
+	}
+	key := hex.EncodeToString(buf)
+	if err = writeFileAtomic(path, []byte(key)); err != nil {
+		return "", err
+	}
+	return "machine-key:" + key, nil
+}
@@ -0,0 +1,98 @@
+// Package credential 保存登录 cookie、AI 接口令牌等敏感信息
+package credential
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// 保存在凭据库中的条目
+const (
+	KeyBiliCookie       = "bili_cookie"        // cookie 字符串
+	KeyBiliCookieList   = "bili_cookie_list"   // cookie 键值对，json 格式
+	KeyBiliRefreshToken = "bili_refresh_token" // 刷新 cookie 使用的 refresh_token
+	KeyChatGPTAPIToken  = "chatgpt_api_token"  // ChatGPT 接口令牌
+	KeyDeepSeekAPIToken = "deepseek_api_token" // DeepSeek 接口令牌
+)
+
+// DefaultPath 默认凭据库文件
+const DefaultPath = "token/credentials.enc"
+
+// PassphraseEnv 设置该环境变量时使用其值作为口令加密凭据库，否则使用本机密钥
+const PassphraseEnv = "BILIDANMAKU_PASSPHRASE"
+
+// ErrNotFound 凭据不存在
+var ErrNotFound = errors.New("凭据不存在")
+
+// Store 凭据存储
+type Store interface {
+	// Get 读取凭据，不存在时返回 ErrNotFound
+	Get(key string) (string, error)
+	// Set 保存凭据，写入完成后才返回
+	Set(key, value string) error
+	// Delete 删除凭据，不存在时不报错
+	Delete(key string) error
+}
+
+var (
+	defaultLocked sync.Mutex
+	defaultStore  Store
+)
+
+// Default 返回全局凭据库，首次调用时打开 DefaultPath
+func Default() (Store, error) {
+	defaultLocked.Lock()
+	defer defaultLocked.Unlock()
+	if defaultStore != nil {
+		return defaultStore, nil
+	}
+	s, err := NewFileStore(DefaultPath, os.Getenv(PassphraseEnv))
+	if err != nil {
+		return nil, err
+	}
+	defaultStore = s
+	return s, nil
+}
+
+// SetDefault 替换全局凭据库，如界面程序使用系统钥匙串
+func SetDefault(s Store) {
+	defaultLocked.Lock()
+	defaultStore = s
+	defaultLocked.Unlock()
+}
+
+// Get 从全局凭据库读取凭据
+func Get(key string) (string, error) {
+	s, err := Default()
+	if err != nil {
+		return "", err
+	}
+	return s.Get(key)
+}
+
+// Set 向全局凭据库保存凭据
+func Set(key, value string) error {
+	s, err := Default()
+	if err != nil {
+		return err
+	}
+	return s.Set(key, value)
+}
+
+// Delete 从全局凭据库删除凭据
+func Delete(key string) error {
+	s, err := Default()
+	if err != nil {
+		return err
+	}
+	return s.Delete(key)
+}
+
+// Lookup 从全局凭据库读取 key，凭据库中没有时使用配置中的明文密钥
+func Lookup(configured, key string) string {
+	if v, err := Get(key); err == nil && v != "" {
+		return v
+	}
+	return configured
+}
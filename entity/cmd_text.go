@@ -1,5 +1,7 @@
 package entity
 
+import "time"
+
 type CmdText struct {
 	Cmd string `json:"cmd"`
 }
@@ -14,10 +16,27 @@ type DanmuMsgTextReplyInfo struct {
 }
 
 type Bullet struct {
-	Msg   string
-	Reply []*DanmuMsgTextReplyInfo
+	Msg      string
+	Reply    []*DanmuMsgTextReplyInfo
+	Priority BulletPriority
+	Time     time.Time // 进入发送队列的时间
+	// 可合并的弹幕，MergeKey 为含 {user} 的模板，MergeArgs 为替换 {user} 的用户名
+	MergeKey  string
+	MergeArgs []string
 }
 
+// BulletPriority 弹幕发送优先级，数值越小越先发送
+type BulletPriority int
+
+const (
+	BulletPriorityAnchor  BulletPriority = iota // 主播指令
+	BulletPriorityGift                          // 礼物、大航海感谢
+	BulletPriorityReply                         // AI 回复及其他弹幕互动
+	BulletPriorityWelcome                       // 欢迎、关注感谢
+	BulletPriorityCron                          // 定时弹幕
+	BulletPriorityCount
+)
+
 type DanmuMsgTextInfo0Extra struct {
 	SendFromMe            bool        `json:"send_from_me"`
 	Mode                  int         `json:"mode"`
@@ -25,3 +25,24 @@ type LoginInfoData struct {
 type LoginInfoCookies struct {
 	SetCookie []string `json:"Set-Cookie"`
 }
+
+// CookieInfo 检查是否需要刷新 cookie 的返回
+type CookieInfo struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Refresh   bool  `json:"refresh"`
+		Timestamp int64 `json:"timestamp"`
+	} `json:"data"`
+}
+
+// CookieRefresh 刷新 cookie 的返回
+type CookieRefresh struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Status       int    `json:"status"`
+		Message      string `json:"message"`
+		RefreshToken string `json:"refresh_token"`
+	} `json:"data"`
+}
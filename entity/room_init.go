@@ -132,3 +132,16 @@ type TopListInfo struct {
 		RemindBenefit string `json:"remind_benefit"`
 	} `json:"data"`
 }
+
+// InfoByUser 当前登录用户在直播间的信息，只保留需要的字段
+type InfoByUser struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    struct {
+		Property struct {
+			Danmu struct {
+				Length int `json:"length"` // 弹幕长度限制
+			} `json:"danmu"`
+		} `json:"property"`
+	} `json:"data"`
+}
@@ -1,28 +1,40 @@
 package handler
 
-import "github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+import (
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+const (
+	suppressAnchorLot = "天选"
+	suppressRedPocket = "红包"
+	// 没有收到结束消息时，临时关闭的开关在这之后自动恢复
+	suppressTimeout = 30 * time.Minute
+)
 
 // 天选
 func (w *wsHandler) anchorLot() {
 	// 天选启动
-	w.client.RegisterCustomEventHandler("ANCHOR_LOT_START", func(s string) {
-		if w.svc.Config.InteractWord || w.svc.Config.EntryEffect || w.svc.Config.WelcomeHighWealthy {
-			w.svc.Config.InteractWord = false
-			w.svc.Config.EntryEffect = false
-			w.svc.Config.WelcomeHighWealthy = false
-		}
-		logic.PushToBulletSender("识别到天选，欢迎弹幕已临时关闭")	})
+	w.bus.SubscribeRaw("ANCHOR_LOT_START", func(s string) {
+		w.svc.Runtime.Suppress(suppressAnchorLot, suppressTimeout, svc.WelcomeToggles...)
+		logic.PushToBulletSender(w.svc, "识别到天选，欢迎弹幕已临时关闭")
+	})
 	// 天选中奖
-	w.client.RegisterCustomEventHandler("ANCHOR_LOT_AWARD", func(s string) {
-		if w.svc.Config.InteractWord != w.svc.Autointerract.InteractWord {
-			w.svc.Config.InteractWord = w.svc.Autointerract.InteractWord
-		}
-		if w.svc.Config.EntryEffect != w.svc.Autointerract.EntryEffect {
-			w.svc.Config.EntryEffect = w.svc.Autointerract.EntryEffect
+	w.bus.SubscribeRaw("ANCHOR_LOT_AWARD", func(s string) {
+		if w.svc.Runtime.Lift(suppressAnchorLot) {
+			logic.PushToBulletSender(w.svc, "天选结束，欢迎弹幕已恢复默认")
 		}
-		if w.svc.Config.WelcomeHighWealthy != w.svc.Autointerract.WelcomeHighWealthy {
-			w.svc.Config.WelcomeHighWealthy = w.svc.Autointerract.WelcomeHighWealthy
-		}
-		logic.PushToBulletSender("天选结束，欢迎弹幕已恢复默认")
 	})
 }
+
+// welcomeEnabled 是否有欢迎弹幕开关处于开启状态
+func (w *wsHandler) welcomeEnabled() bool {
+	for _, t := range svc.WelcomeToggles {
+		if w.svc.Enabled(t) {
+			return true
+		}
+	}
+	return false
+}
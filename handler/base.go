@@ -6,7 +6,9 @@ import (
 	"fmt"
 	_ "github.com/glebarez/go-sqlite"
 	"github.com/robfig/cron/v3"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/api"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
 	_ "github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/utils"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
@@ -14,19 +16,22 @@ import (
 	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
-	"github.com/xbclub/BilibiliDanmuRobot-Core/utiles"
-	"github.com/zeromicro/go-zero/core/conf"
 	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
 	"math/rand"
 	"os"
-	"reflect"
 	"strconv"
+	"sync"
 	"time"
 )
 
 type wsHandler struct {
-	client *client.Client
-	svc    *svc.ServiceContext
+	// 弹幕消息来源，由 source 创建，默认为连接直播间的 *client.Client
+	client client.Source
+	source func(roomId int) client.Source
+	// 事件总线，重建 client 时保留，内置处理器和外部模块都订阅在这里
+	bus *client.EventBus
+	svc *svc.ServiceContext
 	// 机器人
 	robotBulletCtx    context.Context
 	robotBulletCancel context.CancelFunc
@@ -45,82 +50,119 @@ type wsHandler struct {
 	//弹幕处理
 	danmuLogicCtx    context.Context
 	danmuLogicCancel context.CancelFunc
+	// 弹幕连接检查
+	watchCtx    context.Context
+	watchCancel context.CancelFunc
+	// 录制收到的弹幕消息
+	recorder *client.Recorder
+	// 生命周期状态和处理逻辑的 goroutine
+	life lifecycle
+	wg   sync.WaitGroup
+	// startPipelines 启动的 goroutine，重启处理逻辑时等待旧的全部退出后再启动新的
+	pipelines sync.WaitGroup
 	//定时弹幕
 	corndanmu           *cron.Cron
 	mapCronDanmuSendIdx map[int]int
 	userId              int
 	initStart           bool
+	// 红包
+	redPocketCnt    int
+	redPocketLocked *sync.Mutex
 }
 
-func NewWsHandler() WsHandler {
-	ctx, err := mustloadConfig()
+// NewWsHandler 创建弹幕机器人，rooms 为空时使用配置文件中的直播间列表
+// 所有直播间共用一个数据库连接和一个登录账号，各自拥有独立的弹幕连接和处理管线
+func NewWsHandler(rooms ...config.RoomConfig) WsHandler {
+	c, err := mustloadConfig()
 	if err != nil {
+		logx.Error(err)
 		return nil
 	}
-	ws := new(wsHandler)
-	ws.initStart = false
-	err = ws.starthttp()
+	http.SetBaseURL(c.BiliAPIBase)
+	api.SetBaseURL(c.BiliAPIBase)
+	m := &multiRoomHandler{
+		roomList: rooms,
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	err = m.starthttp()
 	if err != nil {
+		m.cancel()
 		logx.Error(err)
 		return nil
 	}
-	ws.client = client.NewClient(ctx.Config.RoomId)
-	ws.client.SetCookie(http.CookieStr)
-	ws.svc = ctx
-	//初始化定时弹幕
-	ws.corndanmu = cron.New(cron.WithParser(cron.NewParser(
-		cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow,
-	)))
-	ws.mapCronDanmuSendIdx = make(map[int]int)
+	logic.SetReloginHook(func() error {
+		return m.relogin(m.lifeContext())
+	})
+	m.db, err = svc.OpenDB(c)
+	if err != nil {
+		logx.Error(err)
+		return nil
+	}
+	if len(rooms) == 0 {
+		rooms = c.RoomList()
+	}
+	for _, room := range rooms {
+		ws, err := newRoomHandler(c, room, m.db)
+		if err != nil {
+			logx.Errorf("直播间 %v 初始化失败：%v", room.RoomId, err)
+			return nil
+		}
+		m.rooms = append(m.rooms, ws)
+	}
+	return m
+}
+
+// newRoomHandler 创建单个直播间的处理器
+func newRoomHandler(c config.Config, room config.RoomConfig, db *gorm.DB) (*wsHandler, error) {
+	rc, err := c.ForRoom(room)
+	if err != nil {
+		return nil, err
+	}
+	ctx := svc.NewRoomServiceContext(rc, db)
+	ws := newWsHandler(ctx)
+	ws.client = ws.source(rc.RoomId)
 
 	// 设置uid作为基本配置
-	strUserId, ok := http.CookieList["DedeUserID"]
+	strUserId, ok := http.CookieValue("DedeUserID")
 	if !ok {
 		logx.Infof("uid加载失败，请重新登录")
-		return nil
+		return nil, errors.New("uid加载失败")
 	}
 	ws.userId, err = strconv.Atoi(strUserId)
 	ctx.RobotID = strUserId
-	roominfo, err := http.RoomInit(ctx.Config.RoomId)
+	roominfo, err := http.BiliOf(ctx).RoomInit(rc.RoomId)
 	if err != nil {
-		logx.Error(err)
-		return nil
+		return nil, err
 	}
 	ctx.UserID = roominfo.Data.Uid
+	ws.loadDanmuLenLimit()
+	return ws, nil
+}
+
+// newWsHandler 创建直播间处理器并注册事件处理，不访问网络，弹幕来源由调用方设置
+func newWsHandler(ctx *svc.ServiceContext) *wsHandler {
+	ws := new(wsHandler)
+	ws.initStart = false
+	ws.redPocketLocked = new(sync.Mutex)
+	ws.bus = client.NewEventBus()
+	ws.svc = ctx
+	ws.source = func(roomId int) client.Source { return ws.newClient(roomId) }
+	ws.registerHandler()
+	//初始化定时弹幕
+	ws.corndanmu = cron.New(cron.WithParser(config.CronParser))
+	ws.mapCronDanmuSendIdx = make(map[int]int)
 	return ws
 }
-func (ws *wsHandler) ReloadConfig() error {
-	ctx, err := mustloadConfig()
-	oldconfig := *ws.svc.Config
-	if err != nil {
-		return err
-	}
-	ws.svc.Config = ctx.Config
-	// if ctx.Config.RoomId != oldconfig.RoomId {
-	// 	logx.Infof("房间号更改，更换房间号 ：%v", ctx.Config.RoomId)
-	ws.client.Stop()
-	ws.client = client.NewClient(ctx.Config.RoomId)
-	ws.client.SetCookie(http.CookieStr)
-	roominfo, err := http.RoomInit(ctx.Config.RoomId)
-	if err != nil {
-		logx.Error(err)
-		//return err
-	}
-	ctx.UserID = roominfo.Data.Uid
-	err = ws.client.Start()
+
+// loadDanmuLenLimit 获取机器人账号的弹幕长度限制，失败时只使用配置的长度
+func (ws *wsHandler) loadDanmuLenLimit() {
+	c := ws.svc.Config()
+	l, err := http.BiliOf(ws.svc).DanmuLength(c.RoomId)
 	if err != nil {
-		return err
-	}
-	ws.registerHandler()
-	// }
-	if ctx.Config.CronDanmu != oldconfig.CronDanmu || !areSlicesEqual(ctx.Config.CronDanmuList, oldconfig.CronDanmuList) {
-		logx.Info("识别到定时弹幕配置发生变化，重新加载")
-		for _, i := range ws.corndanmu.Entries() {
-			ws.corndanmu.Remove(i.ID)
-		}
-		ws.corndanmuStart()
+		logx.Errorf("直播间 %v 获取弹幕长度限制失败：%v", c.RoomId, err)
+		return
 	}
-	return nil
+	ws.svc.DanmuLenLimit = l
 }
 
 type WsHandler interface {
@@ -129,40 +171,105 @@ type WsHandler interface {
 	SayGoodbye()
 	StopChanel()
 	StartWsClient() error
+	// Shutdown 停止所有直播间：发送下播弹幕，等待发送队列清空和所有 goroutine 退出，关闭数据库
+	Shutdown(ctx context.Context) error
+	State() State
 	starthttp() error
 	ReloadConfig() error
 	GetSvc() svc.ServiceContext
+	GetRoomSvcs() []svc.ServiceContext
 	GetUserinfo() *entity.UserinfoLite
+	// Subscribe 在所有直播间订阅弹幕事件，返回取消订阅的函数
+	Subscribe(cmd string, handler RoomEventHandler, opts ...client.SubscribeOption) func()
 }
 
+// RoomEventHandler 外部模块的事件处理器，svcCtx 为事件所在直播间的上下文
+type RoomEventHandler func(svcCtx *svc.ServiceContext, e *client.Event)
+
 func (w *wsHandler) InitStartWsClient() {
 	w.startLogic()
 }
 func (w *wsHandler) StartWsClient() error {
-	if w.svc.Config.EntryMsg != "off" {
-		err := http.Send(w.svc.Config.EntryMsg, w.svc)
+	c := w.svc.Config()
+	if c.EntryMsg != "off" {
+		_, err := http.Send(c.EntryMsg, w.svc)
 		if err != nil {
 			logx.Error(err)
 		}
 	}
 	w.corndanmu.Start()
-	w.client = client.NewClient(w.svc.Config.RoomId)
-	w.client.SetCookie(http.CookieStr)
-	w.registerHandler()
-	return w.client.Start()
+	if err := w.startConnection(); err != nil {
+		return err
+	}
+	w.life.transition(StateRunning, StateCreated, StateStarting)
+	return nil
 }
-func (w *wsHandler) GetUserinfo() *entity.UserinfoLite {
-	return http.GetUserInfo()
+
+// startConnection 建立弹幕连接，连接直播间时录制消息并开始检查连接状态
+func (w *wsHandler) startConnection() error {
+	src := w.source(w.svc.Config().RoomId)
+	src.SetEventBus(w.bus)
+	w.client = src
+	c, live := src.(*client.Client)
+	if live {
+		w.startRecord(c)
+	}
+	if err := src.Start(); err != nil {
+		return err
+	}
+	if live {
+		w.watchCtx, w.watchCancel = context.WithCancel(context.Background())
+		w.goLogic(w.watchCtx, func(ctx context.Context, _ *svc.ServiceContext) {
+			w.watchConnection(ctx, c)
+		})
+	}
+	return nil
 }
-func (w *wsHandler) GetSvc() svc.ServiceContext {
-	return *w.svc
+
+// stopConnection 断开弹幕连接，不等待读取的 goroutine 退出
+func (w *wsHandler) stopConnection() {
+	if w.watchCancel != nil {
+		w.watchCancel()
+	}
+	w.client.Stop()
+	w.stopRecord()
+}
+
+// newClient 创建弹幕连接，沿用直播间的事件总线
+func (w *wsHandler) newClient(roomId int) *client.Client {
+	cfg := w.svc.Config()
+	c := client.NewClient(roomId)
+	c.SetCookie(http.Cookie())
+	c.SetEventBus(w.bus)
+	recv, err := packet.ParseProtocol(cfg.WsProtocol)
+	if err != nil {
+		logx.Errorf("WsProtocol 配置有误，使用 brotli：%v", err)
+		recv = packet.Brotli
+	}
+	send, err := packet.ParseProtocol(cfg.WsSendProtocol)
+	if err != nil {
+		logx.Errorf("WsSendProtocol 配置有误，使用 plain：%v", err)
+		send = packet.Popularity
+	}
+	c.SetProtocol(recv, send)
+	c.SetWorkers(cfg.EventWorkers, cfg.EventQueueSize)
+	return c
 }
 func (w *wsHandler) StopWsClient() {
 	w.corndanmu.Stop()
-	w.client.Stop()
-	//w.svc.Db.Db.Close()
+	w.stopConnection()
+	w.life.transition(StateStarting, StateRunning)
 }
 func (w *wsHandler) StopChanel() {
+	w.stopPipelines()
+	for _, i := range w.corndanmu.Entries() {
+		w.corndanmu.Remove(i.ID)
+	}
+	w.life.transition(StateStopped, StateCreated, StateStarting, StateRunning)
+}
+
+// stopPipelines 停止处理逻辑，队列中的消息保留到下次启动
+func (w *wsHandler) stopPipelines() {
 	if w.sendBulletCancel != nil {
 		w.sendBulletCancel()
 	}
@@ -181,75 +288,63 @@ func (w *wsHandler) StopChanel() {
 	if w.danmuLogicCancel != nil {
 		w.danmuLogicCancel()
 	}
-	for _, i := range w.corndanmu.Entries() {
-		w.corndanmu.Remove(i.ID)
-	}
 }
+
+// SayGoodbye 发送下播弹幕，处理逻辑在运行时等待发送队列清空
 func (w *wsHandler) SayGoodbye() {
-	if len(w.svc.Config.GoodbyeInfo) > 0 {
-
-		var danmuLen = w.svc.Config.DanmuLen
-		var msgdata []string
-		msgrun := []rune(w.svc.Config.GoodbyeInfo)
-		msgLen := len(msgrun)
-		msgcount := msgLen / danmuLen
-		tmpmsgcount := msgLen % danmuLen
-		if tmpmsgcount != 0 {
-			msgcount += 1
-		}
-		for m := 1; m <= msgcount; m++ {
-			if msgLen < m*danmuLen {
-				msgdata = append(msgdata, string(msgrun[(m-1)*danmuLen:msgLen]))
-				continue
-			}
-			msgdata = append(msgdata, string(msgrun[(m-1)*danmuLen:danmuLen*m]))
-		}
-		for _, msgs := range msgdata {
-			err := http.Send(msgs, w.svc)
-			if err != nil {
-				logx.Errorf("下播弹幕发送失败：%s msg: %s", err, msgs)
-			}
-			time.Sleep(1 * time.Second) // 防止弹幕发送过快
-			// logx.Info(">>>>>>>>>", msgs)
+	ctx, cancel := context.WithTimeout(context.Background(), goodbyeTimeout)
+	defer cancel()
+	w.sayGoodbye(ctx, w.logicRunning())
+	if w.logicRunning() && len(w.svc.Config().GoodbyeInfo) > 0 {
+		if err := logic.FlushBulletSender(ctx, w.svc); err != nil {
+			logx.Errorf("下播弹幕发送超时：%v", err)
 		}
 	}
 }
 func (w *wsHandler) startLogic() {
+	w.life.transition(StateStarting, StateCreated, StateStopped)
+	w.startPipelines()
+
+	// 下播提醒
+	// w.sayGoodbyeByWs()
+
+	//定时弹幕
+	w.corndanmuStart()
+
+	//w.registerHandler()
+}
+
+// startPipelines 启动弹幕发送、机器人、欢迎、感谢等处理逻辑
+func (w *wsHandler) startPipelines() {
 	w.sendBulletCtx, w.sendBulletCancel = context.WithCancel(context.Background())
-	go logic.StartSendBullet(w.sendBulletCtx, w.svc)
+	w.goPipeline(w.sendBulletCtx, logic.StartSendBullet)
 	logx.Info("弹幕推送已开启...")
 	// 机器人
 	w.robotBulletCtx, w.robotBulletCancel = context.WithCancel(context.Background())
-	go logic.StartBulletRobot(w.robotBulletCtx, w.svc)
+	w.goPipeline(w.robotBulletCtx, logic.StartBulletRobot)
 	// 弹幕逻辑
 	w.danmuLogicCtx, w.danmuLogicCancel = context.WithCancel(context.Background())
-	go danmu.StartDanmuLogic(w.danmuLogicCtx, w.svc)
+	w.goPipeline(w.danmuLogicCtx, danmu.StartDanmuLogic)
 
 	logx.Info("弹幕机器人已开启")
 	// 特效欢迎
 	w.ineterractCtx, w.ineterractCancel = context.WithCancel(context.Background())
-	go logic.Interact(w.ineterractCtx, w.svc)
+	w.goPipeline(w.ineterractCtx, logic.Interact)
 
 	logx.Info("欢迎模块已开启")
 
 	// 礼物感谢
 	w.thanksGiftCtx, w.thankGiftCancel = context.WithCancel(context.Background())
-	go logic.ThanksGift(w.thanksGiftCtx, w.svc)
+	w.goPipeline(w.thanksGiftCtx, logic.ThanksGift)
 
 	logx.Info("礼物感谢已开启")
 	// pk提醒
 	w.pkCtx, w.pkCancel = context.WithCancel(context.Background())
-	go logic.PK(w.pkCtx, w.svc)
-
-	// 下播提醒
-	// w.sayGoodbyeByWs()
-
-	//定时弹幕
-	w.corndanmuStart()
-
-	//w.registerHandler()
+	w.goPipeline(w.pkCtx, logic.PK)
 }
 func (w *wsHandler) registerHandler() {
+	// 弹幕连接状态
+	w.connectionEvents()
 	w.welcomeEntryEffect()
 	w.welcomeInteractWord()
 	logx.Info("弹幕处理已开启")
@@ -265,68 +360,94 @@ func (w *wsHandler) registerHandler() {
 	// 红包
 	w.redPocket()
 }
-func (w *wsHandler) starthttp() error {
-	var err error
+
+// starthttp 加载保存的登录信息并检查是否有效，未登录时通过 SetLoginPrompt 设置的方式扫码登录
+func (m *multiRoomHandler) starthttp() error {
 	http.InitHttpClient()
 	// 判断是否存在历史cookie
-	if http.FileExists("token/bili_token.txt") && http.FileExists("token/bili_token.json") {
-		err = http.SetHistoryCookie()
-		if err != nil {
-			logx.Error("用户登录失败")
-			return err
-		}
-		logx.Info("用户登录成功")
-	} else {
-		//if err = w.userlogin(); err != nil {
-		//	logx.Errorf("用户登录失败：%v", err)
-		//	return
-		//}
-		//logx.Info("用户登录成功")
+	if !http.HasHistoryCookie() {
+		logx.Error("没有保存的登录信息")
+		return m.loginByQR(m.lifeContext())
+	}
+	if err := http.SetHistoryCookie(); err != nil {
 		logx.Error("用户登录失败")
-		return errors.New("用户登录失败")
+		return err
+	}
+	// 检查cookie是否有效，临近过期时刷新；网络问题导致检查失败时按已登录继续
+	if err := http.EnsureLogin(); err != nil {
+		if errors.Is(err, http.ErrNotLogin) {
+			logx.Errorf("用户登录失败：%v", err)
+			return m.loginByQR(m.lifeContext())
+		}
+		logx.Errorf("检查登录状态失败：%v", err)
 	}
+	logx.Info("用户登录成功")
 	return nil
 }
-func (w *wsHandler) userlogin() error {
-	var err error
-	http.InitHttpClient()
-	var loginUrl *entity.LoginUrl
-	if loginUrl, err = http.GetLoginUrl(); err != nil {
-		logx.Error(err)
-		return err
+
+// lifeContext 生命周期 context，没有通过 NewWsHandler 创建时不会取消
+func (m *multiRoomHandler) lifeContext() context.Context {
+	if m.ctx == nil {
+		return context.Background()
 	}
+	return m.ctx
+}
 
-	if err = utiles.GenerateQr(loginUrl.Data.Url); err != nil {
-		logx.Error(err)
+// loginByQR 扫码登录，成功后登录信息已经保存并生效，ctx 取消时停止等待
+func (m *multiRoomHandler) loginByQR(ctx context.Context) error {
+	if err := m.userlogin(ctx); err != nil {
+		logx.Errorf("用户登录失败：%v，请重新扫码登录", err)
 		return err
 	}
+	logx.Info("用户登录成功")
+	return nil
+}
 
-	if _, err = http.GetLoginInfo(loginUrl.Data.OauthKey); err != nil {
-		logx.Error(err)
+// relogin 登录失效时重新加载本地保存的登录信息并尝试刷新cookie，多个直播间同时失效时只处理一次
+// 刷新失败时通过 SetLoginPrompt 设置的方式扫码登录，没有设置时返回 http.ErrNotLogin，需要界面重新扫码登录
+// 由发送弹幕的后台 goroutine 调用，ctx 为 multiRoomHandler 的生命周期，Shutdown 时停止等待扫码
+func (m *multiRoomHandler) relogin(ctx context.Context) error {
+	m.reloginLocked.Lock()
+	defer m.reloginLocked.Unlock()
+	if time.Since(m.lastRelogin) < 10*time.Second {
+		return nil
+	}
+	// 界面可能已经重新扫码登录，先加载最新保存的cookie
+	if err := http.SetHistoryCookie(); err != nil {
 		return err
 	}
-
-	return err
+	if err := http.EnsureLogin(); err != nil {
+		if !errors.Is(err, http.ErrNotLogin) {
+			return err
+		}
+		if err = m.loginByQR(ctx); err != nil {
+			return err
+		}
+	}
+	m.lastRelogin = time.Now()
+	return nil
 }
+
 func (w *wsHandler) corndanmuStart() {
-	if w.svc.Config.CronDanmu == false {
+	c := w.svc.Config()
+	if c.CronDanmu == false {
 		return
 	}
-	for n, danmux := range w.svc.Config.CronDanmuList {
+	for n, danmux := range c.CronDanmuList {
 		if danmux.Danmu != nil {
 			i := n
 			danmus := danmux
 			_, err := w.corndanmu.AddFunc(danmus.Cron, func() {
 				if len(danmus.Danmu) > 0 {
 					if danmus.Random {
-						logic.PushToBulletSender(danmus.Danmu[rand.Intn(len(danmus.Danmu))])
+						logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityCron, danmus.Danmu[rand.Intn(len(danmus.Danmu))])
 					} else {
 						_, ok := w.mapCronDanmuSendIdx[i]
 						if !ok {
 							w.mapCronDanmuSendIdx[i] = 0
 						}
 						w.mapCronDanmuSendIdx[i] = w.mapCronDanmuSendIdx[i] + 1
-						logic.PushToBulletSender(danmus.Danmu[w.mapCronDanmuSendIdx[i]%len(danmus.Danmu)])
+						logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityCron, danmus.Danmu[w.mapCronDanmuSendIdx[i]%len(danmus.Danmu)])
 					}
 				}
 			})
@@ -337,7 +458,22 @@ func (w *wsHandler) corndanmuStart() {
 	}
 	w.corndanmu.Start()
 }
-func mustloadConfig() (*svc.ServiceContext, error) {
+
+// configFile 配置文件路径
+var configFile = "etc/bilidanmaku-api.yaml"
+
+// mustloadConfig 读取并校验配置文件，创建数据库目录；配置错误时返回错误，不会 panic
+func mustloadConfig() (config.Config, error) {
+	c, err := config.Load(configFile)
+	if err != nil {
+		return c, err
+	}
+	return c, prepareConfig(&c)
+}
+
+// prepareConfig 应用读取到的配置：初始化日志、迁移明文令牌、创建 token 和数据库目录
+// 启动、ReloadConfig 和监视配置文件的重载都经过这里，同一份修改无论从哪条路径生效结果都相同
+func prepareConfig(c *config.Config) error {
 	dir := "./token"
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		// Directory does not exist, create it
@@ -347,34 +483,17 @@ func mustloadConfig() (*svc.ServiceContext, error) {
 		}
 	}
 
-	var c config.Config
-	conf.MustLoad("etc/bilidanmaku-api.yaml", &c, conf.UseEnv())
 	logx.MustSetup(c.Log)
 	logx.DisableStat()
+	http.MigrateAPITokens(c)
 	//配置数据库文件夹
 	info, err := os.Stat(c.DBPath)
 	if os.IsNotExist(err) || !info.IsDir() {
 		err = os.MkdirAll(c.DBPath, 0777)
 		if err != nil {
 			logx.Errorf("文件夹创建失败：%s", c.DBPath)
-			return nil, err
-		}
-	}
-	ctx := svc.NewServiceContext(c)
-	return ctx, err
-}
-
-// 比较两个 Person 切片是否相同
-func areSlicesEqual(a, b []config.CronDanmuList) bool {
-	if len(a) != len(b) {
-		return false
-	}
-
-	for i := range a {
-		if !reflect.DeepEqual(a[i], b[i]) {
-			return false
+			return err
 		}
 	}
-
-	return true
+	return nil
 }
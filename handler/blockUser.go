@@ -11,8 +11,8 @@ import (
 // 禁言提醒
 func (w *wsHandler) blockUser() {
 	// 禁言提醒
-	w.client.RegisterCustomEventHandler("ROOM_BLOCK_MSG", func(s string) {
-		if w.svc.Config.ShowBlockMsg {
+	w.bus.SubscribeRaw("ROOM_BLOCK_MSG", func(s string) {
+		if w.svc.Config().ShowBlockMsg {
 			info := &entity.RoomBlockMsg{}
 			err := json.Unmarshal([]byte(s), info)
 			if err != nil {
@@ -34,7 +34,7 @@ func (w *wsHandler) blockUser() {
 				op = "解开禁言"
 			}
 			s := fmt.Sprintf("用户 %s 被%s %s!", info.Data.Uname, oper, op)
-			logic.PushToBulletSender(s)
+			logic.PushToBulletSender(w.svc, s)
 		}
 	})
 }
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// 超过该时间没有收到心跳回复时主动重连，心跳每 30 秒发送一次
+const staleHeartbeatTimeout = 2 * time.Minute
+
+// 弹幕连接状态，外部模块可以通过 WsHandler.Subscribe 订阅同样的事件
+func (w *wsHandler) connectionEvents() {
+	w.bus.Subscribe(client.EventConnected, func(e *client.Event) {
+		ce := e.Data.(*client.ConnectionEvent)
+		if ce.Attempt > 0 {
+			logx.Infof("直播间 %v 弹幕服务器重连成功：%s", ce.RoomID, ce.Host)
+			return
+		}
+		logx.Infof("直播间 %v 已连接弹幕服务器：%s", ce.RoomID, ce.Host)
+	})
+	w.bus.Subscribe(client.EventDisconnected, func(e *client.Event) {
+		ce := e.Data.(*client.ConnectionEvent)
+		logx.Errorf("直播间 %v 弹幕连接断开：%v", ce.RoomID, ce.Err)
+	})
+	w.bus.Subscribe(client.EventReconnecting, func(e *client.Event) {
+		ce := e.Data.(*client.ConnectionEvent)
+		logx.Infof("直播间 %v 将在 %v 后第 %d 次重连", ce.RoomID, ce.Delay.Round(time.Millisecond), ce.Attempt)
+	})
+}
+
+// watchConnection 定期检查弹幕连接，仍在收到数据但长时间没有心跳回复时，多半是认证被服务器静默拒绝，重新认证
+// 冷门直播间长时间没有业务消息是正常的，不作为重连的依据
+func (w *wsHandler) watchConnection(ctx context.Context, c *client.Client) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if silent, stale := heartbeatStale(c, now); stale {
+				logx.Errorf("直播间 %v 已 %v 没有收到心跳回复（最近一次服务器回复：%v，最近一次消息：%v），重新连接",
+					w.svc.Config().RoomId, silent.Round(time.Second), c.LastReply().Format(time.DateTime), c.LastMessage().Format(time.DateTime))
+				c.Reconnect()
+			}
+		}
+	}
+}
+
+// heartbeatStale 返回距离最近一次心跳回复的时间，以及是否超过 staleHeartbeatTimeout，尚未连接时不算超时
+func heartbeatStale(c *client.Client, now time.Time) (time.Duration, bool) {
+	last := c.LastHeartbeat()
+	if last.IsZero() {
+		return 0, false
+	}
+	silent := now.Sub(last)
+	return silent, silent > staleHeartbeatTimeout
+}
+
+// startRecord 配置了录制目录时，将收到的消息录制到 <目录>/<房间号>-<时间>.jsonl，可以用 client.Replayer 回放
+func (w *wsHandler) startRecord(c *client.Client) {
+	cfg := w.svc.Config()
+	dir := cfg.RecordDir
+	if dir == "" {
+		return
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%d-%s.jsonl", cfg.RoomId, time.Now().Format("20060102-150405")))
+	r, err := client.CreateRecorder(path)
+	if err != nil {
+		logx.Errorf("直播间 %v 创建录制文件失败：%v", cfg.RoomId, err)
+		return
+	}
+	logx.Infof("直播间 %v 开始录制弹幕消息：%s", cfg.RoomId, path)
+	w.recorder = r
+	c.SetRecorder(r)
+}
+
+func (w *wsHandler) stopRecord() {
+	if w.recorder == nil {
+		return
+	}
+	if err := w.recorder.Close(); err != nil {
+		logx.Errorf("关闭录制文件失败：%v", err)
+	}
+	w.recorder = nil
+}
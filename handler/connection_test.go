@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/packet"
+)
+
+func TestHeartbeatStale(t *testing.T) {
+	c := client.NewClient(1)
+	if _, stale := heartbeatStale(c, time.Now()); stale {
+		t.Fatal("client that never connected should not be stale")
+	}
+	c.Handle(packet.NewPacket(packet.Popularity, packet.HeartBeatResponse, []byte{0, 0, 0, 1}))
+	if _, stale := heartbeatStale(c, time.Now()); stale {
+		t.Fatal("stale right after a heartbeat reply")
+	}
+	// 业务消息不能代替心跳回复
+	later := time.Now().Add(staleHeartbeatTimeout + time.Second)
+	c.Handle(packet.NewPacket(packet.Plain, packet.Notification, []byte(`{"cmd":"DANMU_MSG","info":[]}`)))
+	if _, stale := heartbeatStale(c, later); !stale {
+		t.Fatal("want stale without heartbeat replies")
+	}
+}
@@ -7,9 +7,10 @@ import (
 // 下播输出
 func (w *wsHandler) sayGoodbyeByWs() {
 	// 下播输出
-	w.client.RegisterCustomEventHandler("PREPARING", func(s string) {
-		if len(w.svc.Config.GoodbyeInfo) > 0 {
-			logic.PushToBulletSender(w.svc.Config.GoodbyeInfo)
+	w.bus.SubscribeRaw("PREPARING", func(s string) {
+		c := w.svc.Config()
+		if len(c.GoodbyeInfo) > 0 {
+			logic.PushToBulletSender(w.svc, c.GoodbyeInfo)
 		}
 	})
 }
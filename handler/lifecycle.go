@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// SayGoodbye 等待下播弹幕发送的最长时间
+const goodbyeTimeout = 30 * time.Second
+
+// ErrShutdown 已经调用过 Shutdown，不能再启动或重载
+var ErrShutdown = errors.New("handler: already shut down")
+
+// State 生命周期状态
+type State int32
+
+const (
+	StateCreated  State = iota // 已创建，未启动
+	StateStarting              // 处理逻辑已启动，弹幕连接未建立
+	StateRunning               // 弹幕连接已建立
+	StateDraining              // 正在停止，等待发送队列清空和 goroutine 退出
+	StateStopped               // 已停止
+)
+
+func (s State) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateDraining:
+		return "draining"
+	case StateStopped:
+		return "stopped"
+	}
+	return fmt.Sprintf("State(%d)", int32(s))
+}
+
+type lifecycle struct {
+	state atomic.Int32
+}
+
+func (l *lifecycle) State() State {
+	return State(l.state.Load())
+}
+
+func (l *lifecycle) set(s State) {
+	l.state.Store(int32(s))
+}
+
+// transition 当前状态为 from 之一时切换到 to，否则返回 false
+func (l *lifecycle) transition(to State, from ...State) bool {
+	_, ok := l.enter(to, from...)
+	return ok
+}
+
+// enter 与 transition 相同，同时返回切换前的状态
+func (l *lifecycle) enter(to State, from ...State) (State, bool) {
+	for {
+		cur := l.state.Load()
+		ok := false
+		for _, f := range from {
+			if int32(f) == cur {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return State(cur), false
+		}
+		if l.state.CompareAndSwap(cur, int32(to)) {
+			return State(cur), true
+		}
+	}
+}
+
+// waitGroup 等待 wg 结束，ctx 取消时返回 ctx.Err()
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// State 直播间的生命周期状态
+func (w *wsHandler) State() State {
+	return w.life.State()
+}
+
+// goLogic 启动直播间的处理逻辑，Shutdown 时等待其退出
+func (w *wsHandler) goLogic(ctx context.Context, f func(ctx context.Context, svcCtx *svc.ServiceContext)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		f(ctx, w.svc)
+	}()
+}
+
+// goPipeline 与 goLogic 相同，同时记录在 pipelines 中，重启处理逻辑时等待其退出
+func (w *wsHandler) goPipeline(ctx context.Context, f func(ctx context.Context, svcCtx *svc.ServiceContext)) {
+	w.pipelines.Add(1)
+	w.goLogic(ctx, func(ctx context.Context, svcCtx *svc.ServiceContext) {
+		defer w.pipelines.Done()
+		f(ctx, svcCtx)
+	})
+}
+
+// logicRunning 弹幕发送等处理逻辑是否在运行
+func (w *wsHandler) logicRunning() bool {
+	switch w.life.State() {
+	case StateStarting, StateRunning, StateDraining:
+		return true
+	}
+	return false
+}
+
+// sayGoodbye 发送下播弹幕，queued 为 true 即处理逻辑在运行时加入发送队列，否则直接发送
+func (w *wsHandler) sayGoodbye(ctx context.Context, queued bool) {
+	c := w.svc.Config()
+	if len(c.GoodbyeInfo) == 0 {
+		return
+	}
+	if queued {
+		logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityReply, c.GoodbyeInfo)
+		return
+	}
+	for _, msgs := range logic.SplitBullet(c.GoodbyeInfo, logic.DanmuLenOf(w.svc)) {
+		if _, err := http.Send(msgs, w.svc); err != nil {
+			logx.Errorf("下播弹幕发送失败：%s msg: %s", err, msgs)
+		}
+		// 防止弹幕发送过快
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Shutdown 停止直播间：断开弹幕连接，发送下播弹幕并等待发送队列清空，再停止处理逻辑并等待所有 goroutine 退出
+// ctx 到期后不再等待，未发送的弹幕被丢弃，返回 ctx.Err()；重复调用直接返回
+func (w *wsHandler) Shutdown(ctx context.Context) error {
+	prev, ok := w.life.enter(StateDraining, StateCreated, StateStarting, StateRunning)
+	if !ok {
+		return nil
+	}
+	// 处理逻辑没有启动时下播弹幕直接发送
+	queued := prev != StateCreated && w.sendBulletCancel != nil
+	roomId := w.svc.Config().RoomId
+	defer w.life.set(StateStopped)
+	var errs []error
+	if w.client != nil {
+		w.client.Stop()
+	}
+	if w.watchCancel != nil {
+		w.watchCancel()
+	}
+	w.stopRecord()
+	cronCtx := w.corndanmu.Stop()
+	w.sayGoodbye(ctx, queued)
+	if queued {
+		if err := logic.FlushBulletSender(ctx, w.svc); err != nil {
+			errs = append(errs, fmt.Errorf("直播间 %v 弹幕未发送完：%w", roomId, err))
+		}
+	}
+	w.StopChanel()
+	if w.client != nil {
+		if err := w.client.Wait(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("直播间 %v 等待弹幕连接退出：%w", roomId, err))
+		}
+	}
+	if err := waitGroup(ctx, &w.wg); err != nil {
+		errs = append(errs, fmt.Errorf("直播间 %v 等待处理逻辑退出：%w", roomId, err))
+	}
+	select {
+	case <-cronCtx.Done():
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("直播间 %v 等待定时弹幕退出：%w", roomId, ctx.Err()))
+	}
+	return errors.Join(errs...)
+}
+
+// waitStopped 不限时地等待 Shutdown 超时后仍在运行的弹幕连接和处理逻辑退出
+func (w *wsHandler) waitStopped() {
+	if w.client != nil {
+		_ = w.client.Wait(context.Background())
+	}
+	w.wg.Wait()
+}
+
+// State 所有直播间整体的生命周期状态
+func (m *multiRoomHandler) State() State {
+	return m.life.State()
+}
+
+// Shutdown 停止所有直播间，等待所有 goroutine 和工作池中的任务结束后关闭数据库，之后不能再启动
+// ctx 到期后不再等待，返回 ctx.Err()，数据库同样关闭，仍在运行的任务访问数据库时返回错误
+func (m *multiRoomHandler) Shutdown(ctx context.Context) error {
+	m.locked.Lock()
+	if m.shutdown {
+		m.locked.Unlock()
+		return nil
+	}
+	m.shutdown = true
+	m.life.set(StateDraining)
+	defer m.life.set(StateStopped)
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.keepLoginCancel != nil {
+		m.keepLoginCancel()
+		m.keepLoginCancel = nil
+	}
+	m.stopWatchConfig()
+
+	var (
+		wg     sync.WaitGroup
+		errsMu sync.Mutex
+		errs   []error
+	)
+	for _, w := range m.rooms {
+		wg.Add(1)
+		go func(w *wsHandler) {
+			defer wg.Done()
+			if err := w.Shutdown(ctx); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, w := range m.rooms {
+		logic.RemoveRoom(w.svc)
+		danmu.RemoveRoom(w.svc)
+		for _, rs := range m.subscriptions {
+			rs.detach(w)
+		}
+	}
+	m.rooms = nil
+	m.logicStarted, m.clientStarted = false, false
+	// 监视配置文件的回调可能正在等待 m.locked，解锁后才能退出；之后的重载因 shutdown 直接返回
+	m.locked.Unlock()
+
+	if err := waitGroup(ctx, &m.wg); err != nil {
+		errs = append(errs, fmt.Errorf("等待登录检查和配置文件监视退出：%w", err))
+	}
+	if m.db != nil {
+		if err := svc.CloseDB(m.db); err != nil {
+			errs = append(errs, fmt.Errorf("关闭数据库失败：%w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
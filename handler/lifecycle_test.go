@@ -0,0 +1,300 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/conf"
+	"gorm.io/gorm"
+)
+
+func TestShutdownFlushesQueueAndSaysGoodbye(t *testing.T) {
+	ws, sender := newReplayRoom(t, replayConfig+"GoodbyeInfo: 下播啦\n")
+	if ws.State() != StateStarting {
+		t.Fatalf("state = %v", ws.State())
+	}
+	for _, msg := range []string{"第一条", "第二条", "第三条"} {
+		logic.PushToBulletSender(ws.svc, msg)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ws.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sender.Messages(), ","); got != "第一条,第二条,第三条,下播啦" {
+		t.Fatalf("sent = %s", got)
+	}
+	if ws.State() != StateStopped {
+		t.Fatalf("state = %v", ws.State())
+	}
+	// 重复调用不再发送
+	if err := ws.Shutdown(ctx); err != nil || len(sender.Messages()) != 4 {
+		t.Fatalf("second shutdown: %v, sent %q", err, sender.Messages())
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	ws, sender := newReplayRoom(t, replayConfig)
+	logic.PauseBulletSender(ws.svc, time.Hour)
+	logic.PushToBulletSender(ws.svc, "发不出去")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := ws.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if time.Since(start) > 2*time.Second || len(sender.Messages()) != 0 || ws.State() != StateStopped {
+		t.Fatalf("took %v, sent %q, state %v", time.Since(start), sender.Messages(), ws.State())
+	}
+}
+
+func TestMultiRoomShutdownClosesDB(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig)
+	m := &multiRoomHandler{db: ws.svc.Db, rooms: []*wsHandler{ws}, logicStarted: true}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.State() != StateStopped || ws.State() != StateStopped {
+		t.Fatalf("state = %v / %v", m.State(), ws.State())
+	}
+	if err := ws.svc.Db.Exec("SELECT 1").Error; err == nil {
+		t.Fatal("db still open")
+	}
+	if err := m.StartWsClient(); !errors.Is(err, ErrShutdown) {
+		t.Fatalf("start after shutdown: %v", err)
+	}
+}
+
+func TestMultiRoomShutdownWaitsForSlowJob(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig)
+	m := &multiRoomHandler{db: ws.svc.Db, rooms: []*wsHandler{ws}, logicStarted: true}
+	jobErr := make(chan error, 1)
+	ws.goLogic(context.Background(), func(_ context.Context, svcCtx *svc.ServiceContext) {
+		// 忽略取消、仍在访问数据库的任务
+		time.Sleep(300 * time.Millisecond)
+		jobErr <- svcCtx.Db.Exec("SELECT 1").Error
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-jobErr:
+		if err != nil {
+			t.Fatalf("job ran against a closed db: %v", err)
+		}
+	default:
+		t.Fatal("Shutdown returned before the slow job finished")
+	}
+
+	// 等待超时时同样关闭数据库，不留下打开的文件
+	ws, _ = newReplayRoom(t, replayConfig)
+	m = &multiRoomHandler{db: ws.svc.Db, rooms: []*wsHandler{ws}, logicStarted: true}
+	release := make(chan struct{})
+	defer close(release)
+	ws.goLogic(context.Background(), func(context.Context, *svc.ServiceContext) { <-release })
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer shortCancel()
+	if err := m.Shutdown(shortCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if err := ws.svc.Db.Exec("SELECT 1").Error; err == nil {
+		t.Fatal("db still open after the deadline")
+	}
+}
+
+func TestShutdownSaysGoodbyeWithoutLogic(t *testing.T) {
+	sender := http.NewFakeSender()
+	http.SetSendFunc(sender.Send)
+	t.Cleanup(func() { http.SetSendFunc(nil) })
+	var c config.Config
+	if err := conf.LoadFromYamlBytes([]byte(replayConfig+"GoodbyeInfo: 下播啦\n"), &c); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := newWsHandler(svc.NewRoomServiceContext(c, db))
+	t.Cleanup(func() {
+		logic.RemoveRoom(ws.svc)
+		danmu.RemoveRoom(ws.svc)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ws.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(sender.Messages(), ","); got != "下播啦" {
+		t.Fatalf("sent = %q", got)
+	}
+}
+
+func TestReloadConfigDiff(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig)
+	var events []*ConfigReloadEvent
+	ws.bus.Subscribe(EventConfigReloaded, func(e *client.Event) {
+		events = append(events, e.Data.(*ConfigReloadEvent))
+	})
+
+	// 只修改欢迎语，直接生效，不重启处理逻辑
+	sendCtx := ws.sendBulletCtx
+	c := *ws.svc.Config()
+	c.WelcomeDanmu = []string{"来了 {user}"}
+	if err := ws.reloadConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if ws.svc.Config().WelcomeDanmu[0] != "来了 {user}" || ws.sendBulletCtx != sendCtx || sendCtx.Err() != nil {
+		t.Fatal("hot change restarted the pipelines")
+	}
+	if len(events) != 1 || strings.Join(events[0].Changes.Fields(), ",") != "WelcomeDanmu" || events[0].Applied != 0 {
+		t.Fatalf("events = %+v", events)
+	}
+
+	// 配置没有变化时不发布事件
+	if err := ws.reloadConfig(c); err != nil || len(events) != 1 {
+		t.Fatalf("unchanged reload: %v, %d events", err, len(events))
+	}
+
+	// 礼物统计时间在启动时读取，需要重启处理逻辑；弹幕连接未建立，不重建
+	c.ThanksGiftTimeout = 5
+	c.RecordDir = t.TempDir()
+	if err := ws.reloadConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if sendCtx.Err() == nil || ws.sendBulletCtx == sendCtx {
+		t.Fatal("pipelines not restarted")
+	}
+	if len(events) != 2 || events[1].Applied != config.ReloadPipeline || events[1].Changes.Reload() != config.ReloadPipeline|config.ReloadConnection {
+		t.Fatalf("events = %+v", events[1])
+	}
+}
+
+func TestReloadConfigWaitsForOldPipelines(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig)
+	var finished atomic.Bool
+	ws.goPipeline(ws.sendBulletCtx, func(ctx context.Context, _ *svc.ServiceContext) {
+		<-ctx.Done()
+		// 取消后仍在处理最后一条弹幕
+		time.Sleep(200 * time.Millisecond)
+		finished.Store(true)
+	})
+	c := *ws.svc.Config()
+	c.DanmuRate = 5
+	if err := ws.reloadConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Fatal("new pipelines started before the old ones exited")
+	}
+}
+
+func TestReloadConfigRemovesRoom(t *testing.T) {
+	kept, sender := newReplayRoom(t, replayConfig)
+	removed := newTestRoom(t, strings.Replace(replayConfig, "RoomId: 1", "RoomId: 2", 1)+"GoodbyeInfo: 下播啦\n", nil)
+	m := &multiRoomHandler{rooms: []*wsHandler{kept, removed}, logicStarted: true}
+	logic.PauseBulletSender(removed.svc, 100*time.Millisecond)
+	logic.PushToBulletSender(removed.svc, "还没发")
+
+	c := *kept.svc.Config()
+	c.Rooms = []config.RoomConfig{{RoomId: 1}}
+	if err := m.applyConfig(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.rooms) != 1 || m.rooms[0] != kept {
+		t.Fatalf("rooms = %v", m.rooms)
+	}
+	// 移除前清空发送队列并发送下播弹幕
+	if got := strings.Join(sender.Messages(), ","); got != "还没发,下播啦" {
+		t.Fatalf("sent = %s", got)
+	}
+	if removed.State() != StateStopped || kept.State() != StateStarting {
+		t.Fatalf("state = %v / %v", removed.State(), kept.State())
+	}
+}
+
+func TestReloadConfigRejectsInvalid(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig)
+	m := &multiRoomHandler{rooms: []*wsHandler{ws}}
+	var events []*ConfigReloadEvent
+	ws.bus.Subscribe(EventConfigReloaded, func(e *client.Event) {
+		events = append(events, e.Data.(*ConfigReloadEvent))
+	})
+
+	// mustloadConfig 会在当前目录创建 token 目录
+	t.Chdir(t.TempDir())
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	t.Cleanup(func() { configFile = "etc/bilidanmaku-api.yaml" })
+	if err := os.WriteFile(configFile, []byte(replayConfig+"DanmuLen: 0\nWelcomeDanmu: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old := ws.svc.Config()
+	err := m.ReloadConfig()
+	var ve *config.ValidationError
+	if !errors.As(err, &ve) || len(ve.Errors) != 2 {
+		t.Fatalf("got %v", err)
+	}
+	if ws.svc.Config() != old {
+		t.Fatal("invalid config applied")
+	}
+	if len(events) != 1 || !errors.As(events[0].Err, &ve) || events[0].RoomID != 1 {
+		t.Fatalf("events = %+v", events)
+	}
+}
+
+func TestWatchConfigUsesLoader(t *testing.T) {
+	ws, _ := newReplayRoom(t, replayConfig+"ConfigWatch: 1\n")
+	m := &multiRoomHandler{db: ws.svc.Db, rooms: []*wsHandler{ws}}
+
+	// 与 ReloadConfig 一样经过 prepareConfig，会创建数据库目录
+	t.Chdir(t.TempDir())
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	t.Cleanup(func() { configFile = "etc/bilidanmaku-api.yaml" })
+	if err := os.WriteFile(configFile, []byte(replayConfig+"ConfigWatch: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m.startWatchConfig()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 0; ws.svc.Config().WelcomeDanmu[0] != "来了 {user}"; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("watcher did not reload")
+		}
+		yaml := fmt.Sprintf("%sConfigWatch: 1\nDBPath: ./watched\nWelcomeDanmu: [\"来了 {user}\"]\n# %d\n", replayConfig, i)
+		if err := os.WriteFile(configFile, []byte(yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if info, err := os.Stat("watched"); err != nil || !info.IsDir() {
+		t.Fatalf("DBPath not created by a watch reload: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.watchConfigCancel != nil {
+		t.Fatal("watcher still registered")
+	}
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/utiles"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// 等待扫码登录的最长时间，二维码本身约 3 分钟失效
+const qrLoginTimeout = 3 * time.Minute
+
+var (
+	loginPromptLocked sync.Mutex
+	loginPrompt       func(url string) error
+)
+
+// SetLoginPrompt 设置展示登录二维码的方式，未登录或登录失效且无法刷新时展示 url 对应的二维码并等待扫码
+// 为 nil 时不扫码，NewWsHandler 和发送弹幕直接返回登录失败，由界面通过 http.NewQRLoginSession 自行登录
+func SetLoginPrompt(show func(url string) error) {
+	loginPromptLocked.Lock()
+	loginPrompt = show
+	loginPromptLocked.Unlock()
+}
+
+// TerminalLoginPrompt 在终端显示登录二维码
+func TerminalLoginPrompt(url string) error {
+	return utiles.GenerateQr(url)
+}
+
+// userlogin 展示二维码并等待扫码登录，没有设置 SetLoginPrompt 时返回 http.ErrNotLogin
+func (m *multiRoomHandler) userlogin(ctx context.Context) error {
+	loginPromptLocked.Lock()
+	show := loginPrompt
+	loginPromptLocked.Unlock()
+	if show == nil {
+		return http.ErrNotLogin
+	}
+	session, err := http.NewQRLoginSession()
+	if err != nil {
+		logx.Error(err)
+		return err
+	}
+	if err = show(session.Url); err != nil {
+		logx.Error(err)
+		return err
+	}
+	logx.Info("等待扫码登录...")
+	ctx, cancel := context.WithTimeout(ctx, qrLoginTimeout)
+	defer cancel()
+	err = session.Poll(ctx, 3*time.Second, func(state http.QRLoginState) {
+		logx.Info(state)
+	})
+	if err != nil {
+		logx.Error(err)
+	}
+	return err
+}
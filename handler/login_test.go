@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/credential"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http/bilitest"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// newExpiredLogin 启动模拟的B站接口，保存的登录已经失效，也没有 refresh_token 可以刷新
+func newExpiredLogin(t *testing.T) *bilitest.Server {
+	t.Helper()
+	logx.Disable()
+	srv := bilitest.NewServer()
+	t.Cleanup(srv.Close)
+	http.SetBaseURL(srv.URL)
+	t.Cleanup(func() { http.SetBaseURL("") })
+	http.InitHttpClient()
+	oldStr, oldList := http.Cookie(), http.Cookies()
+	t.Cleanup(func() { http.SetCookies(oldStr, oldList) })
+	store, err := credential.NewFileStore(filepath.Join(t.TempDir(), "credentials"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.SetDefault(store)
+	t.Cleanup(func() { credential.SetDefault(nil) })
+	_ = credential.Set(credential.KeyBiliCookie, "SESSDATA=expired;")
+	_ = credential.Set(credential.KeyBiliCookieList, `{"SESSDATA":"expired"}`)
+	return srv
+}
+
+func TestReloginByQR(t *testing.T) {
+	srv := newExpiredLogin(t)
+	m := &multiRoomHandler{}
+	if err := m.relogin(context.Background()); !errors.Is(err, http.ErrNotLogin) {
+		t.Fatalf("without login prompt want ErrNotLogin, got %v", err)
+	}
+
+	var shown string
+	SetLoginPrompt(func(url string) error {
+		shown = url
+		srv.ScanQR(42, "机器人")
+		return nil
+	})
+	t.Cleanup(func() { SetLoginPrompt(nil) })
+	if err := m.relogin(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if shown == "" {
+		t.Fatal("login QR code not shown")
+	}
+	if uid, _ := http.CookieValue("DedeUserID"); uid != "42" {
+		t.Errorf("DedeUserID = %q, want 42", uid)
+	}
+	if saved, _ := credential.Get(credential.KeyBiliCookie); saved != http.Cookie() {
+		t.Errorf("saved cookie %q, want %q", saved, http.Cookie())
+	}
+}
+
+// newAuthExpiredRoom 第一条弹幕返回登录失效，之后发送成功；重新登录使用 m 的生命周期
+func newAuthExpiredRoom(t *testing.T) (*multiRoomHandler, *wsHandler, *http.FakeSender, chan error) {
+	t.Helper()
+	ws, sender := newReplayRoom(t, replayConfig)
+	var calls atomic.Int32
+	sender.Result = func(string) *http.SendResult {
+		if calls.Add(1) == 1 {
+			return &http.SendResult{Status: http.SendAuthExpired, Code: -101}
+		}
+		return &http.SendResult{Status: http.SendAccepted}
+	}
+	m := &multiRoomHandler{rooms: []*wsHandler{ws}}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	t.Cleanup(m.cancel)
+	done := make(chan error, 1)
+	logic.SetReloginHook(func() error {
+		err := m.relogin(m.lifeContext())
+		done <- err
+		return err
+	})
+	t.Cleanup(func() { logic.SetReloginHook(nil) })
+	return m, ws, sender, done
+}
+
+func TestReloginResumesSending(t *testing.T) {
+	srv := newExpiredLogin(t)
+	SetLoginPrompt(func(string) error {
+		srv.ScanQR(42, "机器人")
+		return nil
+	})
+	t.Cleanup(func() { SetLoginPrompt(nil) })
+	_, ws, sender, done := newAuthExpiredRoom(t)
+
+	logic.PushToBulletSender(ws.svc, "第一条")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-ctx.Done():
+		t.Fatal("relogin not started")
+	}
+	// 重新登录成功后不必等到暂停结束
+	if _, err := sender.Wait(ctx, 1); err != nil {
+		t.Fatalf("sending not resumed after relogin: %v", err)
+	}
+}
+
+func TestShutdownCancelsRelogin(t *testing.T) {
+	newExpiredLogin(t)
+	shown := make(chan struct{}, 1)
+	// 展示二维码后一直没有扫码
+	SetLoginPrompt(func(string) error {
+		shown <- struct{}{}
+		return nil
+	})
+	t.Cleanup(func() { SetLoginPrompt(nil) })
+	m, ws, _, done := newAuthExpiredRoom(t)
+
+	logic.PushToBulletSender(ws.svc, "第一条")
+	select {
+	case <-shown:
+	case <-time.After(10 * time.Second):
+		t.Fatal("login QR code not shown")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	// 弹幕因登录失效暂停，等待扫码不占用发送弹幕的 goroutine，Shutdown 在期限内返回
+	start := time.Now()
+	_ = m.Shutdown(ctx)
+	if d := time.Since(start); d > 3*time.Second {
+		t.Fatalf("Shutdown took %v", d)
+	}
+	if ws.State() != StateStopped {
+		t.Fatalf("state = %v", ws.State())
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("relogin err = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not cancel relogin")
+	}
+}
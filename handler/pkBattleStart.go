@@ -9,35 +9,37 @@ import (
 )
 
 func (w *wsHandler) pkBattleStart() {
-	w.client.RegisterCustomEventHandler("PK_BATTLE_START_NEW", func(s string) {
+	w.bus.SubscribeRaw("PK_BATTLE_START_NEW", func(s string) {
 		pkbattlestartfunc(w.svc, s)
 	})
-	w.client.RegisterCustomEventHandler("PK_BATTLE_START", func(s string) {
+	w.bus.SubscribeRaw("PK_BATTLE_START", func(s string) {
 		pkbattlestartfunc(w.svc, s)
 	})
 }
 func pkbattlestartfunc(svcCtx *svc.ServiceContext, s string) {
-	if svcCtx.Config.PKNotice {
-		info := &entity.PKStartInfo{}
-		roomid := 0
-		err := json.Unmarshal([]byte(s), info)
-		if err != nil {
-			logx.Error(err)
-			logx.Errorf("pk数据解析失败:%s", string(s))
-			return
-		}
-		if info.Data.InitInfo.RoomId == svcCtx.Config.RoomId {
-			roomid = info.Data.MatchInfo.RoomId
-		} else {
-			roomid = info.Data.InitInfo.RoomId
-		}
-		logx.Debug("开始pk")
+	c := svcCtx.Config()
+	info := &entity.PKStartInfo{}
+	roomid := 0
+	err := json.Unmarshal([]byte(s), info)
+	if err != nil {
+		logx.Error(err)
+		logx.Errorf("pk数据解析失败:%s", string(s))
+		return
+	}
+	if info.Data.InitInfo.RoomId == c.RoomId {
+		roomid = info.Data.MatchInfo.RoomId
+	} else {
+		roomid = info.Data.InitInfo.RoomId
+	}
+	logx.Debug("开始pk")
+	if roomid == 0 {
+		logx.Error("未获取的pk对手信息")
+		return
+	}
+	// 不开启 PK 提醒时也记录对手，机器人可以查询
+	svcCtx.PK.Start(roomid)
+	if c.PKNotice {
 		//go handlerPK(svcCtx, body)
-		if roomid == 0 {
-			logx.Error("未获取的pk对手信息")
-		} else {
-			logic.PushToPKChan(&roomid)
-		}
-
+		logic.PushToPKChan(svcCtx, &roomid)
 	}
 }
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/message"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
 	"sync"
 )
@@ -9,9 +11,13 @@ import (
 func (w *wsHandler) receiveDanmu() {
 	//弹幕处理的功能类接口
 	locked := new(sync.Mutex)
-	w.client.RegisterCustomEventHandler("DANMU_MSG", func(s string) {
+	w.bus.Subscribe("DANMU_MSG", func(e *client.Event) {
+		if e.Err != nil {
+			danmu.ReportMalformed(w.svc, e.Err)
+			return
+		}
 		locked.Lock()
-		danmu.PushToBDanmuLogic(s)
+		danmu.PushToBDanmuLogic(w.svc, e.Data.(*message.Danmaku))
 		locked.Unlock()
 	})
 }
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+func TestRedPocketRestoresWelcome(t *testing.T) {
+	ws, sender := newReplayRoom(t, replayConfig)
+	publish := func(cmd, body string) {
+		ws.bus.Publish(&client.Event{Cmd: cmd, Body: []byte(body)})
+	}
+	publish("POPULARITY_RED_POCKET_NEW", `{"cmd":"POPULARITY_RED_POCKET_NEW","data":{"uname":"老王","price":20,"gift_name":"红包"}}`)
+	if ws.svc.Enabled(svc.ToggleInteractWord) || ws.svc.Enabled(svc.ToggleLottery) {
+		t.Fatal("welcome not suppressed during red pocket")
+	}
+	publish("POPULARITY_RED_POCKET_WINNER_LIST", `{"cmd":"POPULARITY_RED_POCKET_WINNER_LIST","data":{"winner_info":[]}}`)
+	// 红包结束后恢复为配置文件中的值，而不是关闭
+	if !ws.svc.Enabled(svc.ToggleInteractWord) || ws.svc.Enabled(svc.ToggleEntryEffect) {
+		t.Fatal("welcome not restored to config")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := sender.Wait(ctx, 3)
+	if err != nil {
+		t.Fatalf("sent %q: %v", got, err)
+	}
+	if got[1] != "识别到红包，欢迎弹幕已临时关闭" || got[2] != "红包结束，欢迎弹幕已恢复默认" {
+		t.Fatalf("sent %q", got)
+	}
+}
+
+func TestRedPocketThanksGiftPriority(t *testing.T) {
+	ws, sender := newReplayRoom(t, replayConfig)
+	// 暂停期间排队，恢复后按优先级发送
+	logic.PauseBulletSender(ws.svc, 300*time.Millisecond)
+	logic.PushToBulletSender(ws.svc, "普通回复")
+	ws.bus.Publish(&client.Event{
+		Cmd:  "POPULARITY_RED_POCKET_NEW",
+		Body: []byte(`{"cmd":"POPULARITY_RED_POCKET_NEW","data":{"uname":"老王","price":20,"gift_name":"红包"}}`),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := sender.Wait(ctx, 3)
+	if err != nil {
+		t.Fatalf("sent %q: %v", got, err)
+	}
+	if got[0] != "感谢 老王 20电池的 红包" || got[1] != "普通回复" {
+		t.Fatalf("sent %q", got)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// EventConfigReloaded 直播间配置发生变化并重载后，在直播间的事件总线上发布，Data 为 *ConfigReloadEvent
+const EventConfigReloaded = "CONFIG_RELOADED"
+
+// ConfigReloadEvent 一次配置重载的结果，配置校验失败时 Changes 为空，Err 为 *config.ValidationError
+type ConfigReloadEvent struct {
+	RoomID  int
+	Changes config.Diff   // 发生变化的配置项
+	Applied config.Reload // 实际执行的重启，处理逻辑或弹幕连接未启动时不重启
+	Err     error
+}
+
+// reloadConfig 对比新旧配置，新配置原子替换后立即生效；只有处理逻辑相关的配置变化时才重启处理逻辑，
+// 只有连接参数变化时才重建弹幕连接；需要重新启动才能生效的配置项保留之前的值
+func (ws *wsHandler) reloadConfig(c config.Config) error {
+	old := ws.svc.Config()
+	if kept := config.RetainRestart(old, &c); len(kept) > 0 {
+		logx.Errorf("直播间 %v 配置项 %s 修改后需要重新启动才能生效，继续使用之前的值", c.RoomId, strings.Join(kept, ", "))
+	}
+	diff := config.Compare(old, &c)
+	if len(diff) == 0 {
+		return nil
+	}
+	ws.svc.SetConfig(&c)
+	logx.Infof("直播间 %v 配置发生变化：%v", c.RoomId, diff)
+
+	reload := diff.Reload()
+	var applied config.Reload
+	var errs []error
+	if reload&config.ReloadPipeline != 0 && ws.logicRunning() {
+		logx.Infof("直播间 %v 重启处理逻辑", c.RoomId)
+		ws.stopPipelines()
+		// 旧的发送、感谢等循环与新的共用同一个直播间的队列，全部退出后再启动
+		ws.pipelines.Wait()
+		ws.startPipelines()
+		for _, i := range ws.corndanmu.Entries() {
+			ws.corndanmu.Remove(i.ID)
+		}
+		ws.corndanmuStart()
+		applied |= config.ReloadPipeline
+	}
+	if reload&config.ReloadConnection != 0 && ws.State() == StateRunning {
+		logx.Infof("直播间 %v 重建弹幕连接", c.RoomId)
+		ws.stopConnection()
+		if err := ws.startConnection(); err != nil {
+			errs = append(errs, fmt.Errorf("直播间 %v 弹幕连接失败：%w", c.RoomId, err))
+		}
+		applied |= config.ReloadConnection
+	}
+	err := errors.Join(errs...)
+	ws.bus.Publish(&client.Event{
+		Cmd:  EventConfigReloaded,
+		Data: &ConfigReloadEvent{RoomID: c.RoomId, Changes: diff, Applied: applied, Err: err},
+	})
+	return err
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http/bilitest"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/conf"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+)
+
+const replayConfig = `
+RoomId: 1
+DanmuLen: 20
+DanmuRate: 100
+DanmuBurst: 100
+DanmuMergeWindow: 0
+InteractWord: true
+WelcomeDanmu: ["欢迎 {user} ~"]
+ThanksFocus: true
+ThanksGift: true
+ThanksGiftTimeout: 1
+`
+
+// newTestRoom 创建不访问网络的直播间，B 站接口使用 bili
+func newTestRoom(t *testing.T, yaml string, bili svc.BiliAPI) *wsHandler {
+	t.Helper()
+	logx.Disable()
+	var c config.Config
+	if err := conf.LoadFromYamlBytes([]byte(yaml), &c); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := svc.NewRoomServiceContext(c, db)
+	ctx.Bili = bili
+	ws := newWsHandler(ctx)
+	ws.startLogic()
+	t.Cleanup(func() {
+		ws.StopChanel()
+		logic.RemoveRoom(ws.svc)
+		danmu.RemoveRoom(ws.svc)
+	})
+	return ws
+}
+
+// newReplayRoom 创建不访问网络的直播间，发送的弹幕记录在返回的 FakeSender 中
+func newReplayRoom(t *testing.T, yaml string) (*wsHandler, *http.FakeSender) {
+	t.Helper()
+	sender := http.NewFakeSender()
+	http.SetSendFunc(sender.Send)
+	t.Cleanup(func() { http.SetSendFunc(nil) })
+	return newTestRoom(t, yaml, nil), sender
+}
+
+// replay 用录制文件代替弹幕连接，等待消息全部交给直播间处理
+func replay(t *testing.T, ws *wsHandler, path string) {
+	t.Helper()
+	r, err := client.OpenReplayer(ws.svc.Config().RoomId, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.source = func(int) client.Source { return r }
+	if err = ws.startConnection(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ws.stopConnection)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err = ws.client.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplayWelcomeAndGiftThanks(t *testing.T) {
+	ws, sender := newReplayRoom(t, replayConfig)
+	replay(t, ws, "testdata/replay/welcome_gift.jsonl")
+
+	want := []string{
+		"欢迎 小明 ~",
+		"欢迎 小红 ~",
+		"感谢 路人甲 的关注!",
+		"感谢老王的8个小心心",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := sender.Wait(ctx, len(want))
+	if err != nil {
+		t.Fatalf("sent %q: %v", got, err)
+	}
+	// 礼物感谢在统计周期结束后才发送，再等一个周期确认没有多余的弹幕
+	extraCtx, extraCancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer extraCancel()
+	if got, err = sender.Wait(extraCtx, len(want)+1); err == nil {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sent %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReplayPKWithFakeServer(t *testing.T) {
+	srv := bilitest.NewServer()
+	defer srv.Close()
+	srv.AddRoom(bilitest.Room{
+		RoomID:      200,
+		Uid:         77,
+		Uname:       "对手",
+		FollowerNum: 1234,
+		Guards:      []bilitest.Guard{{Uid: 301}, {Uid: 302}, {Uid: 303}},
+		Rank: []bilitest.RankUser{
+			{Uid: 301, Score: 100, GuardLevel: 3},
+			{Uid: 401, Score: 50},
+			{Uid: 402, Score: 25},
+		},
+	})
+	ws := newTestRoom(t, replayConfig, http.NewBiliClient(srv.URL))
+	replay(t, ws, "testdata/replay/pk.jsonl")
+
+	want := []string{
+		"当前对手:对手",
+		"共3船，1234粉",
+		"当前1船在线，高能榜3人",
+		"榜前50贡献175分",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := srv.Wait(ctx, 1, len(want))
+	if err != nil {
+		t.Fatalf("sent %q: %v", got, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sent %q, want %q", got, want)
+		}
+	}
+	if !ws.svc.OtherSideUid[401] {
+		t.Error("rank users of the opponent should be recorded")
+	}
+}
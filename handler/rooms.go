@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/api"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/logic/danmu"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+)
+
+// 检查 cookie 是否需要刷新的间隔
+const keepLoginInterval = 6 * time.Hour
+
+// multiRoomHandler 同时接管多个直播间
+type multiRoomHandler struct {
+	db       *gorm.DB
+	roomList []config.RoomConfig // NewWsHandler 指定的直播间，为空时每次从配置文件读取
+	rooms    []*wsHandler
+	locked   sync.Mutex
+	// 生命周期 context，Shutdown 时取消，中断正在等待扫码的重新登录
+	ctx    context.Context
+	cancel context.CancelFunc
+	// 重新登录与直播间的启停分开加锁，避免发送弹幕的 goroutine 等待启停
+	reloginLocked sync.Mutex
+	lastRelogin   time.Time
+	// 定期检查登录状态
+	keepLoginCancel context.CancelFunc
+	// 不属于任何直播间的后台 goroutine，Shutdown 时等待其退出后再关闭数据库
+	wg sync.WaitGroup
+	// 监视配置文件变化
+	watchConfigCancel context.CancelFunc
+	// 记录启动状态，重载配置时新增的直播间按同样的状态启动
+	logicStarted  bool
+	clientStarted bool
+	// 外部模块的订阅，新增的直播间同样订阅
+	subscriptions []*roomSubscription
+	// 生命周期状态，Shutdown 之后不能再启动
+	life     lifecycle
+	shutdown bool
+}
+
+// roomSubscription 一个外部订阅在各直播间事件总线上的订阅句柄
+type roomSubscription struct {
+	cmd     string
+	handler RoomEventHandler
+	opts    []client.SubscribeOption
+	subs    map[*wsHandler]*client.Subscription
+}
+
+func (rs *roomSubscription) attach(w *wsHandler) {
+	svcCtx := w.svc
+	rs.subs[w] = w.bus.Subscribe(rs.cmd, func(e *client.Event) {
+		rs.handler(svcCtx, e)
+	}, rs.opts...)
+}
+
+func (rs *roomSubscription) detach(w *wsHandler) {
+	rs.subs[w].Unsubscribe()
+	delete(rs.subs, w)
+}
+
+func (m *multiRoomHandler) InitStartWsClient() {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	if m.shutdown {
+		return
+	}
+	for _, w := range m.rooms {
+		w.InitStartWsClient()
+	}
+	if m.keepLoginCancel == nil {
+		var ctx context.Context
+		ctx, m.keepLoginCancel = context.WithCancel(context.Background())
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			http.KeepLogin(ctx, keepLoginInterval)
+		}()
+	}
+	m.startWatchConfig()
+	m.logicStarted = true
+	m.life.transition(StateStarting, StateCreated, StateStopped)
+}
+
+func (m *multiRoomHandler) StartWsClient() error {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	if m.shutdown {
+		return ErrShutdown
+	}
+	var errs []error
+	for _, w := range m.rooms {
+		if err := w.StartWsClient(); err != nil {
+			logx.Errorf("直播间 %v 弹幕连接失败：%v", w.svc.Config().RoomId, err)
+			errs = append(errs, err)
+		}
+	}
+	m.clientStarted = true
+	m.life.transition(StateRunning, StateCreated, StateStarting)
+	return errors.Join(errs...)
+}
+
+func (m *multiRoomHandler) StopWsClient() {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	for _, w := range m.rooms {
+		w.StopWsClient()
+	}
+	m.clientStarted = false
+	m.life.transition(StateStarting, StateRunning)
+}
+
+func (m *multiRoomHandler) SayGoodbye() {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	for _, w := range m.rooms {
+		w.SayGoodbye()
+	}
+}
+
+func (m *multiRoomHandler) StopChanel() {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	for _, w := range m.rooms {
+		w.StopChanel()
+	}
+	if m.keepLoginCancel != nil {
+		m.keepLoginCancel()
+		m.keepLoginCancel = nil
+	}
+	m.stopWatchConfig()
+	m.logicStarted = false
+	m.life.transition(StateStopped, StateCreated, StateStarting, StateRunning)
+}
+
+// ReloadConfig 重新加载配置，按房间号对比：已有的直播间重载，新增的直播间启动，移除的直播间停止
+// 配置文件格式错误或校验失败时不做任何修改，返回的错误可以用 errors.As 取出 *config.ValidationError
+func (m *multiRoomHandler) ReloadConfig() error {
+	c, err := mustloadConfig()
+	if err != nil {
+		m.rejectConfig(err)
+		return err
+	}
+	return m.applyConfig(c)
+}
+
+// startWatchConfig 开始监视配置文件，文件变化后自动重载
+func (m *multiRoomHandler) startWatchConfig() {
+	if m.watchConfigCancel != nil || len(m.rooms) == 0 {
+		return
+	}
+	interval := m.rooms[0].svc.Config().ConfigWatch
+	if interval <= 0 {
+		return
+	}
+	var ctx context.Context
+	ctx, m.watchConfigCancel = context.WithCancel(context.Background())
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		config.Watch(ctx, configFile, time.Duration(interval)*time.Second, func(c config.Config) {
+			logx.Infof("配置文件发生变化，重新加载")
+			if err := prepareConfig(&c); err != nil {
+				m.rejectConfig(err)
+				return
+			}
+			if err := m.applyConfig(c); err != nil && !errors.Is(err, ErrShutdown) {
+				logx.Errorf("重新加载配置失败：%v", err)
+			}
+		}, m.rejectConfig)
+	}()
+}
+
+func (m *multiRoomHandler) stopWatchConfig() {
+	if m.watchConfigCancel != nil {
+		m.watchConfigCancel()
+		m.watchConfigCancel = nil
+	}
+}
+
+// rejectConfig 配置错误时记录日志，并在所有直播间发布重载失败事件，各直播间继续使用之前的配置
+func (m *multiRoomHandler) rejectConfig(err error) {
+	logx.Errorf("配置文件错误，继续使用之前的配置：%v", err)
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	for _, w := range m.rooms {
+		w.bus.Publish(&client.Event{
+			Cmd:  EventConfigReloaded,
+			Data: &ConfigReloadEvent{RoomID: w.svc.Config().RoomId, Err: err},
+		})
+	}
+}
+
+// applyConfig 应用已经校验过的配置
+func (m *multiRoomHandler) applyConfig(c config.Config) error {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	if m.shutdown {
+		return ErrShutdown
+	}
+	http.SetBaseURL(c.BiliAPIBase)
+	api.SetBaseURL(c.BiliAPIBase)
+
+	roomList := m.roomList
+	if len(roomList) == 0 {
+		roomList = c.RoomList()
+	}
+	old := make(map[int]*wsHandler, len(m.rooms))
+	for _, w := range m.rooms {
+		old[w.svc.Config().RoomId] = w
+	}
+	var rooms []*wsHandler
+	var errs []error
+	for _, room := range roomList {
+		rc, err := c.ForRoom(room)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if w, ok := old[rc.RoomId]; ok {
+			delete(old, rc.RoomId)
+			if err = w.reloadConfig(rc); err != nil {
+				errs = append(errs, err)
+			}
+			rooms = append(rooms, w)
+			continue
+		}
+		logx.Infof("新增直播间：%v", rc.RoomId)
+		w, err := newRoomHandler(c, room, m.db)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if m.logicStarted {
+			w.InitStartWsClient()
+		}
+		if m.clientStarted {
+			if err = w.StartWsClient(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		rooms = append(rooms, w)
+	}
+	var removed []*wsHandler
+	for roomId, w := range old {
+		logx.Infof("移除直播间：%v", roomId)
+		removed = append(removed, w)
+	}
+	m.removeRooms(removed)
+	m.rooms = rooms
+	return errors.Join(errs...)
+}
+
+// removeRooms 停止配置中移除的直播间：与整体 Shutdown 相同地发送下播弹幕、清空发送队列并等待 goroutine 退出，
+// 数据库由其他直播间共用，不关闭；等待超时的直播间在 goroutine 全部退出后再释放处理管线
+func (m *multiRoomHandler) removeRooms(rooms []*wsHandler) {
+	var wg sync.WaitGroup
+	for _, w := range rooms {
+		for _, rs := range m.subscriptions {
+			rs.detach(w)
+		}
+		wg.Add(1)
+		go func(w *wsHandler) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), goodbyeTimeout)
+			defer cancel()
+			err := w.Shutdown(ctx)
+			if err == nil {
+				logic.RemoveRoom(w.svc)
+				danmu.RemoveRoom(w.svc)
+				return
+			}
+			logx.Errorf("移除直播间 %v：%v", w.svc.Config().RoomId, err)
+			m.wg.Add(1)
+			go func() {
+				defer m.wg.Done()
+				w.waitStopped()
+				logic.RemoveRoom(w.svc)
+				danmu.RemoveRoom(w.svc)
+			}()
+		}(w)
+	}
+	wg.Wait()
+}
+
+// GetSvc 返回第一个直播间的上下文
+func (m *multiRoomHandler) GetSvc() svc.ServiceContext {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	if len(m.rooms) == 0 {
+		return svc.ServiceContext{}
+	}
+	return *m.rooms[0].svc
+}
+
+// GetRoomSvcs 返回所有直播间的上下文
+func (m *multiRoomHandler) GetRoomSvcs() []svc.ServiceContext {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	svcs := make([]svc.ServiceContext, 0, len(m.rooms))
+	for _, w := range m.rooms {
+		svcs = append(svcs, *w.svc)
+	}
+	return svcs
+}
+
+func (m *multiRoomHandler) GetUserinfo() *entity.UserinfoLite {
+	return http.GetUserInfo()
+}
+
+// Subscribe 在所有直播间订阅弹幕事件，重载配置新增的直播间也会订阅
+func (m *multiRoomHandler) Subscribe(cmd string, handler RoomEventHandler, opts ...client.SubscribeOption) func() {
+	m.locked.Lock()
+	defer m.locked.Unlock()
+	rs := &roomSubscription{
+		cmd:     cmd,
+		handler: handler,
+		opts:    opts,
+		subs:    make(map[*wsHandler]*client.Subscription),
+	}
+	for _, w := range m.rooms {
+		rs.attach(w)
+	}
+	m.subscriptions = append(m.subscriptions, rs)
+	return func() {
+		m.locked.Lock()
+		defer m.locked.Unlock()
+		for i, s := range m.subscriptions {
+			if s == rs {
+				m.subscriptions = append(m.subscriptions[:i], m.subscriptions[i+1:]...)
+				break
+			}
+		}
+		for w := range rs.subs {
+			rs.detach(w)
+		}
+	}
+}
@@ -12,42 +12,43 @@ import (
 
 // 礼物感谢
 func (w *wsHandler) thankGifts() {
-	w.client.RegisterCustomEventHandler("SEND_GIFT", func(s string) {
+	w.bus.SubscribeRaw("SEND_GIFT", func(s string) {
 		send := &entity.SendGiftText{}
 		_ = json.Unmarshal([]byte(s), send)
-		if w.svc.Config.ThanksGift {
-			logic.PushToGiftChan(send)
+		if w.svc.Config().ThanksGift {
+			logic.PushToGiftChan(w.svc, send)
 		}
 		danmu.SaveBlindBoxStat(send, w.svc)
 	})
-	w.client.RegisterCustomEventHandler("GUARD_BUY", func(s string) {
-		if w.svc.Config.ThanksGift {
+	w.bus.SubscribeRaw("GUARD_BUY", func(s string) {
+		c := w.svc.Config()
+		if c.ThanksGift {
 			send := &entity.GuardBuyText{}
 			_ = json.Unmarshal([]byte(s), send)
-			if w.svc.Config.ThanksGiftUseAt {
-				logic.PushToGuardChan(send, &entity.DanmuMsgTextReplyInfo{
+			if c.ThanksGiftUseAt {
+				logic.PushToGuardChan(w.svc, send, &entity.DanmuMsgTextReplyInfo{
 					ReplyUid: strconv.Itoa(send.Data.Uid),
 				})
 			} else {
-				logic.PushToGuardChan(send)
+				logic.PushToGuardChan(w.svc, send)
 			}
 		}
 	})
 
-	w.client.RegisterCustomEventHandler("COMMON_NOTICE_DANMAKU", func(s string) {
-		if w.svc.Config.ThanksGift {
+	w.bus.SubscribeRaw("COMMON_NOTICE_DANMAKU", func(s string) {
+		if w.svc.Config().ThanksGift {
 			data := &entity.CommonNoticeDanmaku{}
 			_ = json.Unmarshal([]byte(s), data)
 			if len(data.Data.ContentSegments) == 5 &&
 				data.Data.ContentSegments[1].Text == "投喂" &&
 				data.Data.ContentSegments[2].Text == "大航海盲盒" {
 
-				logic.PushToBulletSender(fmt.Sprintf("感谢 %s 的 %s", data.Data.ContentSegments[0].Text, data.Data.ContentSegments[4].Text))
+				logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityGift, fmt.Sprintf("感谢 %s 的 %s", data.Data.ContentSegments[0].Text, data.Data.ContentSegments[4].Text))
 			} else if len(data.Data.ContentSegments) == 6 &&
 				data.Data.ContentSegments[2].Text == "投喂" &&
 				data.Data.ContentSegments[3].Text == "大航海盲盒" {
 
-				logic.PushToBulletSender(fmt.Sprintf("感谢 %s 的 %s", data.Data.ContentSegments[1].Text, data.Data.ContentSegments[5].Text))
+				logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityGift, fmt.Sprintf("感谢 %s 的 %s", data.Data.ContentSegments[1].Text, data.Data.ContentSegments[5].Text))
 			}
 		}
 	})
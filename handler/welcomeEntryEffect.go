@@ -15,24 +15,25 @@ import (
 
 // 进场特效欢迎
 func (w *wsHandler) welcomeEntryEffect() {
-	w.client.RegisterCustomEventHandler("ENTRY_EFFECT", func(s string) {
+	w.bus.SubscribeRaw("ENTRY_EFFECT", func(s string) {
+		c := w.svc.Config()
 		entry := &entity.EntryEffectText{}
 		_ = json.Unmarshal([]byte(s), entry)
 
-		if !w.svc.Config.InteractSelf && strconv.Itoa(int(entry.Data.Uid)) == w.svc.RobotID {
+		if !c.InteractSelf && strconv.Itoa(int(entry.Data.Uid)) == w.svc.RobotID {
 			return
 		}
-		if !w.svc.Config.InteractAnchor && entry.Data.Uid == w.svc.UserID {
+		if !c.InteractAnchor && entry.Data.Uid == w.svc.UserID {
 			return
 		}
 
-		if v, ok := w.svc.Config.WelcomeString[fmt.Sprint(entry.Data.Uid)]; w.svc.Config.WelcomeSwitch && ok && w.svc.Config.EntryEffect {
-			//logic.PushToBulletSender(v)
-			logic.PushToInterractChan(&logic.InterractData{
+		if v, ok := c.WelcomeString[fmt.Sprint(entry.Data.Uid)]; c.WelcomeSwitch && ok && w.svc.Enabled(svc.ToggleEntryEffect) {
+			//logic.PushToBulletSender(w.svc, v)
+			logic.PushToInterractChan(w.svc, &logic.InterractData{
 				Uid: entry.Data.Uid,
 				Msg: v,
 			})
-		} else if w.svc.Config.EntryEffect {
+		} else if w.svc.Enabled(svc.ToggleEntryEffect) {
 			logx.Info("特效欢迎")
 
 			level := ""
@@ -50,8 +51,8 @@ func (w *wsHandler) welcomeEntryEffect() {
 			msg := ""
 			if len(level) > 0 {
 				msg = fmt.Sprintf("%s %s", level, entry.Data.Uinfo.Base.Name)
-			} else if w.svc.Config.WelcomeHighWealthy {
-				if entry.Data.Uinfo.Wealth.Level >= w.svc.Config.WelcomeHighWealthyLevel {
+			} else if w.svc.Enabled(svc.ToggleWelcomeHighWealthy) {
+				if entry.Data.Uinfo.Wealth.Level >= c.WelcomeHighWealthyLevel {
 					msg = entry.Data.Uinfo.Base.Name
 				}
 			}
@@ -59,9 +60,10 @@ func (w *wsHandler) welcomeEntryEffect() {
 			logx.Info(msg)
 
 			if len(msg) > 0 {
-				logic.PushToInterractChan(&logic.InterractData{
-					Uid: entry.Data.Uid,
-					Msg: getRandomWelcome(msg, w.svc),
+				logic.PushToInterractChan(w.svc, &logic.InterractData{
+					Uid:   entry.Data.Uid,
+					Uname: entry.Data.Uinfo.Base.Name,
+					Msg:   getRandomWelcome(msg, w.svc),
 				})
 			}
 		}
@@ -103,29 +105,30 @@ func getRandomDanmuKeyByTime() (key string) {
 	return key
 }
 func getRandomWelcome(msg string, svcCtx *svc.ServiceContext) string {
+	c := svcCtx.Config()
 	s := ""
 	content := msg
-	if svcCtx.Config.InteractWordByTime &&
-		svcCtx.Config.WelcomeDanmuByTime != nil &&
-		len(svcCtx.Config.WelcomeDanmuByTime) > 0 {
+	if c.InteractWordByTime &&
+		c.WelcomeDanmuByTime != nil &&
+		len(c.WelcomeDanmuByTime) > 0 {
 
 		key := getRandomDanmuKeyByTime()
 
-		for _, danmuCfg := range svcCtx.Config.WelcomeDanmuByTime {
+		for _, danmuCfg := range c.WelcomeDanmuByTime {
 			if danmuCfg.Key == key {
 				if danmuCfg.Enabled && len(danmuCfg.Danmu) > 0 {
 					s = danmuCfg.Danmu[rand.Intn(len(danmuCfg.Danmu))]
 				} else {
-					s = svcCtx.Config.WelcomeDanmu[rand.Intn(len(svcCtx.Config.WelcomeDanmu))]
+					s = c.WelcomeDanmu[rand.Intn(len(c.WelcomeDanmu))]
 				}
 				break
 			}
 		}
 	} else {
-		s = svcCtx.Config.WelcomeDanmu[rand.Intn(len(svcCtx.Config.WelcomeDanmu))]
+		s = c.WelcomeDanmu[rand.Intn(len(c.WelcomeDanmu))]
 	}
 	if len(s) == 0 {
-		s = svcCtx.Config.WelcomeDanmu[rand.Intn(len(svcCtx.Config.WelcomeDanmu))]
+		s = c.WelcomeDanmu[rand.Intn(len(c.WelcomeDanmu))]
 	}
 
 	// // 定义正则表达式
@@ -143,7 +146,7 @@ func getRandomWelcome(msg string, svcCtx *svc.ServiceContext) string {
 	// }
 	r := "{user}"
 	replace := r + "\n"
-	if svcCtx.Config.WelcomeUseAt {
+	if c.WelcomeUseAt {
 		replace = "，"
 		r = " {user}"
 	}
@@ -17,88 +17,89 @@ import (
 var random = rand.New(rand.NewSource(time.Now().UnixMilli()))
 
 func (w *wsHandler) welcomeInteractWord() {
-	w.client.RegisterCustomEventHandler("INTERACT_WORD", func(s string) {
+	w.bus.SubscribeRaw("INTERACT_WORD", func(s string) {
+		c := w.svc.Config()
 		interact := &entity.InteractWordText{}
 		_ = json.Unmarshal([]byte(s), interact)
 		// 1 进场 2 关注 3 分享 5(互关)
 		if interact.Data.MsgType == 1 {
-			if !w.svc.Config.InteractSelf && strconv.Itoa(int(interact.Data.Uid)) == w.svc.RobotID {
+			if !c.InteractSelf && strconv.Itoa(int(interact.Data.Uid)) == w.svc.RobotID {
 				return
 			}
-			if !w.svc.Config.InteractAnchor && interact.Data.Uid == w.svc.UserID {
+			if !c.InteractAnchor && interact.Data.Uid == w.svc.UserID {
 				return
 			}
 
-			if v, ok := w.svc.Config.WelcomeString[fmt.Sprint(interact.Data.Uid)]; w.svc.Config.WelcomeSwitch && ok {
-				logic.PushToInterractChan(&logic.InterractData{
+			if v, ok := c.WelcomeString[fmt.Sprint(interact.Data.Uid)]; c.WelcomeSwitch && ok {
+				logic.PushToInterractChan(w.svc, &logic.InterractData{
 					Uid: interact.Data.Uid,
 					Msg: v,
 				})
-			} else if w.svc.Config.InteractWord {
+			} else if w.svc.Enabled(svc.ToggleInteractWord) {
 				// 不在黑名单才欢迎
-				if !inWide(interact.Data.Uname, w.svc.Config.WelcomeBlacklistWide) &&
-					!in(interact.Data.Uname, w.svc.Config.WelcomeBlacklist) {
-					if w.svc.Config.InteractWordByTime {
+				if !inWide(interact.Data.Uname, c.WelcomeBlacklistWide) &&
+					!in(interact.Data.Uname, c.WelcomeBlacklist) {
+					if c.InteractWordByTime {
 						msg := handleInterractByTime(interact.Data.Uid, welcomeInteract(interact.Data.Uname), w.svc)
 						logx.Debug(msg)
-						logic.PushToInterractChan(&logic.InterractData{
-							Uid: interact.Data.Uid,
-							Msg: msg,
+						logic.PushToInterractChan(w.svc, &logic.InterractData{
+							Uid:   interact.Data.Uid,
+							Uname: interact.Data.Uname,
+							Msg:   msg,
 						})
 					} else {
 						msg := handleInterract(interact.Data.Uid, welcomeInteract(interact.Data.Uname), w.svc)
 						ms := strings.Split(msg, "\n")
 						if len(ms) > 1 {
 							for i, s := range ms {
-								logic.PushToInterractChan(&logic.InterractData{
+								logic.PushToInterractChan(w.svc, &logic.InterractData{
 									Uid: interact.Data.Uid + int64(i),
 									Msg: s,
 								})
 							}
 						} else {
-							logic.PushToInterractChan(&logic.InterractData{
-								Uid: interact.Data.Uid,
-								Msg: msg,
+							logic.PushToInterractChan(w.svc, &logic.InterractData{
+								Uid:   interact.Data.Uid,
+								Uname: interact.Data.Uname,
+								Msg:   msg,
 							})
 						}
 					}
 				}
 			}
 		} else if interact.Data.MsgType == 2 || interact.Data.MsgType == 5 {
-			if w.svc.Config.ThanksFocus {
+			if c.ThanksFocus {
 				if len(interact.Data.Uname) == 0 {
 					return
 				}
 				msg := ""
-				if w.svc.Config.WelcomeUseAt {
-					msg = "感谢关注!" + w.svc.Config.FocusDanmu[random.Intn(len(w.svc.Config.FocusDanmu))]
-					logic.PushToBulletSender(msg, &entity.DanmuMsgTextReplyInfo{
+				if c.WelcomeUseAt {
+					msg = "感谢关注!" + c.FocusDanmu[random.Intn(len(c.FocusDanmu))]
+					logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityWelcome, msg, &entity.DanmuMsgTextReplyInfo{
 						ReplyUid: strconv.FormatInt(interact.Data.Uid, 10),
 					})
 				} else {
-					msg := "感谢 " + shortName(interact.Data.Uname, 8, w.svc.Config.DanmuLen) + " 的关注!"
-					logic.PushToBulletSender(msg)
-					if w.svc.Config.FocusDanmu != nil && len(w.svc.Config.FocusDanmu) > 0 {
-						logic.PushToBulletSender(w.svc.Config.FocusDanmu[random.Intn(len(w.svc.Config.FocusDanmu))])
+					logic.PushToBulletSenderMergeable(w.svc, entity.BulletPriorityWelcome, "感谢 {user} 的关注!", shortName(interact.Data.Uname, 8, c.DanmuLen))
+					if c.FocusDanmu != nil && len(c.FocusDanmu) > 0 {
+						logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityWelcome, c.FocusDanmu[random.Intn(len(c.FocusDanmu))])
 					}
 				}
 			}
 		} else if interact.Data.MsgType == 3 {
-			if w.svc.Config.ThanksShare {
+			if c.ThanksShare {
 				if len(interact.Data.Uname) == 0 {
 					return
 				}
 				msg := ""
-				if w.svc.Config.WelcomeUseAt {
-					msg = "感谢分享!" + w.svc.Config.FocusDanmu[random.Intn(len(w.svc.Config.FocusDanmu))]
-					logic.PushToBulletSender(msg, &entity.DanmuMsgTextReplyInfo{
+				if c.WelcomeUseAt {
+					msg = "感谢分享!" + c.FocusDanmu[random.Intn(len(c.FocusDanmu))]
+					logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityWelcome, msg, &entity.DanmuMsgTextReplyInfo{
 						ReplyUid: strconv.FormatInt(interact.Data.Uid, 10),
 					})
 				} else {
-					msg = "感谢 " + shortName(interact.Data.Uname, 8, w.svc.Config.DanmuLen) + " 的分享!"
-					logic.PushToBulletSender(msg)
-					if w.svc.Config.FocusDanmu != nil && len(w.svc.Config.FocusDanmu) > 0 {
-						logic.PushToBulletSender(w.svc.Config.FocusDanmu[random.Intn(len(w.svc.Config.FocusDanmu))])
+					logic.PushToBulletSenderMergeable(w.svc, entity.BulletPriorityWelcome, "感谢 {user} 的分享!", shortName(interact.Data.Uname, 8, c.DanmuLen))
+					if c.FocusDanmu != nil && len(c.FocusDanmu) > 0 {
+						logic.PushToBulletSenderWithPriority(w.svc, entity.BulletPriorityWelcome, c.FocusDanmu[random.Intn(len(c.FocusDanmu))])
 					}
 				}
 			}
@@ -127,7 +128,7 @@ func in(target string, src []string) bool {
 }
 
 func handleInterractByTime(uid int64, uname string, svcCtx *svc.ServiceContext) string {
-
+	c := svcCtx.Config()
 	if _, ook := svcCtx.OtherSideUid[uid]; ook {
 		return handleInterract(uid, uname, svcCtx)
 	}
@@ -142,18 +143,18 @@ func handleInterractByTime(uid int64, uname string, svcCtx *svc.ServiceContext)
 	r := "{user}"
 	rep := r + "\n"
 
-	if svcCtx.Config.InteractWordByTime &&
-		svcCtx.Config.WelcomeDanmuByTime != nil &&
-		len(svcCtx.Config.WelcomeDanmuByTime) > 0 {
+	if c.InteractWordByTime &&
+		c.WelcomeDanmuByTime != nil &&
+		len(c.WelcomeDanmuByTime) > 0 {
 
 		key := getRandomDanmuKeyByTime()
 
-		for _, danmuCfg := range svcCtx.Config.WelcomeDanmuByTime {
+		for _, danmuCfg := range c.WelcomeDanmuByTime {
 			if danmuCfg.Key == key {
 				if danmuCfg.Enabled && len(danmuCfg.Danmu) > 0 {
 					szWelcomOrig := danmuCfg.Danmu[random.Intn(len(danmuCfg.Danmu))]
 
-					if svcCtx.Config.WelcomeUseAt {
+					if c.WelcomeUseAt {
 						rep = "，"
 						r = " {user}"
 						szWelcomTmp := strings.ReplaceAll(szWelcomOrig, r+", ", rep)
@@ -162,9 +163,9 @@ func handleInterractByTime(uid int64, uname string, svcCtx *svc.ServiceContext)
 						szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r, "")
 						return szWelcomTmp
 					} else {
-						welcome := strings.ReplaceAll(szWelcomOrig, r, shortName(uname, 3, svcCtx.Config.DanmuLen))
+						welcome := strings.ReplaceAll(szWelcomOrig, r, shortName(uname, 3, c.DanmuLen))
 						rWelcome := []rune(welcome)
-						if len(rWelcome) > svcCtx.Config.DanmuLen {
+						if len(rWelcome) > c.DanmuLen {
 							szWelcomTmp := strings.ReplaceAll(szWelcomOrig, r+", ", rep)
 							szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r+",", rep)
 							szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r+"，", rep)
@@ -184,6 +185,7 @@ func handleInterractByTime(uid int64, uname string, svcCtx *svc.ServiceContext)
 	}
 }
 func handleInterract(uid int64, uname string, svcCtx *svc.ServiceContext) string {
+	c := svcCtx.Config()
 	if len(uname) == 0 {
 		return ""
 	}
@@ -191,11 +193,11 @@ func handleInterract(uid int64, uname string, svcCtx *svc.ServiceContext) string
 	r := "{user}"
 	rep := r + "\n"
 	if _, ook := svcCtx.OtherSideUid[uid]; ook {
-		if svcCtx.Config.WelcomeUseAt {
+		if c.WelcomeUseAt {
 			return "欢迎过来串门~"
 		} else {
 			szWelcom := "欢迎  过来串门~"
-			maxLen := (svcCtx.Config.DanmuLen - len([]rune(szWelcom)))
+			maxLen := (c.DanmuLen - len([]rune(szWelcom)))
 			if len(s) > maxLen && maxLen > 0 {
 				return "欢迎 " + string(s[0:maxLen-1]) + "… 过来串门~"
 			} else {
@@ -203,9 +205,9 @@ func handleInterract(uid int64, uname string, svcCtx *svc.ServiceContext) string
 			}
 		}
 	} else {
-		szWelcomOrig := svcCtx.Config.WelcomeDanmu[random.Intn(len(svcCtx.Config.WelcomeDanmu))]
+		szWelcomOrig := c.WelcomeDanmu[random.Intn(len(c.WelcomeDanmu))]
 
-		if svcCtx.Config.WelcomeUseAt {
+		if c.WelcomeUseAt {
 			rep = "，"
 			r = " {user}"
 			szWelcomTmp := strings.ReplaceAll(szWelcomOrig, r+", ", rep)
@@ -214,9 +216,9 @@ func handleInterract(uid int64, uname string, svcCtx *svc.ServiceContext) string
 			szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r, rep)
 			return szWelcomTmp
 		} else {
-			welcome := strings.ReplaceAll(szWelcomOrig, r, shortName(uname, 3, svcCtx.Config.DanmuLen))
+			welcome := strings.ReplaceAll(szWelcomOrig, r, shortName(uname, 3, c.DanmuLen))
 			rWelcome := []rune(welcome)
-			if len(rWelcome) > svcCtx.Config.DanmuLen {
+			if len(rWelcome) > c.DanmuLen {
 				szWelcomTmp := strings.ReplaceAll(szWelcomOrig, r+", ", rep)
 				szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r+",", rep)
 				szWelcomTmp = strings.ReplaceAll(szWelcomTmp, r+"，", rep)
@@ -0,0 +1,222 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// B 站各接口的域名
+const (
+	liveHost     = "api.live.bilibili.com"
+	mainHost     = "api.bilibili.com"
+	passportHost = "passport.bilibili.com"
+	wwwHost      = "www.bilibili.com"
+)
+
+const biliTimeout = 10 * time.Second
+
+// StatusError 接口返回的 HTTP 状态码不是 200
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status %d", e.Code)
+}
+
+// BiliClient 通过 HTTP 请求 B 站接口，实现 svc.BiliAPI，使用全局的登录 cookie
+type BiliClient struct {
+	base string
+	cli  *resty.Client
+}
+
+var _ svc.BiliAPI = (*BiliClient)(nil)
+
+// NewBiliClient base 为空时请求 B 站官方接口，否则所有接口都请求 base，用于本地测试或代理
+func NewBiliClient(base string) *BiliClient {
+	return &BiliClient{
+		base: strings.TrimRight(base, "/"),
+		cli:  resty.New().SetTimeout(biliTimeout),
+	}
+}
+
+// url 拼接接口地址，path 以 / 开头
+func (c *BiliClient) url(host, path string) string {
+	if c.base != "" {
+		return c.base + path
+	}
+	return "https://" + host + path
+}
+
+var defaultBili atomic.Pointer[BiliClient]
+
+func init() {
+	defaultBili.Store(NewBiliClient(""))
+}
+
+// SetBaseURL 修改包级函数和未单独设置接口的直播间使用的接口地址，为空时恢复官方接口
+func SetBaseURL(base string) {
+	defaultBili.Store(NewBiliClient(base))
+}
+
+// DefaultBili 包级函数使用的接口
+func DefaultBili() *BiliClient {
+	return defaultBili.Load()
+}
+
+// BiliOf 返回直播间使用的接口，未设置时使用默认接口
+func BiliOf(svcCtx *svc.ServiceContext) svc.BiliAPI {
+	if svcCtx != nil && svcCtx.Bili != nil {
+		return svcCtx.Bili
+	}
+	return DefaultBili()
+}
+
+// getJSON 请求接口并解析 json 响应
+func (c *BiliClient) getJSON(url string, withCookie bool, v any) error {
+	req := c.cli.R().SetHeader("user-agent", userAgent)
+	if withCookie {
+		req.SetHeader("cookie", Cookie())
+	}
+	resp, err := req.Get(url)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() != 200 {
+		return &StatusError{Code: resp.StatusCode()}
+	}
+	if err = json.Unmarshal(resp.Body(), v); err != nil {
+		logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
+		return err
+	}
+	return nil
+}
+
+func (c *BiliClient) RoomInit(roomID int) (*entity.RoomInitInfo, error) {
+	var status struct {
+		entity.RoomInitStatus
+		entity.RoomInitInfo
+	}
+	if err := c.getJSON(c.url(liveHost, fmt.Sprintf("/room/v1/Room/room_init?id=%v", roomID)), false, &status); err != nil {
+		logx.Error("请求room_init失败：", err)
+		return nil, err
+	}
+	// 太长时间下播，房间号可能会消失，请求响应的code=60004
+	if status.Code == 60004 {
+		return nil, errors.New("房间号不存在")
+	}
+	if status.Code != 0 {
+		return nil, fmt.Errorf("获取直播间信息失败：%d", status.Code)
+	}
+	return &status.RoomInitInfo, nil
+}
+
+func (c *BiliClient) DanmuLength(roomID int) (int, error) {
+	info := &entity.InfoByUser{}
+	if err := c.getJSON(c.url(liveHost, fmt.Sprintf("/xlive/web-room/v1/index/getInfoByUser?room_id=%v", roomID)), true, info); err != nil {
+		logx.Error("请求getInfoByUser失败：", err)
+		return 0, err
+	}
+	if info.Code != 0 {
+		return 0, fmt.Errorf("获取弹幕长度限制失败：%s", info.Message)
+	}
+	return info.Data.Property.Danmu.Length, nil
+}
+
+func (c *BiliClient) Userinfo(roomID int) (*entity.Userinfo, error) {
+	roominfo, err := c.RoomInit(roomID)
+	if err != nil {
+		return nil, err
+	}
+	userinfo := &entity.Userinfo{}
+	if err = c.getJSON(c.url(liveHost, fmt.Sprintf("/live_user/v1/Master/info?uid=%v", roominfo.Data.Uid)), false, userinfo); err != nil {
+		logx.Error("请求Master/info失败：", err)
+		return nil, err
+	}
+	if userinfo.Code != 0 {
+		logx.Errorf("直播间id %v 用户id %v 获取用户信息失败", roomID, roominfo.Data.Uid)
+		return nil, errors.New("获取用户信息失败")
+	}
+	return userinfo, nil
+}
+
+func (c *BiliClient) TopListInfo(roomID int, ruid int64, page int) (*entity.TopListInfo, error) {
+	toplistinfo := &entity.TopListInfo{}
+	url := c.url(liveHost, fmt.Sprintf("/xlive/app-room/v2/guardTab/topList?page_size=29&roomid=%v&page=%v&ruid=%v", roomID, page, ruid))
+	if err := c.getJSON(url, false, toplistinfo); err != nil {
+		logx.Error("请求topList失败：", err)
+		return nil, err
+	}
+	if toplistinfo.Code != 0 {
+		logx.Errorf("直播间id %v 用户id %v 获取舰长列表失败", roomID, ruid)
+		return nil, errors.New("获取舰长列表失败")
+	}
+	return toplistinfo, nil
+}
+
+func (c *BiliClient) RankListInfo(roomID int, ruid int64, page int) (*entity.RankListInfo, error) {
+	ranklistinfo := &entity.RankListInfo{}
+	url := c.url(liveHost, fmt.Sprintf("/xlive/general-interface/v1/rank/getOnlineGoldRank?ruid=%v&roomId=%v&page=%v&pageSize=50", ruid, roomID, page))
+	if err := c.getJSON(url, false, ranklistinfo); err != nil {
+		logx.Error("请求getOnlineGoldRank失败：", err)
+		return nil, err
+	}
+	if ranklistinfo.Code != 0 {
+		logx.Errorf("直播间id %v 用户id %v 获取高能列表失败", roomID, ruid)
+		return nil, errors.New("获取高能列表失败")
+	}
+	return ranklistinfo, nil
+}
+
+func (c *BiliClient) Nav() (*entity.UserInfo, error) {
+	r := &entity.UserInfo{}
+	if err := c.getJSON(c.url(mainHost, "/x/web-interface/nav"), true, r); err != nil {
+		logx.Error("请求nav失败：", err)
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *BiliClient) SendDanmu(roomID int, msg string, reply ...*entity.DanmuMsgTextReplyInfo) (*entity.DanmuResp, error) {
+	m := map[string]string{
+		"bubble":     "5",
+		"msg":        msg,
+		"color":      "4546550",
+		"fontsize":   "25",
+		"rnd":        fmt.Sprint(time.Now().Unix()),
+		"roomid":     fmt.Sprint(roomID),
+		"csrf":       CSRF(),
+		"csrf_token": CSRF(),
+	}
+	if len(reply) > 0 && reply[0] != nil {
+		m["reply_mid"] = reply[0].ReplyUid
+		if len(reply[0].ReplyMsgId) > 0 {
+			m["replay_dmid"] = reply[0].ReplyMsgId
+		}
+	}
+	resp, err := c.cli.R().
+		SetHeader("user-agent", userAgent).
+		SetHeader("cookie", Cookie()).
+		SetMultipartFormData(m).
+		Post(c.url(liveHost, "/msg/send"))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() != 200 {
+		return nil, &StatusError{Code: resp.StatusCode()}
+	}
+	r := &entity.DanmuResp{}
+	if err = json.Unmarshal(resp.Body(), r); err != nil {
+		return nil, fmt.Errorf("send弹幕响应解析失败：%w", err)
+	}
+	return r, nil
+}
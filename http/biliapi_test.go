@@ -0,0 +1,94 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http/bilitest"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+func newTestBili(t *testing.T) (*bilitest.Server, *BiliClient) {
+	t.Helper()
+	srv := bilitest.NewServer()
+	t.Cleanup(srv.Close)
+	return srv, NewBiliClient(srv.URL)
+}
+
+func TestBiliClientRoom(t *testing.T) {
+	srv, c := newTestBili(t)
+	guards := make([]bilitest.Guard, 40)
+	for i := range guards {
+		guards[i] = bilitest.Guard{Uid: int64(1000 + i), GuardLevel: 3}
+	}
+	srv.AddRoom(bilitest.Room{RoomID: 100, Uid: 42, Uname: "主播", FollowerNum: 7, DanmuLength: 30, Guards: guards})
+
+	info, err := c.RoomInit(100)
+	if err != nil || info.Data.Uid != 42 {
+		t.Fatalf("RoomInit = %+v, %v", info, err)
+	}
+	if _, err = c.RoomInit(404); err == nil {
+		t.Fatal("RoomInit of missing room should fail")
+	}
+	if l, err := c.DanmuLength(100); err != nil || l != 30 {
+		t.Fatalf("DanmuLength = %d, %v", l, err)
+	}
+	user, err := c.Userinfo(100)
+	if err != nil || user.Data.Info.Uname != "主播" || user.Data.FollowerNum != 7 {
+		t.Fatalf("Userinfo = %+v, %v", user, err)
+	}
+	top, err := c.TopListInfo(100, 42, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Data.Info.Num != 40 || top.Data.Info.Page != 2 || len(top.Data.List) != 11 {
+		t.Fatalf("TopListInfo page 2: num=%d pages=%d len=%d", top.Data.Info.Num, top.Data.Info.Page, len(top.Data.List))
+	}
+}
+
+func TestBiliClientNav(t *testing.T) {
+	srv, c := newTestBili(t)
+	if r, err := c.Nav(); err != nil || r.Data.IsLogin {
+		t.Fatalf("Nav before login = %+v, %v", r, err)
+	}
+	srv.Login(42, "机器人")
+	if r, err := c.Nav(); err != nil || !r.Data.IsLogin || r.Data.Mid != 42 {
+		t.Fatalf("Nav = %+v, %v", r, err)
+	}
+}
+
+func TestSendThroughBiliAPI(t *testing.T) {
+	srv, c := newTestBili(t)
+	svcCtx := &svc.ServiceContext{Bili: c}
+	svcCtx.SetConfig(&config.Config{RoomId: 100})
+	cases := []struct {
+		status, code int
+		msg          string
+		want         SendStatus
+	}{
+		{http.StatusOK, 0, "", SendAccepted},
+		{http.StatusOK, 0, "k", SendShadowFiltered},
+		{http.StatusOK, 10030, "频率过快", SendRateLimited},
+		{http.StatusOK, -101, "账号未登录", SendAuthExpired},
+		{http.StatusPreconditionFailed, 0, "", SendRateLimited},
+		{http.StatusBadGateway, 0, "", SendFailed},
+	}
+	for _, tc := range cases {
+		srv.SendReply = func(bilitest.Danmu) (int, int, string) { return tc.status, tc.code, tc.msg }
+		r, err := send("你好", svcCtx)
+		if r.Status != tc.want {
+			t.Errorf("status=%d code=%d: got %v, want %v", tc.status, tc.code, r.Status, tc.want)
+		}
+		if (err == nil) != (tc.want == SendAccepted) {
+			t.Errorf("status=%d code=%d: unexpected err %v", tc.status, tc.code, err)
+		}
+	}
+	sent := srv.Sent()
+	if len(sent) != len(cases) || sent[0].RoomID != 100 || sent[0].Msg != "你好" {
+		t.Fatalf("sent = %+v", sent)
+	}
+	if msgs := srv.Messages(100); len(msgs) != 1 {
+		t.Fatalf("accepted = %q", msgs)
+	}
+}
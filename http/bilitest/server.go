@@ -0,0 +1,449 @@
+// Package bilitest 在本地模拟机器人用到的 B 站接口，配合 http.NewBiliClient 进行不访问网络的端到端测试
+package bilitest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 分页大小与官方接口一致
+const (
+	topListPageSize  = 29
+	rankListPageSize = 50
+)
+
+// Room 模拟的直播间
+type Room struct {
+	RoomID      int
+	Uid         int64 // 主播 uid
+	Uname       string
+	LiveStatus  int
+	FollowerNum int
+	DanmuLength int // 登录用户在该直播间的弹幕长度限制，0 时为 20
+	Guards      []Guard
+	Rank        []RankUser
+	OnlineNum   int // 高能榜人数，0 时为 Rank 的长度
+}
+
+// Guard 大航海成员
+type Guard struct {
+	Uid        int64
+	Username   string
+	GuardLevel int
+	IsAlive    int
+}
+
+// RankUser 高能榜用户
+type RankUser struct {
+	Uid        int64
+	Name       string
+	Score      int
+	GuardLevel int
+}
+
+// Danmu 发送到模拟服务的一条弹幕
+type Danmu struct {
+	RoomID   int
+	Msg      string
+	ReplyMid string
+	Csrf     string
+	Status   int    // 返回的 HTTP 状态码
+	Code     int    // 返回的 code
+	Result   string // 返回的 msg，被屏蔽时 code 为 0，msg 为 f 或 k
+	Time     time.Time
+}
+
+// Accepted 弹幕是否发送成功
+func (d Danmu) Accepted() bool {
+	return d.Status == http.StatusOK && d.Code == 0 && d.Result != "f" && d.Result != "k"
+}
+
+// Server 模拟的 B 站接口服务
+type Server struct {
+	*httptest.Server
+
+	// SendReply 决定弹幕发送接口的响应，返回 HTTP 状态码和接口的 code、msg，为 nil 时全部发送成功
+	SendReply func(d Danmu) (status, code int, msg string)
+
+	locked sync.Mutex
+	rooms  map[int]*Room
+	uid    int64
+	uname  string
+	sent   []Danmu
+	notify chan struct{}
+
+	refreshes int
+	qrUid     int64 // 扫码登录的用户，为 0 时二维码等待扫码
+	qrUname   string
+}
+
+// NewServer 启动模拟服务，使用完毕后调用 Close
+func NewServer() *Server {
+	s := &Server{
+		rooms:  make(map[int]*Room),
+		notify: make(chan struct{}, 1),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/room/v1/Room/room_init", s.roomInit)
+	mux.HandleFunc("/xlive/web-room/v1/index/getInfoByUser", s.infoByUser)
+	mux.HandleFunc("/live_user/v1/Master/info", s.masterInfo)
+	mux.HandleFunc("/xlive/app-room/v2/guardTab/topList", s.topList)
+	mux.HandleFunc("/xlive/general-interface/v1/rank/getOnlineGoldRank", s.rankList)
+	mux.HandleFunc("/xlive/web-room/v1/index/getDanmuInfo", s.danmuInfo)
+	mux.HandleFunc("/x/web-interface/nav", s.nav)
+	mux.HandleFunc("/x/frontend/finger/spi", s.spi)
+	mux.HandleFunc("/msg/send", s.send)
+	mux.HandleFunc("/x/passport-login/web/qrcode/generate", s.qrGenerate)
+	mux.HandleFunc("/x/passport-login/web/qrcode/poll", s.qrPoll)
+	mux.HandleFunc("/correspond/1/", s.correspond)
+	mux.HandleFunc("/x/passport-login/web/cookie/refresh", s.cookieRefresh)
+	mux.HandleFunc("/x/passport-login/web/confirm/refresh", s.confirmRefresh)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddRoom 添加或替换直播间
+func (s *Server) AddRoom(r Room) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	s.rooms[r.RoomID] = &r
+}
+
+// Login 设置当前登录的用户，未设置时 nav 接口返回未登录
+func (s *Server) Login(uid int64, uname string) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	s.uid, s.uname = uid, uname
+}
+
+// ScanQR 模拟用户扫码并确认登录，之后查询扫码状态时登录成功
+func (s *Server) ScanQR(uid int64, uname string) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	s.qrUid, s.qrUname = uid, uname
+}
+
+// Refreshes 返回刷新 cookie 的次数
+func (s *Server) Refreshes() int {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	return s.refreshes
+}
+
+// Sent 返回收到的所有弹幕，包括发送失败的
+func (s *Server) Sent() []Danmu {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	return append([]Danmu(nil), s.sent...)
+}
+
+// Messages 返回直播间发送成功的弹幕内容
+func (s *Server) Messages(roomID int) []string {
+	var msgs []string
+	for _, d := range s.Sent() {
+		if d.RoomID == roomID && d.Accepted() {
+			msgs = append(msgs, d.Msg)
+		}
+	}
+	return msgs
+}
+
+// Wait 等待直播间至少发送成功 n 条弹幕，ctx 取消时返回已发送的弹幕和错误
+func (s *Server) Wait(ctx context.Context, roomID, n int) ([]string, error) {
+	for {
+		if msgs := s.Messages(roomID); len(msgs) >= n {
+			return msgs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return s.Messages(roomID), ctx.Err()
+		case <-s.notify:
+		}
+	}
+}
+
+func (s *Server) room(r *http.Request, key string) *Room {
+	id, _ := strconv.Atoi(r.URL.Query().Get(key))
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	return s.rooms[id]
+}
+
+func (s *Server) roomByUid(uid int64) *Room {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	for _, r := range s.rooms {
+		if r.Uid == uid {
+			return r
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeCode(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, map[string]any{"code": code, "msg": msg, "message": msg})
+}
+
+func (s *Server) roomInit(w http.ResponseWriter, r *http.Request) {
+	room := s.room(r, "id")
+	if room == nil {
+		writeCode(w, 60004, "直播间不存在")
+		return
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{
+			"room_id":     room.RoomID,
+			"uid":         room.Uid,
+			"live_status": room.LiveStatus,
+		},
+	})
+}
+
+func (s *Server) infoByUser(w http.ResponseWriter, r *http.Request) {
+	room := s.room(r, "room_id")
+	if room == nil {
+		writeCode(w, 19002005, "房间不存在")
+		return
+	}
+	length := room.DanmuLength
+	if length == 0 {
+		length = 20
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{
+			"property": map[string]any{"danmu": map[string]any{"length": length}},
+		},
+	})
+}
+
+func (s *Server) masterInfo(w http.ResponseWriter, r *http.Request) {
+	uid, _ := strconv.ParseInt(r.URL.Query().Get("uid"), 10, 64)
+	room := s.roomByUid(uid)
+	if room == nil {
+		writeCode(w, -1, "用户不存在")
+		return
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{
+			"info":         map[string]any{"uid": room.Uid, "uname": room.Uname},
+			"follower_num": room.FollowerNum,
+			"room_id":      room.RoomID,
+		},
+	})
+}
+
+// page 返回第 page 页的下标范围和总页数
+func page(r *http.Request, total, size int) (int, int, int) {
+	p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if p < 1 {
+		p = 1
+	}
+	pages := (total + size - 1) / size
+	start := (p - 1) * size
+	if start > total {
+		start = total
+	}
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return start, end, pages
+}
+
+func (s *Server) topList(w http.ResponseWriter, r *http.Request) {
+	room := s.room(r, "roomid")
+	if room == nil {
+		writeCode(w, 1, "直播间不存在")
+		return
+	}
+	start, end, pages := page(r, len(room.Guards), topListPageSize)
+	list := make([]map[string]any, 0, end-start)
+	for i, g := range room.Guards[start:end] {
+		list = append(list, map[string]any{
+			"uid":         g.Uid,
+			"ruid":        room.Uid,
+			"rank":        start + i + 1,
+			"username":    g.Username,
+			"is_alive":    g.IsAlive,
+			"guard_level": g.GuardLevel,
+		})
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{
+			"info": map[string]any{"num": len(room.Guards), "page": pages},
+			"list": list,
+		},
+	})
+}
+
+func (s *Server) rankList(w http.ResponseWriter, r *http.Request) {
+	room := s.room(r, "roomId")
+	if room == nil {
+		writeCode(w, 1, "直播间不存在")
+		return
+	}
+	start, end, _ := page(r, len(room.Rank), rankListPageSize)
+	items := make([]map[string]any, 0, end-start)
+	for i, u := range room.Rank[start:end] {
+		items = append(items, map[string]any{
+			"userRank":    start + i + 1,
+			"uid":         u.Uid,
+			"name":        u.Name,
+			"score":       u.Score,
+			"guard_level": u.GuardLevel,
+		})
+	}
+	online := room.OnlineNum
+	if online == 0 {
+		online = len(room.Rank)
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{
+			"onlineNum":      online,
+			"OnlineRankItem": items,
+		},
+	})
+}
+
+func (s *Server) danmuInfo(w http.ResponseWriter, r *http.Request) {
+	if s.room(r, "id") == nil {
+		writeCode(w, 1, "直播间不存在")
+		return
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"token": "bilitest", "host_list": []any{}},
+	})
+}
+
+func (s *Server) nav(w http.ResponseWriter, r *http.Request) {
+	s.locked.Lock()
+	uid, uname := s.uid, s.uname
+	s.locked.Unlock()
+	if uid == 0 {
+		writeJSON(w, map[string]any{"code": -101, "message": "账号未登录", "data": map[string]any{"isLogin": false}})
+		return
+	}
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"isLogin": true, "mid": uid, "uname": uname},
+	})
+}
+
+func (s *Server) spi(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"b_3": "bilitest-b3", "b_4": "bilitest-b4"},
+	})
+}
+
+func (s *Server) send(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		_ = r.ParseForm()
+	}
+	roomID, _ := strconv.Atoi(r.FormValue("roomid"))
+	d := Danmu{
+		RoomID:   roomID,
+		Msg:      r.FormValue("msg"),
+		ReplyMid: r.FormValue("reply_mid"),
+		Csrf:     r.FormValue("csrf"),
+		Status:   http.StatusOK,
+		Time:     time.Now(),
+	}
+	if s.SendReply != nil {
+		d.Status, d.Code, d.Result = s.SendReply(d)
+	}
+	s.locked.Lock()
+	s.sent = append(s.sent, d)
+	s.locked.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	if d.Status != http.StatusOK {
+		w.WriteHeader(d.Status)
+		return
+	}
+	writeJSON(w, map[string]any{"code": d.Code, "msg": d.Result, "message": d.Result, "data": map[string]any{}})
+}
+
+func (s *Server) correspond(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(`<html><body><div id="1-name">bilitestrefreshcsrf</div></body></html>`))
+}
+
+// cookieRefresh 每次刷新下发新的 SESSDATA、bili_jct 和 refresh_token
+func (s *Server) cookieRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_ = r.ParseForm()
+	if r.FormValue("refresh_token") == "" || r.FormValue("refresh_csrf") == "" {
+		writeJSON(w, map[string]any{"code": -101, "message": "账号未登录"})
+		return
+	}
+	s.locked.Lock()
+	s.refreshes++
+	n := s.refreshes
+	s.locked.Unlock()
+	http.SetCookie(w, &http.Cookie{Name: "SESSDATA", Value: "bilitest-sess-" + strconv.Itoa(n), Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "bili_jct", Value: "bilitest-csrf-" + strconv.Itoa(n), Path: "/"})
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"status": 0, "refresh_token": "bilitest-token-" + strconv.Itoa(n)},
+	})
+}
+
+func (s *Server) confirmRefresh(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{"code": 0, "message": "0"})
+}
+
+func (s *Server) qrGenerate(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"url": s.URL + "/qrcode/bilitest-key", "qrcode_key": "bilitest-key"},
+	})
+}
+
+// qrPoll 调用 ScanQR 之前返回等待扫码，之后下发 cookie 并登录该用户
+func (s *Server) qrPoll(w http.ResponseWriter, r *http.Request) {
+	s.locked.Lock()
+	uid, uname := s.qrUid, s.qrUname
+	if uid != 0 {
+		s.uid, s.uname = uid, uname
+		s.qrUid, s.qrUname = 0, ""
+	}
+	s.locked.Unlock()
+	if uid == 0 {
+		writeJSON(w, map[string]any{"code": 0, "data": map[string]any{"code": 86101, "message": "未扫码"}})
+		return
+	}
+	id := strconv.FormatInt(uid, 10)
+	http.SetCookie(w, &http.Cookie{Name: "DedeUserID", Value: id, Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "SESSDATA", Value: "bilitest-sess-" + id, Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "bili_jct", Value: "bilitest-csrf-" + id, Path: "/"})
+	writeJSON(w, map[string]any{
+		"code": 0,
+		"data": map[string]any{"code": 0, "message": "", "refresh_token": "bilitest-token-" + id},
+	})
+}
@@ -1,24 +1,19 @@
 package http
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
-	"github.com/avast/retry-go/v4"
+	"fmt"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"github.com/zeromicro/go-zero/core/logx"
-	"io"
-	"mime/multipart"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 //func GetDanmuInfo(svcCtx *svc.ServiceContext) (*entity.ResponseBulletInfo, error) {
 //	var err error
 //	var resp *resty.Response
-//	var url = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=" + strconv.Itoa(svcCtx.Config.RoomId) + "&type=0"
+//	var url = "https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=" + strconv.Itoa(svcCtx.Config().RoomId) + "&type=0"
 //	r := &entity.ResponseBulletInfo{}
 //	if resp, err = cli.R().
 //		SetHeader("user-agent", userAgent).
@@ -34,71 +29,117 @@ import (
 //	return r, nil
 //}
 
-func Send(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) error {
-	var err error
-	var url = "https://api.live.bilibili.com/msg/send"
-	var respdata *entity.DanmuResp = new(entity.DanmuResp)
-	m := make(map[string]string)
-	m["bubble"] = "5"
-	m["msg"] = msg
-	m["color"] = "4546550"
-	//m["mode"] = "4"
-	m["fontsize"] = "25"
-	m["rnd"] = strconv.FormatInt(time.Now().Unix(), 10)
-	//m["room_type"] = "0"
-	//m["jumpfrom"] = "0"
-	//m["reply_attr"] = "0"
-	if len(reply) > 0 {
-		m["reply_mid"] = reply[0].ReplyUid
-		if len(reply[0].ReplyMsgId) > 0 {
-			m["replay_dmid"] = reply[0].ReplyMsgId
-		}
+// SendStatus 弹幕发送结果的类型
+type SendStatus int
+
+const (
+	SendAccepted       SendStatus = iota // 发送成功
+	SendShadowFiltered                   // 被系统屏蔽，仅自己可见
+	SendSensitive                        // 包含敏感词被拒绝
+	SendRateLimited                      // 发送频率过快
+	SendMuted                            // 账号在直播间被禁言
+	SendAuthExpired                      // 登录失效
+	SendFailed                           // 网络错误等其他失败，可以重试
+)
+
+func (s SendStatus) String() string {
+	switch s {
+	case SendAccepted:
+		return "发送成功"
+	case SendShadowFiltered:
+		return "弹幕被屏蔽"
+	case SendSensitive:
+		return "弹幕包含敏感词"
+	case SendRateLimited:
+		return "发送频率过快"
+	case SendMuted:
+		return "账号已被禁言"
+	case SendAuthExpired:
+		return "登录已失效"
+	default:
+		return "发送失败"
 	}
-	m["roomid"] = strconv.Itoa(svcCtx.Config.RoomId)
-	m["csrf"] = CookieList["bili_jct"]
-	m["csrf_token"] = CookieList["bili_jct"]
-	err = retry.Do(func() error {
-		_, data, err := postWithFormData(http.MethodPost, url, userAgent, CookieStr, &m)
-		if err != nil {
-			logx.Errorf("请求send失败：%v", err)
-			return err
-		}
-		err = json.Unmarshal(data, respdata)
-		if err != nil {
-			logx.Errorf("send弹幕响应解析失败:%v", err)
-			return nil
-		}
-		if respdata.Code != 0 {
-			logx.Infof("请求send失败:%s", respdata.Msg)
-			return errors.New(respdata.Msg)
-		}
-		if respdata.Msg == "f" {
-			logx.Infof("请求send失败:%s , %s", respdata.Msg, "弹幕内容包含敏感词，被服务器拒绝")
-		}
+}
+
+// 频率限制没有给出等待时间时的默认退避时间
+const defaultRateLimitBackoff = 5 * time.Second
+
+// SendResult 弹幕发送结果
+type SendResult struct {
+	Status     SendStatus
+	Code       int           // 接口返回的 code，请求失败时为 HTTP 状态码或 0
+	Message    string        // 接口返回的错误信息
+	RetryAfter time.Duration // 频率限制时建议的等待时间
+}
+
+// Err 发送成功时返回 nil
+func (r *SendResult) Err() error {
+	if r.Status == SendAccepted {
 		return nil
-	}, retry.Attempts(3), retry.Delay(1*time.Second))
-	if err != nil {
-		logx.Error(err)
 	}
-	return nil
+	return fmt.Errorf("%s(code=%d): %s", r.Status, r.Code, r.Message)
+}
+
+// Send 发送一条弹幕，只请求一次，重试由调用方根据返回结果决定
+// 发送失败时同时返回 error，可以通过 SendResult.Status 区分失败原因
+func Send(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) (*SendResult, error) {
+	if f := sendFunc.Load(); f != nil {
+		return (*f)(msg, svcCtx, reply...)
+	}
+	return send(msg, svcCtx, reply...)
 }
-func postWithFormData(method, url, ua, cookie string, postData *map[string]string) (int, []byte, error) {
-	body := new(bytes.Buffer)
-	w := multipart.NewWriter(body)
-	for k, v := range *postData {
-		w.WriteField(k, v)
+
+func send(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) (*SendResult, error) {
+	respdata, err := BiliOf(svcCtx).SendDanmu(svcCtx.Config().RoomId, msg, reply...)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		r := &SendResult{Status: SendFailed, Code: statusErr.Code, Message: http.StatusText(statusErr.Code)}
+		// 412 为触发风控，按频率限制处理
+		if statusErr.Code == http.StatusPreconditionFailed || statusErr.Code == http.StatusTooManyRequests {
+			r.Status = SendRateLimited
+			r.RetryAfter = defaultRateLimitBackoff
+		}
+		logx.Errorf("请求send失败：%v", r.Err())
+		return r, r.Err()
 	}
-	w.Close()
-	req, _ := http.NewRequest(method, url, body)
-	req.Header.Set("Content-Type", w.FormDataContentType())
-	req.Header.Set("Cookie", cookie)
-	req.Header.Set("user-agent", ua)
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		logx.Error(err)
-		return 0, nil, err
+		logx.Errorf("请求send失败：%v", err)
+		r := &SendResult{Status: SendFailed, Message: err.Error()}
+		return r, r.Err()
+	}
+	r := parseSendResp(respdata)
+	if r.Status != SendAccepted {
+		logx.Infof("请求send失败:%v", r.Err())
+		return r, r.Err()
+	}
+	return r, nil
+}
+
+// parseSendResp 根据接口返回的 code 和 msg 区分发送结果
+func parseSendResp(resp *entity.DanmuResp) *SendResult {
+	r := &SendResult{Code: resp.Code, Message: resp.Message}
+	if r.Message == "" {
+		r.Message = resp.Msg
+	}
+	switch resp.Code {
+	case 0:
+		switch resp.Msg {
+		case "f":
+			r.Status = SendSensitive
+		case "k":
+			r.Status = SendShadowFiltered
+		default:
+			r.Status = SendAccepted
+		}
+	case 10030, 10031:
+		r.Status = SendRateLimited
+		r.RetryAfter = defaultRateLimitBackoff
+	case 1003, 10024:
+		r.Status = SendMuted
+	case -101, -111:
+		r.Status = SendAuthExpired
+	default:
+		r.Status = SendFailed
 	}
-	data, _ := io.ReadAll(resp.Body)
-	resp.Body.Close()
-	return resp.StatusCode, data, nil
+	return r
 }
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+)
+
+func TestParseSendResp(t *testing.T) {
+	cases := []struct {
+		code   int
+		msg    string
+		status SendStatus
+	}{
+		{0, "", SendAccepted},
+		{0, "f", SendSensitive},
+		{0, "k", SendShadowFiltered},
+		{10030, "您发送弹幕的频率过快", SendRateLimited},
+		{1003, "您已被禁言", SendMuted},
+		{-101, "账号未登录", SendAuthExpired},
+		{-111, "csrf 校验失败", SendAuthExpired},
+		{-400, "参数错误", SendFailed},
+	}
+	for _, c := range cases {
+		r := parseSendResp(&entity.DanmuResp{Code: c.code, Msg: c.msg})
+		if r.Status != c.status {
+			t.Errorf("code=%d msg=%q: want %v, got %v", c.code, c.msg, c.status, r.Status)
+		}
+		if (r.Err() == nil) != (c.status == SendAccepted) {
+			t.Errorf("code=%d msg=%q: unexpected err %v", c.code, c.msg, r.Err())
+		}
+	}
+	if r := parseSendResp(&entity.DanmuResp{Code: 10030}); r.RetryAfter <= 0 {
+		t.Error("rate limited result should carry a back-off hint")
+	}
+}
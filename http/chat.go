@@ -0,0 +1,214 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// ChatRequest 一次聊天请求
+type ChatRequest struct {
+	Uid   int64  // 发送者，为 0 时不使用对话记忆
+	Uname string // 发送者的用户名，告诉机器人是谁在说话
+	Msg   string
+}
+
+// ChatProvider 机器人聊天服务
+type ChatProvider interface {
+	// Name 服务名称，与 RobotMode 配置一致
+	Name() string
+	// Timeout 单次请求的超时
+	Timeout(c *config.Config) time.Duration
+	Chat(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest) (string, error)
+}
+
+// ChatStreamProvider 支持流式回复的聊天服务，onDelta 依次收到回复的增量文本，返回完整的回复
+type ChatStreamProvider interface {
+	ChatProvider
+	ChatStream(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, onDelta func(delta string)) (string, error)
+}
+
+var (
+	chatProvidersMu sync.RWMutex
+	chatProviders   = make(map[string]ChatProvider)
+)
+
+func init() {
+	RegisterChatProvider(deepSeekProvider{})
+	RegisterChatProvider(chatGPTProvider{})
+	RegisterChatProvider(qingYunKeProvider{})
+}
+
+// RegisterChatProvider 注册聊天服务，名称不区分大小写，同名的服务被替换；配置校验同时接受该名称
+func RegisterChatProvider(p ChatProvider) {
+	chatProvidersMu.Lock()
+	defer chatProvidersMu.Unlock()
+	chatProviders[strings.ToLower(p.Name())] = p
+	config.RegisterRobotMode(p.Name())
+}
+
+// ChatProviderOf 按名称查找聊天服务，名称不区分大小写
+func ChatProviderOf(name string) (ChatProvider, bool) {
+	chatProvidersMu.RLock()
+	defer chatProvidersMu.RUnlock()
+	p, ok := chatProviders[strings.ToLower(strings.TrimSpace(name))]
+	return p, ok
+}
+
+// ChatProviders 已注册的聊天服务名称
+func ChatProviders() []string {
+	chatProvidersMu.RLock()
+	defer chatProvidersMu.RUnlock()
+	names := make([]string, 0, len(chatProviders))
+	for _, p := range chatProviders {
+		names = append(names, p.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChatChain 按 RobotMode、RobotFallback 的顺序返回要依次尝试的聊天服务，跳过未注册和重复的服务
+func ChatChain(c *config.Config) []ChatProvider {
+	var chain []ChatProvider
+	seen := make(map[string]bool)
+	for _, name := range append([]string{c.RobotMode}, c.RobotFallback...) {
+		p, ok := ChatProviderOf(name)
+		if !ok {
+			logx.Errorf("未知的机器人模式：%s", name)
+			continue
+		}
+		if key := strings.ToLower(p.Name()); !seen[key] {
+			seen[key] = true
+			chain = append(chain, p)
+		}
+	}
+	return chain
+}
+
+// chatTimeout 服务自己的超时为 0 时使用 RobotTimeout
+func chatTimeout(c *config.Config, seconds int) time.Duration {
+	if seconds <= 0 {
+		seconds = c.RobotTimeout
+	}
+	if seconds <= 0 {
+		seconds = 20
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+var openAIClients sync.Map // token + 地址 -> *openai.Client
+
+// openAIClient 相同 token 和地址的请求共用一个客户端
+func openAIClient(token, baseURL string) *openai.Client {
+	key := token + "\x00" + baseURL
+	if c, ok := openAIClients.Load(key); ok {
+		return c.(*openai.Client)
+	}
+	cfg := openai.DefaultConfig(token)
+	cfg.BaseURL = baseURL
+	c, _ := openAIClients.LoadOrStore(key, openai.NewClientWithConfig(cfg))
+	return c.(*openai.Client)
+}
+
+// completeChat 请求 OpenAI 兼容的接口，模型调用工具时执行工具后继续请求，返回所有轮次的回复
+// onDelta 不为空时流式请求；chat 为提问的用户，工具只能查询该用户的数据
+func completeChat(ctx context.Context, svcCtx *svc.ServiceContext, client *openai.Client, req openai.ChatCompletionRequest, chat *ChatRequest, onDelta func(string)) (string, error) {
+	if svcCtx.Config().RobotTools {
+		req.Tools = chatToolList()
+	}
+	var full strings.Builder
+	for round := 0; ; round++ {
+		if round == maxToolRounds {
+			// 工具调用过多，要求直接回答
+			req.Tools = nil
+		}
+		reply, calls, err := requestChat(ctx, client, req, onDelta)
+		full.WriteString(reply)
+		if err != nil || len(calls) == 0 || req.Tools == nil {
+			// 没有提供工具时忽略模型的工具调用
+			return full.String(), err
+		}
+		req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+			Role:      openai.ChatMessageRoleAssistant,
+			Content:   reply,
+			ToolCalls: calls,
+		})
+		for _, call := range calls {
+			req.Messages = append(req.Messages, openai.ChatCompletionMessage{
+				Role:       openai.ChatMessageRoleTool,
+				Content:    callChatTool(ctx, svcCtx, chat, call),
+				ToolCallID: call.ID,
+			})
+		}
+	}
+}
+
+// requestChat 请求一轮，返回回复和模型要求调用的工具
+func requestChat(ctx context.Context, client *openai.Client, req openai.ChatCompletionRequest, onDelta func(string)) (string, []openai.ToolCall, error) {
+	if onDelta != nil {
+		return streamChat(ctx, client, req, onDelta)
+	}
+	resp, err := client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", nil, err
+	}
+	logx.Infof("本次开销：%v tokens", resp.Usage.TotalTokens)
+	if len(resp.Choices) == 0 {
+		return "", nil, nil
+	}
+	msg := resp.Choices[0].Message
+	return msg.Content, msg.ToolCalls, nil
+}
+
+// streamChat 流式请求 OpenAI 兼容的接口，工具调用的片段按序号拼接
+func streamChat(ctx context.Context, client *openai.Client, req openai.ChatCompletionRequest, onDelta func(string)) (string, []openai.ToolCall, error) {
+	req.Stream = true
+	stream, err := client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer stream.Close()
+	var reply strings.Builder
+	var calls []openai.ToolCall
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return reply.String(), calls, nil
+		}
+		if err != nil {
+			return reply.String(), nil, err
+		}
+		for _, choice := range resp.Choices {
+			for _, tc := range choice.Delta.ToolCalls {
+				i := len(calls)
+				if tc.Index != nil {
+					i = *tc.Index
+				} else if tc.ID == "" && i > 0 {
+					i--
+				}
+				for len(calls) <= i {
+					calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+				}
+				if tc.ID != "" {
+					calls[i].ID = tc.ID
+				}
+				calls[i].Function.Name += tc.Function.Name
+				calls[i].Function.Arguments += tc.Function.Arguments
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			reply.WriteString(choice.Delta.Content)
+			onDelta(choice.Delta.Content)
+		}
+	}
+}
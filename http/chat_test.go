@@ -0,0 +1,93 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+// fakeOpenAI 模拟 OpenAI 兼容的聊天接口，流式请求按 chunks 逐段返回，记录收到的消息
+type fakeOpenAI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests [][]openai.ChatCompletionMessage
+}
+
+func newFakeOpenAI(t *testing.T, chunks ...string) *fakeOpenAI {
+	f := &fakeOpenAI{}
+	f.Server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req openai.ChatCompletionRequest
+		_ = json.Unmarshal(body, &req)
+		f.mu.Lock()
+		f.requests = append(f.requests, req.Messages)
+		f.mu.Unlock()
+		if !req.Stream {
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, strings.Join(chunks, ""))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", c)
+			w.(nethttp.Flusher).Flush()
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// last 最后一次请求的消息
+func (f *fakeOpenAI) last() []openai.ChatCompletionMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[len(f.requests)-1]
+}
+
+func TestChatGPTProvider(t *testing.T) {
+	srv := newFakeOpenAI(t, "？你好", "呀")
+	c := &config.Config{RobotMode: "chatgpt", RobotTimeout: 5}
+	c.ChatGPT.APIUrl = srv.URL
+	c.ChatGPT.APIToken = "test"
+	svcCtx := &svc.ServiceContext{}
+	svcCtx.SetConfig(c)
+
+	p, ok := ChatProviderOf("chatgpt")
+	if !ok {
+		t.Fatal("ChatGPT not registered")
+	}
+	if reply, err := p.Chat(context.Background(), svcCtx, &ChatRequest{Msg: "hi"}); err != nil || reply != "你好呀" {
+		t.Fatalf("Chat = %q, %v", reply, err)
+	}
+	var deltas []string
+	reply, err := p.(ChatStreamProvider).ChatStream(context.Background(), svcCtx, &ChatRequest{Msg: "hi"}, func(d string) {
+		deltas = append(deltas, d)
+	})
+	if err != nil || reply != "你好呀" || strings.Join(deltas, "|") != "你好|呀" {
+		t.Fatalf("ChatStream = %q %q, %v", reply, deltas, err)
+	}
+	if p := (chatGPTProvider{}); p.client(c) != p.client(c) {
+		t.Fatal("client not reused")
+	}
+}
+
+func TestChatChain(t *testing.T) {
+	c := &config.Config{RobotMode: "Qingyunke", RobotFallback: []string{"deepseek", "Unknown", "QINGYUNKE", "ChatGPT"}}
+	var names []string
+	for _, p := range ChatChain(c) {
+		names = append(names, p.Name())
+	}
+	if strings.Join(names, ",") != "QingYunKe,DeepSeek,ChatGPT" {
+		t.Fatalf("chain = %v", names)
+	}
+}
@@ -4,50 +4,78 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/credential"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 
 	gogpt "github.com/sashabaranov/go-openai"
-	"github.com/zeromicro/go-zero/core/logx"
 )
 
-func RequestChatgptRobot(msg string, svcCtx *svc.ServiceContext) (string, error) {
-	// c := gogpt.NewClient(svcCtx.Config.ChatGPT.APIToken)
-	cfg := gogpt.DefaultConfig(svcCtx.Config.ChatGPT.APIToken)
-	cfg.BaseURL = svcCtx.Config.ChatGPT.APIUrl
-	c := gogpt.NewClientWithConfig(cfg)
-	ctx := context.Background()
-	msgs := ""
-	prompt := svcCtx.Config.ChatGPT.Prompt
-	if svcCtx.Config.ChatGPT.Limit {
-		prompt += fmt.Sprintf(" 尽可能的在%v个字内回答", svcCtx.Config.DanmuLen)
+// 全角问号，ChatGPT 的回复有时以它开头
+var chatgptReplyPrefix = []byte{239, 188, 159}
+
+type chatGPTProvider struct{}
+
+func (chatGPTProvider) Name() string { return "ChatGPT" }
+
+func (chatGPTProvider) Timeout(c *config.Config) time.Duration {
+	return chatTimeout(c, c.ChatGPT.Timeout)
+}
+
+func (chatGPTProvider) client(c *config.Config) *gogpt.Client {
+	return openAIClient(credential.Lookup(c.ChatGPT.APIToken, credential.KeyChatGPTAPIToken), c.ChatGPT.APIUrl)
+}
+
+// request 构建包含该用户对话记忆的请求
+func (chatGPTProvider) request(svcCtx *svc.ServiceContext, req *ChatRequest) gogpt.ChatCompletionRequest {
+	c := svcCtx.Config()
+	prompt := c.ChatGPT.Prompt
+	if c.ChatGPT.Limit {
+		prompt += fmt.Sprintf(" 尽可能的在%v个字内回答", c.DanmuLen)
 	}
-	req := gogpt.ChatCompletionRequest{
-		Model: svcCtx.Config.ChatGPT.Model, //gogpt.GPT3Dot5Turbo0613,
-		Messages: []gogpt.ChatCompletionMessage{
-			{
-				Role: gogpt.ChatMessageRoleAssistant,
-				//Content: fmt.Sprintf("你是一个非常幽默的机器人助理，尽可能的在%v个字符内回答，不要使用emoji等表情符号，可以使用颜文字", svcCtx.Config.DanmuLen),
-				Content: prompt,
-			},
-			{
-				Role:    gogpt.ChatMessageRoleUser,
-				Content: msg,
-			},
-		},
+	return gogpt.ChatCompletionRequest{
+		Model: c.ChatGPT.Model, //gogpt.GPT3Dot5Turbo0613,
+		Messages: chatMessages(svcCtx, gogpt.ChatCompletionMessage{
+			Role: gogpt.ChatMessageRoleAssistant,
+			//Content: fmt.Sprintf("你是一个非常幽默的机器人助理，尽可能的在%v个字符内回答，不要使用emoji等表情符号，可以使用颜文字", c.DanmuLen),
+			Content: prompt,
+		}, req),
 	}
-	resp, err := c.CreateChatCompletion(ctx, req)
+}
+
+func (p chatGPTProvider) Chat(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest) (string, error) {
+	reply, err := completeChat(ctx, svcCtx, p.client(svcCtx.Config()), p.request(svcCtx, req), req, nil)
 	if err != nil {
 		return "", err
 	}
-	logx.Infof("本次开销：%v tokens", resp.Usage.TotalTokens)
-	for _, v := range resp.Choices {
-		data := []byte(v.Message.Content)
-		if bytes.HasPrefix(data, []byte{239, 188, 159}) {
-			data = bytes.TrimPrefix(data, []byte{239, 188, 159})
+	data := bytes.TrimPrefix([]byte(reply), chatgptReplyPrefix)
+	data = bytes.ReplaceAll(data, []byte{10, 10}, []byte{})
+	msgs := string(data)
+	rememberChat(svcCtx, req, msgs)
+	return msgs, nil
+}
+
+func (p chatGPTProvider) ChatStream(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, onDelta func(string)) (string, error) {
+	first := true
+	reply, err := completeChat(ctx, svcCtx, p.client(svcCtx.Config()), p.request(svcCtx, req), req, func(delta string) {
+		if first {
+			delta = strings.TrimPrefix(delta, string(chatgptReplyPrefix))
+			first = delta == ""
 		}
-		data = bytes.ReplaceAll(data, []byte{10, 10}, []byte{})
-		msgs += string(data)
+		onDelta(delta)
+	})
+	reply = strings.TrimPrefix(reply, string(chatgptReplyPrefix))
+	if err != nil {
+		return reply, err
 	}
-	return msgs, nil
+	rememberChat(svcCtx, req, reply)
+	return reply, nil
+}
+
+// RequestChatgptRobot 请求 ChatGPT，不限制超时，不使用对话记忆
+func RequestChatgptRobot(msg string, svcCtx *svc.ServiceContext) (string, error) {
+	return chatGPTProvider{}.Chat(context.Background(), svcCtx, &ChatRequest{Msg: msg})
 }
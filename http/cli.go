@@ -1,15 +1,86 @@
 package http
 
-import "github.com/go-resty/resty/v2"
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-resty/resty/v2"
+)
 
 const (
 	UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
 	userAgent = UserAgent
 )
 
-// 调用GetLoginInfo后，对全局变量cookie赋值
-var CookieStr string
-var CookieList = make(map[string]string)
+// cookieJar 登录 cookie 的快照，创建后不再修改，更新时整体替换
+type cookieJar struct {
+	str  string
+	list map[string]string
+}
+
+// 登录、刷新 cookie 和加载历史登录信息时替换，其他地方通过 Cookie、CookieValue 读取
+var cookies atomic.Pointer[cookieJar]
+
+func currentCookies() *cookieJar {
+	if j := cookies.Load(); j != nil {
+		return j
+	}
+	return &cookieJar{}
+}
+
+// Cookie 当前登录的 cookie，请求头 cookie 的值
+func Cookie() string {
+	return currentCookies().str
+}
+
+// CookieValue 当前登录 cookie 中 name 的值
+func CookieValue(name string) (string, bool) {
+	v, ok := currentCookies().list[name]
+	return v, ok
+}
+
+// CSRF 当前登录的 csrf，即 cookie 中的 bili_jct
+func CSRF() string {
+	v, _ := CookieValue("bili_jct")
+	return v
+}
+
+// Cookies 当前登录 cookie 键值对的副本
+func Cookies() map[string]string {
+	list := currentCookies().list
+	m := make(map[string]string, len(list))
+	for k, v := range list {
+		m[k] = v
+	}
+	return m
+}
+
+// SetCookies 替换当前登录的 cookie，str 为空时由 list 生成
+func SetCookies(str string, list map[string]string) {
+	m := make(map[string]string, len(list))
+	for k, v := range list {
+		m[k] = v
+	}
+	if str == "" {
+		str = joinCookies(m)
+	}
+	cookies.Store(&cookieJar{str: str, list: m})
+}
+
+// joinCookies 按名称排序拼接为请求头 cookie 的值
+func joinCookies(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + "=" + m[k] + ";")
+	}
+	return b.String()
+}
 
 // 全局客户端对象
 var cli *resty.Client
@@ -10,9 +10,9 @@ import (
 )
 
 func GetDanmuToken(roomid int, spiInfo *entity.SPIInfo) (danmuAuthDatas *entity.DanmuAuthData, err error) {
-	var url = fmt.Sprintf("https://api.live.bilibili.com/xlive/web-room/v1/index/getDanmuInfo?id=%v&type=0", roomid)
+	var url = DefaultBili().url(liveHost, fmt.Sprintf("/xlive/web-room/v1/index/getDanmuInfo?id=%v&type=0", roomid))
 	var resp *resty.Response
-	cookies := CookieStr + fmt.Sprintf("buvid3=%s;", spiInfo.Data.B3) + fmt.Sprintf("buvid4=%s;", spiInfo.Data.B4)
+	cookies := Cookie() + fmt.Sprintf("buvid3=%s;", spiInfo.Data.B3) + fmt.Sprintf("buvid4=%s;", spiInfo.Data.B4)
 
 	if resp, err = cli.R().
 		SetHeader("user-agent", userAgent).
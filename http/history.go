@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+)
+
+// ExportChatHistory 把直播间的对话记录按用户导出为 json，格式与 ImportChatHistory 读取的格式相同
+func ExportChatHistory(ctx context.Context, m model.ChatHistoryModel, w io.Writer) error {
+	rows, err := m.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	sessions := make([]*chatSession, 0)
+	var s *chatSession
+	for _, row := range rows {
+		if s == nil || s.Uid != row.Uid {
+			s = &chatSession{Uid: row.Uid}
+			sessions = append(sessions, s)
+		}
+		t := time.Unix(row.Time, 0)
+		if row.Uname != "" {
+			s.Uname = row.Uname
+		}
+		s.Turns = append(s.Turns, chatTurn{Role: row.Role, Content: row.Content, Time: t})
+		s.LastActive = t
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sessions)
+}
+
+// ImportChatHistory 导入 json 格式的对话记录，返回新导入的消息数，全部导入成功或全部失败；已有的相同消息被跳过，重复导入同一文件不会产生重复记录
+// 支持 ExportChatHistory 导出的按用户分组的格式，以及旧版本保存在 db/history/room_<id>.json 中不区分用户的消息列表
+// 没有时间的消息使用 at 作为时间，旧版本的消息不区分用户，导入后 uid 为 0，不会作为对话记忆
+func ImportChatHistory(ctx context.Context, m model.ChatHistoryModel, r io.Reader, at time.Time) (int, error) {
+	var items []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return 0, err
+	}
+	var rows []*model.ChatHistoryBase
+	for _, item := range items {
+		var probe struct {
+			Turns json.RawMessage `json:"turns"`
+		}
+		if err := json.Unmarshal(item, &probe); err != nil {
+			return 0, err
+		}
+		if probe.Turns == nil {
+			var msg openai.ChatCompletionMessage
+			if err := json.Unmarshal(item, &msg); err != nil {
+				return 0, err
+			}
+			if msg.Role == openai.ChatMessageRoleSystem || msg.Content == "" {
+				continue
+			}
+			rows = append(rows, &model.ChatHistoryBase{Role: msg.Role, Content: msg.Content, Time: at.Unix()})
+			continue
+		}
+		var s chatSession
+		if err := json.Unmarshal(item, &s); err != nil {
+			return 0, err
+		}
+		for _, t := range s.Turns {
+			when := t.Time
+			if when.IsZero() {
+				when = s.LastActive
+			}
+			if when.IsZero() {
+				when = at
+			}
+			rows = append(rows, &model.ChatHistoryBase{Uid: s.Uid, Uname: s.Uname, Role: t.Role, Content: t.Content, Time: when.Unix()})
+		}
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	n, err := m.Import(ctx, rows...)
+	return int(n), err
+}
+
+// ImportChatHistoryFile 导入 json 文件中的对话记录，没有时间的消息使用文件的修改时间
+func ImportChatHistoryFile(ctx context.Context, m model.ChatHistoryModel, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	n, err := ImportChatHistory(ctx, m, f, info.ModTime())
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	}
+	return n, err
+}
@@ -0,0 +1,434 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/credential"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// 旧版本明文保存登录信息的文件，启动时迁移到凭据库
+const (
+	cookieFile       = "token/bili_token.txt"
+	cookieListFile   = "token/bili_token.json"
+	refreshTokenFile = "token/bili_refresh_token.txt"
+)
+
+var (
+	// ErrNotLogin 未登录或登录已失效且无法刷新，需要重新扫码登录
+	ErrNotLogin = errors.New("未登录或登录已失效")
+	// ErrQRExpired 登录二维码已失效
+	ErrQRExpired = errors.New("二维码已失效")
+	// ErrNoRefreshToken 没有保存 refresh_token，无法刷新 cookie
+	ErrNoRefreshToken = errors.New("没有可用的refresh_token")
+)
+
+// 刷新 cookie 时生成 correspondPath 的公钥
+const refreshPublicKey = `-----BEGIN PUBLIC KEY-----
+MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDLgd2OAkcGVtoE3ThUREbio0Eg
+Uc/prcajMKXvkCKFCWhJYJcLkcM2DKKcSeFpD/j6Boy538YXnR6VhcuUJOhH2x71
+nzPjfdTcqMz7djHum0qSZA0AyCBDABUqCrfNgCiJ00Ra7GmRj+YCK1NJEuewlb40
+JNrRuoEUXpabUzGB8QIDAQAB
+-----END PUBLIC KEY-----`
+
+var refreshCsrfRegexp = regexp.MustCompile(`<div id="1-name">(\w+)</div>`)
+
+// 登录检查、刷新和扫码登录都会修改全局 cookie，同一时间只允许一个
+var loginLocked sync.Mutex
+
+var refreshToken string
+
+// CheckLogin 通过 nav 接口检查当前 cookie 是否有效，失效时返回 ErrNotLogin
+func CheckLogin() (*entity.UserInfo, error) {
+	if Cookie() == "" {
+		return nil, ErrNotLogin
+	}
+	r, err := DefaultBili().Nav()
+	if err != nil {
+		return nil, err
+	}
+	if r.Code == -101 || (r.Code == 0 && !r.Data.IsLogin) {
+		return r, ErrNotLogin
+	}
+	if r.Code != 0 {
+		return r, fmt.Errorf("检查登录状态失败：%d %s", r.Code, r.Message)
+	}
+	return r, nil
+}
+
+// NeedRefresh 检查 cookie 是否需要刷新，同时返回服务器时间戳（毫秒）
+func NeedRefresh() (bool, int64, error) {
+	resp, err := cli.R().
+		SetHeader("user-agent", userAgent).
+		SetHeader("cookie", Cookie()).
+		SetQueryParam("csrf", CSRF()).
+		Get(DefaultBili().url(passportHost, "/x/passport-login/web/cookie/info"))
+	if err != nil {
+		logx.Error("请求cookie/info失败：", err)
+		return false, 0, err
+	}
+	r := &entity.CookieInfo{}
+	if err = json.Unmarshal(resp.Body(), r); err != nil {
+		logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
+		return false, 0, err
+	}
+	if r.Code == -101 {
+		return true, 0, ErrNotLogin
+	}
+	if r.Code != 0 {
+		return false, 0, fmt.Errorf("检查cookie状态失败：%d %s", r.Code, r.Message)
+	}
+	return r.Data.Refresh, r.Data.Timestamp, nil
+}
+
+// EnsureLogin 检查登录状态，cookie 临近过期或已失效时尝试刷新
+// 返回 ErrNotLogin 时需要重新扫码登录，其他错误多为网络问题，登录状态未知
+func EnsureLogin() error {
+	loginLocked.Lock()
+	defer loginLocked.Unlock()
+	info, err := CheckLogin()
+	if err != nil && !errors.Is(err, ErrNotLogin) {
+		return err
+	}
+	if err == nil {
+		need, ts, rerr := NeedRefresh()
+		if rerr != nil || !need {
+			logx.Infof("用户 %s 登录有效", info.Data.Uname)
+			return nil
+		}
+		logx.Info("cookie即将过期，开始刷新")
+		if rerr = refreshCookie(ts); rerr != nil {
+			// cookie 仍然有效，下次再刷新
+			logx.Errorf("刷新cookie失败：%v", rerr)
+		}
+		return nil
+	}
+	logx.Info("登录已失效，尝试刷新cookie")
+	if err = refreshCookie(0); err != nil {
+		logx.Errorf("刷新cookie失败：%v", err)
+		return ErrNotLogin
+	}
+	if _, err = CheckLogin(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RefreshCookie 使用 refresh_token 刷新 cookie 并保存
+func RefreshCookie() error {
+	loginLocked.Lock()
+	defer loginLocked.Unlock()
+	return refreshCookie(0)
+}
+
+// refreshCookie ts 为 cookie/info 返回的时间戳，为 0 时使用本地时间
+func refreshCookie(ts int64) error {
+	oldToken := loadRefreshToken()
+	if oldToken == "" {
+		return ErrNoRefreshToken
+	}
+	if ts == 0 {
+		ts = time.Now().UnixMilli()
+	}
+	path, err := correspondPath(ts)
+	if err != nil {
+		return err
+	}
+	refreshCsrf, err := getRefreshCsrf(path)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.R().
+		SetHeader("user-agent", userAgent).
+		SetHeader("cookie", Cookie()).
+		SetFormData(map[string]string{
+			"csrf":          CSRF(),
+			"refresh_csrf":  refreshCsrf,
+			"source":        "main_web",
+			"refresh_token": oldToken,
+		}).
+		Post(DefaultBili().url(passportHost, "/x/passport-login/web/cookie/refresh"))
+	if err != nil {
+		logx.Error("请求cookie/refresh失败：", err)
+		return err
+	}
+	r := &entity.CookieRefresh{}
+	if err = json.Unmarshal(resp.Body(), r); err != nil {
+		logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
+		return err
+	}
+	if r.Code != 0 {
+		return fmt.Errorf("刷新cookie失败：%d %s", r.Code, r.Message)
+	}
+	applyCookies(resp.Header().Values("Set-Cookie"))
+	refreshToken = r.Data.RefreshToken
+	if err = saveCookie(); err != nil {
+		return err
+	}
+	logx.Info("cookie刷新成功")
+
+	// 确认刷新，使旧的 refresh_token 失效，失败不影响新的 cookie
+	resp, err = cli.R().
+		SetHeader("user-agent", userAgent).
+		SetHeader("cookie", Cookie()).
+		SetFormData(map[string]string{
+			"csrf":          CSRF(),
+			"refresh_token": oldToken,
+		}).
+		Post(DefaultBili().url(passportHost, "/x/passport-login/web/confirm/refresh"))
+	if err != nil {
+		logx.Error("请求confirm/refresh失败：", err)
+		return nil
+	}
+	confirm := &entity.LoginInfoPre{}
+	if err = json.Unmarshal(resp.Body(), confirm); err == nil && confirm.Code != 0 {
+		logx.Errorf("确认刷新cookie失败：%d %s", confirm.Code, confirm.Message)
+	}
+	return nil
+}
+
+// correspondPath 用公钥加密 refresh_{ts}，得到获取 refresh_csrf 的路径
+func correspondPath(ts int64) (string, error) {
+	block, _ := pem.Decode([]byte(refreshPublicKey))
+	if block == nil {
+		return "", errors.New("解析公钥失败")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", err
+	}
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return "", errors.New("公钥类型错误")
+	}
+	encrypted, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, rsaPub, []byte(fmt.Sprintf("refresh_%d", ts)), nil)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(encrypted), nil
+}
+
+func getRefreshCsrf(path string) (string, error) {
+	resp, err := cli.R().
+		SetHeader("user-agent", userAgent).
+		SetHeader("cookie", Cookie()).
+		Get(DefaultBili().url(wwwHost, "/correspond/1/"+path))
+	if err != nil {
+		logx.Error("请求refresh_csrf失败：", err)
+		return "", err
+	}
+	m := refreshCsrfRegexp.FindSubmatch(resp.Body())
+	if m == nil {
+		return "", fmt.Errorf("获取refresh_csrf失败：%s", resp.Status())
+	}
+	return string(m[1]), nil
+}
+
+// applyCookies 用响应中的 Set-Cookie 更新全局 cookie，在副本上修改后整体替换
+func applyCookies(setCookies []string) {
+	m := Cookies()
+	for _, v := range setCookies {
+		pair := strings.SplitN(strings.SplitN(v, ";", 2)[0], "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			continue
+		}
+		name := strings.TrimSpace(pair[0])
+		if strings.Contains(strings.ToLower(v), "max-age=0") || pair[1] == "" {
+			delete(m, name)
+			continue
+		}
+		m[name] = pair[1]
+	}
+	SetCookies(joinCookies(m), m)
+}
+
+// saveCookie 将 cookie 和 refresh_token 保存到凭据库，下次启动时由 SetHistoryCookie 加载
+func saveCookie() error {
+	jar := currentCookies()
+	tokenstr, _ := json.Marshal(jar.list)
+	entries := [][2]string{
+		{credential.KeyBiliCookie, jar.str},
+		{credential.KeyBiliCookieList, string(tokenstr)},
+	}
+	if refreshToken != "" {
+		entries = append(entries, [2]string{credential.KeyBiliRefreshToken, refreshToken})
+	}
+	for _, e := range entries {
+		if err := credential.Set(e[0], e[1]); err != nil {
+			logx.Errorf("保存登录信息失败：%v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+func loadRefreshToken() string {
+	if refreshToken != "" {
+		return refreshToken
+	}
+	refreshToken, _ = credential.Get(credential.KeyBiliRefreshToken)
+	return refreshToken
+}
+
+// KeepLogin 每隔 interval 检查一次登录状态，cookie 临近过期时自动刷新，ctx 取消后退出
+func KeepLogin(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := EnsureLogin(); err != nil {
+				logx.Errorf("登录状态检查失败：%v", err)
+			}
+		}
+	}
+}
+
+// QRLoginState 扫码登录的状态
+type QRLoginState int
+
+const (
+	QRLoginPending   QRLoginState = iota // 等待扫码
+	QRLoginScanned                       // 已扫码，等待在手机上确认
+	QRLoginConfirmed                     // 已确认，cookie 已保存
+	QRLoginExpired                       // 二维码已失效
+)
+
+func (s QRLoginState) String() string {
+	switch s {
+	case QRLoginPending:
+		return "等待扫码"
+	case QRLoginScanned:
+		return "已扫码，等待确认"
+	case QRLoginConfirmed:
+		return "登录成功"
+	case QRLoginExpired:
+		return "二维码已失效"
+	}
+	return fmt.Sprintf("QRLoginState(%d)", int(s))
+}
+
+// QRLoginSession 一次扫码登录，由界面或命令行展示 Url 对应的二维码并调用 Poll 等待结果
+type QRLoginSession struct {
+	Url string
+	Key string
+
+	locked sync.Mutex
+	state  QRLoginState
+	info   *entity.LoginInfoData
+}
+
+// NewQRLoginSession 申请登录二维码
+func NewQRLoginSession() (*QRLoginSession, error) {
+	r, err := GetLoginUrl()
+	if err != nil {
+		return nil, err
+	}
+	if r.Data.OauthKey == "" {
+		return nil, errors.New("获取登录二维码失败")
+	}
+	return &QRLoginSession{Url: r.Data.Url, Key: r.Data.OauthKey}, nil
+}
+
+// State 返回最近一次查询到的状态
+func (s *QRLoginSession) State() QRLoginState {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	return s.state
+}
+
+// Check 查询一次扫码状态，确认登录后更新并保存 cookie
+func (s *QRLoginSession) Check() (QRLoginState, error) {
+	resp, err := cli.R().
+		SetHeader("user-agent", userAgent).
+		SetQueryParam("qrcode_key", s.Key).
+		Get(DefaultBili().url(passportHost, "/x/passport-login/web/qrcode/poll"))
+	if err != nil {
+		logx.Error("请求getLoginInfo失败：", err)
+		return s.State(), err
+	}
+	data := &entity.LoginInfoData{}
+	pre := &entity.LoginInfoPre{}
+	if err = json.Unmarshal(resp.Body(), pre); err == nil {
+		err = json.Unmarshal(resp.Body(), data)
+	}
+	if err != nil {
+		logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
+		return s.State(), err
+	}
+	if pre.Code != 0 {
+		return s.State(), errors.New(pre.Message)
+	}
+	var state QRLoginState
+	switch data.Data.Code {
+	case 0:
+		state = QRLoginConfirmed
+	case 86101:
+		state = QRLoginPending
+	case 86090:
+		state = QRLoginScanned
+	case 86038:
+		state = QRLoginExpired
+	default:
+		return s.State(), fmt.Errorf("扫码登录失败：%d %s", data.Data.Code, data.Data.Message)
+	}
+	if state == QRLoginConfirmed {
+		loginLocked.Lock()
+		applyCookies(resp.Header().Values("Set-Cookie"))
+		refreshToken = data.Data.RefreshToken
+		err = saveCookie()
+		loginLocked.Unlock()
+		if err != nil {
+			return s.State(), err
+		}
+	}
+	s.locked.Lock()
+	s.state = state
+	s.info = data
+	s.locked.Unlock()
+	return state, nil
+}
+
+// Poll 每隔 interval 查询一次扫码状态，直到登录成功、二维码失效或 ctx 取消
+// 状态变化时调用 onChange，可以为 nil；二维码失效时返回 ErrQRExpired
+func (s *QRLoginSession) Poll(ctx context.Context, interval time.Duration, onChange func(QRLoginState)) error {
+	last := s.State()
+	for {
+		state, err := s.Check()
+		if err != nil {
+			return err
+		}
+		if state != last && onChange != nil {
+			onChange(state)
+		}
+		last = state
+		switch state {
+		case QRLoginConfirmed:
+			logx.Info("登录成功！")
+			return nil
+		case QRLoginExpired:
+			return ErrQRExpired
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
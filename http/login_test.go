@@ -0,0 +1,152 @@
+package http
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/credential"
+)
+
+// useCookies 设置测试使用的登录 cookie，测试结束后恢复
+func useCookies(t *testing.T, list map[string]string) {
+	t.Helper()
+	old := cookies.Load()
+	t.Cleanup(func() { cookies.Store(old) })
+	SetCookies("", list)
+}
+
+func TestApplyCookies(t *testing.T) {
+	useCookies(t, map[string]string{"SESSDATA": "old", "bili_jct": "csrf1", "sid": "x"})
+	before := Cookies()
+	applyCookies([]string{
+		"SESSDATA=new%2C123; Path=/; Domain=bilibili.com; Expires=Tue, 01 Jan 2030 00:00:00 GMT; HttpOnly",
+		"bili_jct=csrf2; Path=/; Domain=bilibili.com",
+		"sid=; Path=/; Max-Age=0",
+		"broken",
+	})
+	want := "SESSDATA=new%2C123;bili_jct=csrf2;"
+	if Cookie() != want {
+		t.Errorf("cookie string: want %q, got %q", want, Cookie())
+	}
+	if _, ok := CookieValue("sid"); ok {
+		t.Error("cleared cookie should be removed")
+	}
+	if CSRF() != "csrf2" {
+		t.Errorf("csrf: want csrf2, got %q", CSRF())
+	}
+	// 已经取出的副本不受影响
+	if before["sid"] != "x" {
+		t.Error("copy returned by Cookies should not change")
+	}
+}
+
+// useCredentials 使用临时的凭据库，测试结束后恢复
+func useCredentials(t *testing.T) {
+	t.Helper()
+	store, err := credential.NewFileStore(filepath.Join(t.TempDir(), "credentials"), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.SetDefault(store)
+	t.Cleanup(func() { credential.SetDefault(nil) })
+}
+
+func TestMigrateAPITokens(t *testing.T) {
+	useCredentials(t)
+	var c config.Config
+	c.ChatGPT.APIToken = "yaml-gpt"
+	c.DeepSeek.APIToken = "yaml-ds"
+	if err := credential.Set(credential.KeyDeepSeekAPIToken, "stored-ds"); err != nil {
+		t.Fatal(err)
+	}
+	MigrateAPITokens(&c)
+
+	// 凭据库中没有的令牌被迁移，已有的不被配置文件覆盖
+	if v, _ := credential.Get(credential.KeyChatGPTAPIToken); v != "yaml-gpt" {
+		t.Errorf("chatgpt token in store = %q", v)
+	}
+	if v, _ := credential.Get(credential.KeyDeepSeekAPIToken); v != "stored-ds" {
+		t.Errorf("deepseek token in store = %q", v)
+	}
+	if v := credential.Lookup(c.DeepSeek.APIToken, credential.KeyDeepSeekAPIToken); v != "stored-ds" {
+		t.Errorf("Lookup should prefer the store, got %q", v)
+	}
+	if err := credential.Delete(credential.KeyDeepSeekAPIToken); err != nil {
+		t.Fatal(err)
+	}
+	if v := credential.Lookup(c.DeepSeek.APIToken, credential.KeyDeepSeekAPIToken); v != "yaml-ds" {
+		t.Errorf("Lookup should fall back to the config, got %q", v)
+	}
+}
+
+// 用 -race 运行，刷新 cookie 与发送弹幕并发时不能有数据竞争
+func TestRefreshCookieWhileSending(t *testing.T) {
+	srv, c := newTestBili(t)
+	SetBaseURL(srv.URL)
+	t.Cleanup(func() { SetBaseURL("") })
+	if cli == nil {
+		InitHttpClient()
+	}
+	useCredentials(t)
+	useCookies(t, map[string]string{"SESSDATA": "bilitest-sess-0", "bili_jct": "bilitest-csrf-0", "DedeUserID": "1"})
+	refreshToken = "bilitest-token-0"
+	t.Cleanup(func() { refreshToken = "" })
+
+	const rounds = 20
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if err := RefreshCookie(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < rounds; i++ {
+			if _, err := c.SendDanmu(100, "你好"); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+
+	if n := srv.Refreshes(); n != rounds {
+		t.Fatalf("want %d refreshes, got %d", rounds, n)
+	}
+	if CSRF() != "bilitest-csrf-20" {
+		t.Errorf("csrf after refresh: %q", CSRF())
+	}
+	if v, _ := CookieValue("DedeUserID"); v != "1" {
+		t.Errorf("cookies not in Set-Cookie should be kept, got DedeUserID=%q", v)
+	}
+	for _, d := range srv.Sent() {
+		if !strings.HasPrefix(d.Csrf, "bilitest-csrf-") {
+			t.Errorf("danmu sent with csrf %q", d.Csrf)
+		}
+	}
+	if saved, _ := credential.Get(credential.KeyBiliCookie); saved != Cookie() {
+		t.Errorf("saved cookie %q, want %q", saved, Cookie())
+	}
+}
+
+func TestCorrespondPath(t *testing.T) {
+	a, err := correspondPath(1700000000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1024 位公钥加密结果为 128 字节
+	if len(a) != 256 {
+		t.Errorf("unexpected path length %d", len(a))
+	}
+	if b, _ := correspondPath(1700000000000); a == b {
+		t.Error("OAEP encryption should be randomized")
+	}
+}
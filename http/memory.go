@@ -0,0 +1,165 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// chatTurn 对话记忆中的一条消息，用户的消息带有用户名
+type chatTurn struct {
+	Role    string    `json:"role"` // user 或 assistant
+	Content string    `json:"content"`
+	Time    time.Time `json:"time,omitempty"`
+}
+
+// chatSession 一个用户在一个直播间和机器人的对话，也是导出文件的格式
+type chatSession struct {
+	Uid        int64      `json:"uid"`
+	Uname      string     `json:"uname"`
+	Turns      []chatTurn `json:"turns"`
+	LastActive time.Time  `json:"last_active"`
+}
+
+const (
+	// chatHistoryLimit 读取对话记忆时最多查询的消息数，token 预算通常先用完
+	chatHistoryLimit = 200
+	// chatPruneInterval 清理过期对话记录的间隔
+	chatPruneInterval = time.Hour
+)
+
+var (
+	chatNow       = time.Now
+	chatLastPrune sync.Map // model.ChatHistoryModel -> time.Time
+)
+
+// chatHistory 用户在 ttl 内连续的对话记忆，相邻两条消息间隔超过 ttl 时更早的对话被忘记
+func chatHistory(m model.ChatHistoryModel, uid int64, budget int, ttl time.Duration) []chatTurn {
+	if m == nil || uid == 0 || budget <= 0 {
+		return nil
+	}
+	rows, err := m.FindRecent(context.Background(), uid, chatHistoryLimit)
+	if err != nil {
+		logx.Errorf("读取用户 %d 的对话记忆失败：%v", uid, err)
+		return nil
+	}
+	start, last := len(rows), chatNow()
+	for start > 0 {
+		t := time.Unix(rows[start-1].Time, 0)
+		if ttl > 0 && last.Sub(t) > ttl {
+			break
+		}
+		start, last = start-1, t
+	}
+	turns := make([]chatTurn, 0, len(rows)-start)
+	for _, row := range rows[start:] {
+		turns = append(turns, chatTurn{Role: row.Role, Content: row.Content, Time: time.Unix(row.Time, 0)})
+	}
+	return trimTurns(turns, budget)
+}
+
+// speakerContent 在用户的消息前加上用户名，让机器人知道是谁在说话
+func speakerContent(req *ChatRequest) string {
+	if req.Uname == "" {
+		return req.Msg
+	}
+	return fmt.Sprintf("%s：%s", req.Uname, req.Msg)
+}
+
+// estimateTokens 粗略估算 token 数：非 ASCII 字符每个算 1 个，ASCII 字符每 4 个算 1 个，每条消息另加 4 个
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4 + 4
+}
+
+// trimTurns 从最早的对话开始丢弃，直到不超过 budget，保留的记忆总是从用户的消息开始
+func trimTurns(turns []chatTurn, budget int) []chatTurn {
+	total := 0
+	for _, t := range turns {
+		total += estimateTokens(t.Content)
+	}
+	for len(turns) > 0 && (total > budget || turns[0].Role != openai.ChatMessageRoleUser) {
+		total -= estimateTokens(turns[0].Content)
+		turns = turns[1:]
+	}
+	return append([]chatTurn(nil), turns...)
+}
+
+// memoryTTL 对话记忆的保留时间
+func memoryTTL(svcCtx *svc.ServiceContext) time.Duration {
+	return time.Duration(svcCtx.Config().RobotMemoryTTL) * time.Minute
+}
+
+// chatMessages 由提示词、用户的对话记忆和本次消息构建请求
+func chatMessages(svcCtx *svc.ServiceContext, prompt openai.ChatCompletionMessage, req *ChatRequest) []openai.ChatCompletionMessage {
+	if req.Uname != "" {
+		prompt.Content += " 用户的消息以“用户名：”开头。"
+	}
+	messages := []openai.ChatCompletionMessage{prompt}
+	for _, t := range chatHistory(svcCtx.ChatHistoryModel, req.Uid, svcCtx.Config().RobotMemoryTokens, memoryTTL(svcCtx)) {
+		messages = append(messages, openai.ChatCompletionMessage{Role: t.Role, Content: t.Content})
+	}
+	return append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleUser,
+		Content: speakerContent(req),
+	})
+}
+
+// rememberChat 请求成功后把这一轮对话写入数据库，用户的消息和回复一起写入
+func rememberChat(svcCtx *svc.ServiceContext, req *ChatRequest, reply string) {
+	c := svcCtx.Config()
+	m := svcCtx.ChatHistoryModel
+	if m == nil || req.Uid == 0 || c.RobotMemoryTokens <= 0 || reply == "" {
+		return
+	}
+	now := chatNow().Unix()
+	err := m.Append(context.Background(),
+		&model.ChatHistoryBase{Uid: req.Uid, Uname: req.Uname, Role: openai.ChatMessageRoleUser, Content: speakerContent(req), Time: now},
+		&model.ChatHistoryBase{Uid: req.Uid, Uname: req.Uname, Role: openai.ChatMessageRoleAssistant, Content: reply, Time: now},
+	)
+	if err != nil {
+		logx.Errorf("保存直播间 %d 的对话记录失败：%v", c.RoomId, err)
+		return
+	}
+	pruneChatHistory(svcCtx, false)
+}
+
+// pruneChatHistory 按 RobotHistoryDays 和 RobotHistoryUser 清理对话记录，force 为 false 时每 chatPruneInterval 最多清理一次
+func pruneChatHistory(svcCtx *svc.ServiceContext, force bool) {
+	m := svcCtx.ChatHistoryModel
+	if m == nil {
+		return
+	}
+	now := chatNow()
+	if last, ok := chatLastPrune.Load(m); ok && !force && now.Sub(last.(time.Time)) < chatPruneInterval {
+		return
+	}
+	chatLastPrune.Store(m, now)
+	c := svcCtx.Config()
+	var before time.Time
+	if c.RobotHistoryDays > 0 {
+		before = now.AddDate(0, 0, -c.RobotHistoryDays)
+	}
+	n, err := m.Prune(context.Background(), before, c.RobotHistoryUser)
+	if err != nil {
+		logx.Errorf("清理直播间 %d 的对话记录失败：%v", c.RoomId, err)
+		return
+	}
+	if n > 0 {
+		logx.Infof("清理直播间 %d 的对话记录 %d 条", c.RoomId, n)
+	}
+}
@@ -0,0 +1,203 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"gorm.io/gorm"
+)
+
+// newTestDB 测试使用的内存数据库
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	return db
+}
+
+func newHistoryModel(t *testing.T, roomID int64) model.ChatHistoryModel {
+	return model.NewChatHistoryModel(newTestDB(t), roomID)
+}
+
+// useMemory 测试期间使用内存数据库保存对话记录，并固定当前时间
+func useMemory(t *testing.T, c *config.Config) (*svc.ServiceContext, *time.Time) {
+	now := time.Unix(100000, 0)
+	old := chatNow
+	chatNow = func() time.Time { return now }
+	t.Cleanup(func() { chatNow = old })
+	svcCtx := &svc.ServiceContext{ChatHistoryModel: newHistoryModel(t, int64(c.RoomId))}
+	svcCtx.SetConfig(c)
+	return svcCtx, &now
+}
+
+func remember(svcCtx *svc.ServiceContext, uid int64, uname, msg, reply string) {
+	rememberChat(svcCtx, &ChatRequest{Uid: uid, Uname: uname, Msg: msg}, reply)
+}
+
+func history(svcCtx *svc.ServiceContext, uid int64) []chatTurn {
+	c := svcCtx.Config()
+	return chatHistory(svcCtx.ChatHistoryModel, uid, c.RobotMemoryTokens, memoryTTL(svcCtx))
+}
+
+func TestChatMemoryPerUser(t *testing.T) {
+	svcCtx, now := useMemory(t, &config.Config{RoomId: 1, RobotMemoryTokens: 1000, RobotMemoryTTL: 1})
+
+	remember(svcCtx, 10, "小明", "我叫小明", "你好小明")
+	remember(svcCtx, 20, "小红", "我叫小红", "你好小红")
+	remember(svcCtx, 0, "", "匿名", "不记住")
+
+	h := history(svcCtx, 10)
+	if len(h) != 2 || h[0].Role != openai.ChatMessageRoleUser || h[0].Content != "小明：我叫小明" || h[1].Role != openai.ChatMessageRoleAssistant {
+		t.Fatalf("history = %+v", h)
+	}
+	if h = history(svcCtx, 20); len(h) != 2 || h[1].Content != "你好小红" {
+		t.Fatalf("history = %+v", h)
+	}
+	if h = history(svcCtx, 0); len(h) != 0 {
+		t.Fatalf("anonymous history = %+v", h)
+	}
+
+	// 超时后忘记之前的对话，记录仍然保存在数据库中
+	*now = now.Add(2 * time.Minute)
+	if h = history(svcCtx, 10); len(h) != 0 {
+		t.Fatalf("expired history = %+v", h)
+	}
+	remember(svcCtx, 10, "小明", "又来了", "欢迎回来")
+	if h = history(svcCtx, 10); len(h) != 2 || h[0].Content != "小明：又来了" {
+		t.Fatalf("history after ttl = %+v", h)
+	}
+	if rows, _ := svcCtx.ChatHistoryModel.FindRecent(context.Background(), 10, 10); len(rows) != 4 {
+		t.Fatalf("rows = %d", len(rows))
+	}
+}
+
+func TestChatMemoryTokenBudget(t *testing.T) {
+	svcCtx, _ := useMemory(t, &config.Config{RoomId: 1, RobotMemoryTokens: 150})
+	long := strings.Repeat("很长的话", 10) // 40 个字
+	for i := 0; i < 5; i++ {
+		remember(svcCtx, 10, "", long, long)
+	}
+	// 每轮约 (40+4)*2 = 88 个 token，预算内只能保留最近一轮
+	if h := history(svcCtx, 10); len(h) != 2 {
+		t.Fatalf("history = %d turns", len(h))
+	}
+	if got := trimTurns([]chatTurn{{Role: "assistant", Content: "a"}, {Role: "user", Content: "b"}}, 100); len(got) != 1 || got[0].Role != "user" {
+		t.Fatalf("trim = %+v", got)
+	}
+}
+
+func TestChatHistoryRetention(t *testing.T) {
+	svcCtx, now := useMemory(t, &config.Config{RoomId: 1, RobotMemoryTokens: 1000, RobotHistoryDays: 1, RobotHistoryUser: 4})
+	m := svcCtx.ChatHistoryModel
+	remember(svcCtx, 10, "小明", "很久以前", "嗯")
+	*now = now.Add(48 * time.Hour)
+	for i := 0; i < 3; i++ {
+		remember(svcCtx, 20, "小红", fmt.Sprint(i), "好")
+	}
+	remember(svcCtx, 10, "小明", "最近", "嗯")
+
+	// 距离上次清理不到 chatPruneInterval，只有强制清理生效
+	if rows, _ := m.FindRecent(context.Background(), 20, 10); len(rows) != 6 {
+		t.Fatalf("rows before prune = %d", len(rows))
+	}
+	pruneChatHistory(svcCtx, true)
+	rows, _ := m.FindRecent(context.Background(), 10, 10)
+	if len(rows) != 2 || rows[0].Content != "小明：最近" {
+		t.Fatalf("old rows not pruned: %+v", rows)
+	}
+	rows, _ = m.FindRecent(context.Background(), 20, 10)
+	if len(rows) != 4 || rows[0].Content != "小红：1" {
+		t.Fatalf("per user limit not applied: %+v", rows)
+	}
+}
+
+func TestChatHistoryExportImport(t *testing.T) {
+	svcCtx, _ := useMemory(t, &config.Config{RoomId: 1, RobotMemoryTokens: 1000})
+	remember(svcCtx, 10, "小明", "你好", "你好小明")
+	remember(svcCtx, 20, "小红", "在吗", "在的")
+
+	var buf bytes.Buffer
+	if err := ExportChatHistory(context.Background(), svcCtx.ChatHistoryModel, &buf); err != nil {
+		t.Fatal(err)
+	}
+	m := newHistoryModel(t, 2)
+	at := time.Unix(5000, 0)
+	if n, err := ImportChatHistory(context.Background(), m, &buf, at); err != nil || n != 4 {
+		t.Fatalf("import = %d, %v", n, err)
+	}
+	rows, _ := m.FindRecent(context.Background(), 10, 10)
+	if len(rows) != 2 || rows[0].Uname != "小明" || rows[1].Content != "你好小明" || rows[0].Time != chatNow().Unix() {
+		t.Fatalf("imported rows = %+v", rows)
+	}
+	// 重复导入时跳过已有的消息
+	if err := ExportChatHistory(context.Background(), svcCtx.ChatHistoryModel, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := ImportChatHistory(context.Background(), m, &buf, at); err != nil || n != 0 {
+		t.Fatalf("import again = %d, %v", n, err)
+	}
+	if rows, _ = m.FindRecent(context.Background(), 10, 10); len(rows) != 2 {
+		t.Fatalf("duplicated rows = %+v", rows)
+	}
+
+	// 旧版本不区分用户的消息列表
+	legacy := `[{"role":"system","content":"提示词"},{"role":"user","content":"你好"},{"role":"assistant","content":"你好呀"}]`
+	for i, want := range []int{2, 0} {
+		if n, err := ImportChatHistory(context.Background(), m, strings.NewReader(legacy), at); err != nil || n != want {
+			t.Fatalf("import legacy #%d = %d, %v", i, n, err)
+		}
+	}
+	rows, _ = m.FindRecent(context.Background(), 0, 10)
+	if len(rows) != 2 || rows[0].Role != "user" || rows[1].Time != at.Unix() {
+		t.Fatalf("legacy rows = %+v", rows)
+	}
+
+	// 格式错误时不导入任何消息
+	bad := `[{"uid":30,"turns":[{"role":"user","content":"a"}]},{"role":1}]`
+	if _, err := ImportChatHistory(context.Background(), m, strings.NewReader(bad), at); err == nil {
+		t.Fatal("bad file imported")
+	}
+	if rows, _ = m.FindRecent(context.Background(), 30, 10); len(rows) != 0 {
+		t.Fatalf("partial import: %+v", rows)
+	}
+}
+
+func TestChatGPTUsesMemory(t *testing.T) {
+	srv := newFakeOpenAI(t, "记住了")
+	c := &config.Config{RoomId: 1, RobotTimeout: 5, RobotMemoryTokens: 1000, RobotMemoryTTL: 30}
+	c.ChatGPT.APIUrl = srv.URL
+	c.ChatGPT.APIToken = "test"
+	svcCtx, _ := useMemory(t, c)
+	p := chatGPTProvider{}
+
+	if _, err := p.Chat(context.Background(), svcCtx, &ChatRequest{Uid: 10, Uname: "小明", Msg: "我喜欢猫"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ChatStream(context.Background(), svcCtx, &ChatRequest{Uid: 20, Uname: "小红", Msg: "你好"}, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Chat(context.Background(), svcCtx, &ChatRequest{Uid: 10, Uname: "小明", Msg: "我喜欢什么"}); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range srv.last()[1:] {
+		got = append(got, m.Role+"|"+m.Content)
+	}
+	want := []string{"user|小明：我喜欢猫", "assistant|记住了", "user|小明：我喜欢什么"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("messages = %q", got)
+	}
+}
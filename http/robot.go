@@ -2,23 +2,44 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/go-resty/resty/v2"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"github.com/zeromicro/go-zero/core/logx"
 	"net/url"
 	"time"
 	"unicode/utf8"
 )
 
+type qingYunKeProvider struct{}
+
+func (qingYunKeProvider) Name() string { return "QingYunKe" }
+
+func (qingYunKeProvider) Timeout(c *config.Config) time.Duration {
+	return chatTimeout(c, 0)
+}
+
+// Chat 青云客没有上下文，不使用对话记忆
+func (qingYunKeProvider) Chat(ctx context.Context, _ *svc.ServiceContext, req *ChatRequest) (string, error) {
+	return requestQingyunkeRobot(ctx, req.Msg)
+}
+
 // 调用青云客机器人api
 func RequestQingyunkeRobot(msg string) (string, error) {
+	return requestQingyunkeRobot(context.Background(), msg)
+}
+
+func requestQingyunkeRobot(ctx context.Context, msg string) (string, error) {
 	var err error
 	var urls = "http://api.qingyunke.com/api.php?key=free&appid=0&msg=" + encodeSpecialChar(msg) + "&_=" + fmt.Sprint(time.Now().UnixMicro())
 	var resp *resty.Response
 
 	if resp, err = cli.R().
+		SetContext(ctx).
 		SetHeader("Content-Type", "utf-8").
 		Get(urls); err != nil {
 		logx.Error("请求qingyunke机器人接口失败：", err)
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+// SendFunc 发送弹幕的实现
+type SendFunc func(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) (*SendResult, error)
+
+var sendFunc atomic.Pointer[SendFunc]
+
+// SetSendFunc 替换 Send 的实现，用于回放和测试时不真正发送弹幕，为 nil 时恢复默认
+func SetSendFunc(f SendFunc) {
+	if f == nil {
+		sendFunc.Store(nil)
+		return
+	}
+	sendFunc.Store(&f)
+}
+
+// SentBullet FakeSender 收到的一条弹幕
+type SentBullet struct {
+	RoomId int
+	Msg    string
+	Reply  []*entity.DanmuMsgTextReplyInfo
+	Time   time.Time
+}
+
+// FakeSender 记录所有发送的弹幕而不请求服务器，配合 SetSendFunc 使用
+type FakeSender struct {
+	// Result 决定每条弹幕的发送结果，为 nil 时全部发送成功
+	Result func(msg string) *SendResult
+
+	locked sync.Mutex
+	sent   []SentBullet
+	notify chan struct{}
+}
+
+func NewFakeSender() *FakeSender {
+	return &FakeSender{notify: make(chan struct{}, 1)}
+}
+
+// Send 实现 SendFunc
+func (f *FakeSender) Send(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) (*SendResult, error) {
+	r := &SendResult{Status: SendAccepted}
+	if f.Result != nil {
+		r = f.Result(msg)
+	}
+	if r.Status == SendAccepted {
+		b := SentBullet{Msg: msg, Reply: reply, Time: time.Now()}
+		if svcCtx != nil {
+			b.RoomId = svcCtx.Config().RoomId
+		}
+		f.locked.Lock()
+		f.sent = append(f.sent, b)
+		f.locked.Unlock()
+		select {
+		case f.notify <- struct{}{}:
+		default:
+		}
+	}
+	return r, r.Err()
+}
+
+// Sent 返回已发送的弹幕
+func (f *FakeSender) Sent() []SentBullet {
+	f.locked.Lock()
+	defer f.locked.Unlock()
+	return append([]SentBullet(nil), f.sent...)
+}
+
+// Messages 返回已发送的弹幕内容
+func (f *FakeSender) Messages() []string {
+	sent := f.Sent()
+	msgs := make([]string, len(sent))
+	for i, b := range sent {
+		msgs[i] = b.Msg
+	}
+	return msgs
+}
+
+// Wait 等待至少发送 n 条弹幕，ctx 取消时返回已发送的弹幕和错误
+func (f *FakeSender) Wait(ctx context.Context, n int) ([]string, error) {
+	for {
+		if msgs := f.Messages(); len(msgs) >= n {
+			return msgs, nil
+		}
+		select {
+		case <-ctx.Done():
+			return f.Messages(), ctx.Err()
+		case <-f.notify:
+		}
+	}
+}
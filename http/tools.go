@@ -0,0 +1,261 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// maxToolRounds 一次回复中最多调用工具的轮数，超过后要求机器人直接回答
+const maxToolRounds = 3
+
+// ChatTool 机器人可以调用的只读工具，查询用户数据时只能查询提问的用户 req.Uid
+type ChatTool interface {
+	// Definition 工具的名称、说明和参数，名称与模型调用时的名称一致
+	Definition() openai.FunctionDefinition
+	// Call 执行工具，args 为模型给出的 json 参数，返回值被编码为 json 交给模型
+	Call(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, args string) (any, error)
+}
+
+// chatToolFunc 用函数实现的工具
+type chatToolFunc struct {
+	def  openai.FunctionDefinition
+	call func(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, args string) (any, error)
+}
+
+func (t chatToolFunc) Definition() openai.FunctionDefinition { return t.def }
+
+func (t chatToolFunc) Call(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, args string) (any, error) {
+	return t.call(ctx, svcCtx, req, args)
+}
+
+var (
+	chatToolsMu sync.RWMutex
+	chatTools   = make(map[string]ChatTool)
+)
+
+// errUnknownAsker 提问的用户未知，不能查询用户自己的数据
+var errUnknownAsker = errors.New("不知道是谁在提问，无法查询")
+
+func init() {
+	noParams := jsonschema.Definition{Type: jsonschema.Object, Properties: map[string]jsonschema.Definition{}}
+	RegisterChatTool(chatToolFunc{def: openai.FunctionDefinition{
+		Name:        "get_sign_in",
+		Description: "查询提问用户在本直播间的累计签到天数，以及今天是否已经签到",
+		Parameters:  noParams,
+	}, call: toolSignIn})
+	RegisterChatTool(chatToolFunc{def: openai.FunctionDefinition{
+		Name:        "get_danmu_count",
+		Description: "查询提问用户最近三天每天在本直播间发送的弹幕数量",
+		Parameters:  noParams,
+	}, call: toolDanmuCount})
+	RegisterChatTool(chatToolFunc{def: openai.FunctionDefinition{
+		Name:        "get_blind_box_stat",
+		Description: "查询提问用户在本直播间开盲盒的数量和盈亏(元)，主播提问时为整个直播间的数据",
+		Parameters: jsonschema.Definition{
+			Type: jsonschema.Object,
+			Properties: map[string]jsonschema.Definition{
+				"period": {Type: jsonschema.String, Enum: []string{"today", "month", "year", "all"}, Description: "统计范围：今天、本月、今年、全部"},
+			},
+			Required: []string{"period"},
+		},
+	}, call: toolBlindBoxStat})
+	RegisterChatTool(chatToolFunc{def: openai.FunctionDefinition{
+		Name:        "get_pk_opponent",
+		Description: "查询本直播间当前 PK 的对手主播，不在 PK 中时 in_pk 为 false",
+		Parameters:  noParams,
+	}, call: toolPKOpponent})
+	RegisterChatTool(chatToolFunc{def: openai.FunctionDefinition{
+		Name:        "get_room_info",
+		Description: "查询本直播间的主播、粉丝数、粉丝牌和是否正在直播",
+		Parameters:  noParams,
+	}, call: toolRoomInfo})
+}
+
+// RegisterChatTool 注册工具，同名的工具被替换
+func RegisterChatTool(t ChatTool) {
+	chatToolsMu.Lock()
+	defer chatToolsMu.Unlock()
+	chatTools[t.Definition().Name] = t
+}
+
+// chatToolList 已注册的工具，按名称排序
+func chatToolList() []openai.Tool {
+	chatToolsMu.RLock()
+	defer chatToolsMu.RUnlock()
+	tools := make([]openai.Tool, 0, len(chatTools))
+	for _, t := range chatTools {
+		def := t.Definition()
+		tools = append(tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &def})
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i].Function.Name < tools[j].Function.Name })
+	return tools
+}
+
+// callChatTool 执行模型请求的工具，返回交给模型的 json，出错时返回错误信息让模型自己说明
+func callChatTool(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, call openai.ToolCall) string {
+	chatToolsMu.RLock()
+	t, ok := chatTools[call.Function.Name]
+	chatToolsMu.RUnlock()
+	var result any
+	var err error
+	if ok {
+		result, err = t.Call(ctx, svcCtx, req, call.Function.Arguments)
+	} else {
+		err = fmt.Errorf("没有这个工具：%s", call.Function.Name)
+	}
+	if err != nil {
+		logx.Errorf("机器人调用工具 %s(%s) 失败：%v", call.Function.Name, call.Function.Arguments, err)
+		result = map[string]string{"error": err.Error()}
+	} else {
+		logx.Infof("机器人调用工具 %s(%s)", call.Function.Name, call.Function.Arguments)
+	}
+	data, _ := json.Marshal(result)
+	return string(data)
+}
+
+func toolSignIn(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, _ string) (any, error) {
+	if req.Uid == 0 {
+		return nil, errUnknownAsker
+	}
+	info, err := svcCtx.SignInModel.FindOne(ctx, req.Uid)
+	if errors.Is(err, model.ErrNotFound) {
+		return map[string]any{"days": 0, "signed_today": false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	last := time.Unix(info.LastDay, 0)
+	return map[string]any{
+		"days":         info.Count,
+		"signed_today": last.Format(time.DateOnly) == time.Now().Format(time.DateOnly),
+		"last_sign_in": last.Format(time.DateOnly),
+	}, nil
+}
+
+func toolDanmuCount(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, _ string) (any, error) {
+	if req.Uid == 0 {
+		return nil, errUnknownAsker
+	}
+	days := make(map[string]int64, 3)
+	for d := 0; d < 3; d++ {
+		date := svcCtx.DanmuCntModel.GetDateStr(d)
+		cnt, err := svcCtx.DanmuCntModel.FindOne(ctx, req.Uid, date)
+		switch {
+		case errors.Is(err, model.ErrNotFound):
+			days[date] = 0
+		case err != nil:
+			return nil, err
+		default:
+			days[date] = cnt.Count
+		}
+	}
+	return days, nil
+}
+
+func toolBlindBoxStat(ctx context.Context, svcCtx *svc.ServiceContext, req *ChatRequest, args string) (any, error) {
+	if req.Uid == 0 {
+		return nil, errUnknownAsker
+	}
+	var params struct {
+		Period string `json:"period"`
+	}
+	if args != "" {
+		if err := json.Unmarshal([]byte(args), &params); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	var year, month, day int16
+	switch params.Period {
+	case "today":
+		year, month, day = int16(now.Year()), int16(now.Month()), int16(now.Day())
+	case "month":
+		year, month = int16(now.Year()), int16(now.Month())
+	case "year":
+		year = int16(now.Year())
+	case "all", "":
+	default:
+		return nil, fmt.Errorf("不支持的统计范围：%s", params.Period)
+	}
+	var ret *model.Result
+	var err error
+	anchor := svcCtx.UserID != 0 && svcCtx.UserID == req.Uid
+	if anchor {
+		// 与盲盒统计指令相同，主播查询的是整个直播间
+		ret, err = svcCtx.BlindBoxStatModel.GetTotal(ctx, year, month, day)
+	} else {
+		ret, err = svcCtx.BlindBoxStatModel.GetTotalOnePersion(ctx, req.Uid, year, month, day)
+	}
+	if errors.Is(err, model.ErrNotFound) {
+		ret, err = &model.Result{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"whole_room":  anchor,
+		"count":       ret.C,
+		"profit_yuan": float64(ret.R) / 1000.0,
+	}, nil
+}
+
+func toolPKOpponent(ctx context.Context, svcCtx *svc.ServiceContext, _ *ChatRequest, _ string) (any, error) {
+	o, ok := svcCtx.PK.Opponent()
+	if !ok {
+		return map[string]any{"in_pk": false}, nil
+	}
+	if o.Uname == "" {
+		// 没有开启 PK 提醒时只记录了对手的直播间
+		info, err := BiliOf(svcCtx).Userinfo(o.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		o.Uid, o.Uname, o.FollowerNum = info.Data.Info.Uid, info.Data.Info.Uname, info.Data.FollowerNum
+		svcCtx.PK.Update(o)
+	}
+	resp := map[string]any{
+		"in_pk":     true,
+		"room_id":   o.RoomID,
+		"anchor":    o.Uname,
+		"followers": o.FollowerNum,
+		"minutes":   int(time.Since(o.Since).Minutes()),
+	}
+	if o.GuardNum > 0 || o.RankNum > 0 {
+		resp["guards"] = o.GuardNum
+		resp["guards_online"] = o.GuardOnline
+		resp["online_rank_num"] = o.RankNum
+		resp["online_rank_score"] = o.RankScore
+	}
+	return resp, nil
+}
+
+func toolRoomInfo(ctx context.Context, svcCtx *svc.ServiceContext, _ *ChatRequest, _ string) (any, error) {
+	roomID := svcCtx.Config().RoomId
+	room, err := BiliOf(svcCtx).RoomInit(roomID)
+	if err != nil {
+		return nil, err
+	}
+	info, err := BiliOf(svcCtx).Userinfo(roomID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"room_id":    roomID,
+		"anchor":     info.Data.Info.Uname,
+		"anchor_uid": room.Data.Uid,
+		"live":       room.Data.LiveStatus == 1,
+		"followers":  info.Data.FollowerNum,
+		"medal_name": info.Data.MedalName,
+	}, nil
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http/bilitest"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+// newToolRoom 带有签到、弹幕、盲盒数据的直播间，主播 uid 为 42
+func newToolRoom(t *testing.T) *svc.ServiceContext {
+	srv, bili := newTestBili(t)
+	srv.AddRoom(bilitest.Room{RoomID: 100, Uid: 42, Uname: "主播", LiveStatus: 1, FollowerNum: 7})
+	srv.AddRoom(bilitest.Room{RoomID: 200, Uid: 43, Uname: "对手", FollowerNum: 9})
+
+	db := newTestDB(t)
+	ctx := context.Background()
+	svcCtx := &svc.ServiceContext{
+		Bili:              bili,
+		SignInModel:       model.NewSignInModel(db, 100),
+		DanmuCntModel:     model.NewDanmuCntModel(db, 100),
+		BlindBoxStatModel: model.NewBlindBoxStatModel(db, 100),
+		PK:                &svc.PKState{},
+		UserID:            42,
+	}
+	svcCtx.SetConfig(&config.Config{RoomId: 100, RobotTimeout: 5, RobotTools: true})
+	if err := svcCtx.SignInModel.Insert(ctx, nil, &model.SingInBase{Uid: 10, LastDay: time.Now().Unix(), Count: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := svcCtx.DanmuCntModel.Insert(ctx, nil, &model.DanmuCntBase{Uid: 10, Date: svcCtx.DanmuCntModel.GetDateStr(0), Count: 12}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, b := range []*model.BlindBoxStatBase{
+		{Uid: 10, Price: 3000, OriginalGiftPrice: 1000, Cnt: 1},
+		{Uid: 20, Price: 500, OriginalGiftPrice: 1000, Cnt: 2},
+	} {
+		b.Year, b.Month, b.Day = int16(now.Year()), int16(now.Month()), int16(now.Day())
+		if err := svcCtx.BlindBoxStatModel.Insert(ctx, nil, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return svcCtx
+}
+
+func tool(t *testing.T, svcCtx *svc.ServiceContext, uid int64, name, args string) map[string]any {
+	t.Helper()
+	out := callChatTool(context.Background(), svcCtx, &ChatRequest{Uid: uid}, openai.ToolCall{Function: openai.FunctionCall{Name: name, Arguments: args}})
+	var m map[string]any
+	if err := json.Unmarshal([]byte(out), &m); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	return m
+}
+
+func TestChatTools(t *testing.T) {
+	svcCtx := newToolRoom(t)
+
+	if m := tool(t, svcCtx, 10, "get_sign_in", "{}"); m["days"] != 5.0 || m["signed_today"] != true {
+		t.Fatalf("sign in = %v", m)
+	}
+	if m := tool(t, svcCtx, 30, "get_sign_in", "{}"); m["days"] != 0.0 {
+		t.Fatalf("sign in without record = %v", m)
+	}
+	if m := tool(t, svcCtx, 0, "get_sign_in", "{}"); m["error"] == nil {
+		t.Fatalf("anonymous sign in = %v", m)
+	}
+	if m := tool(t, svcCtx, 10, "get_danmu_count", "{}"); m[svcCtx.DanmuCntModel.GetDateStr(0)] != 12.0 || m[svcCtx.DanmuCntModel.GetDateStr(1)] != 0.0 {
+		t.Fatalf("danmu count = %v", m)
+	}
+
+	// 普通用户只能查询自己的盲盒，主播查询整个直播间
+	if m := tool(t, svcCtx, 10, "get_blind_box_stat", `{"period":"today"}`); m["count"] != 1.0 || m["profit_yuan"] != 2.0 || m["whole_room"] != false {
+		t.Fatalf("blind box = %v", m)
+	}
+	if m := tool(t, svcCtx, 42, "get_blind_box_stat", `{"period":"all"}`); m["count"] != 3.0 || m["profit_yuan"] != 1.0 || m["whole_room"] != true {
+		t.Fatalf("anchor blind box = %v", m)
+	}
+	if m := tool(t, svcCtx, 10, "get_blind_box_stat", `{"period":"week"}`); m["error"] == nil {
+		t.Fatalf("bad period = %v", m)
+	}
+
+	if m := tool(t, svcCtx, 10, "get_pk_opponent", "{}"); m["in_pk"] != false {
+		t.Fatalf("pk = %v", m)
+	}
+	svcCtx.PK.Start(200)
+	if m := tool(t, svcCtx, 10, "get_pk_opponent", "{}"); m["in_pk"] != true || m["anchor"] != "对手" || m["followers"] != 9.0 {
+		t.Fatalf("pk = %v", m)
+	}
+	svcCtx.PK.End()
+	if _, ok := svcCtx.PK.Opponent(); ok {
+		t.Fatal("pk not ended")
+	}
+
+	if m := tool(t, svcCtx, 10, "get_room_info", "{}"); m["anchor"] != "主播" || m["live"] != true || m["anchor_uid"] != 42.0 {
+		t.Fatalf("room info = %v", m)
+	}
+	if m := tool(t, svcCtx, 10, "drop_table", "{}"); m["error"] == nil {
+		t.Fatalf("unknown tool = %v", m)
+	}
+}
+
+// fakeToolOpenAI 第一次请求时要求调用工具，收到工具结果后回复 "查到了：" 加上工具结果
+type fakeToolOpenAI struct {
+	*httptest.Server
+	mu    sync.Mutex
+	tools [][]openai.Tool
+}
+
+func newFakeToolOpenAI(t *testing.T, tool, args string) *fakeToolOpenAI {
+	f := &fakeToolOpenAI{}
+	f.Server = httptest.NewServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req openai.ChatCompletionRequest
+		_ = json.Unmarshal(body, &req)
+		f.mu.Lock()
+		f.tools = append(f.tools, req.Tools)
+		f.mu.Unlock()
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != openai.ChatMessageRoleTool {
+			call := fmt.Sprintf(`{"id":"call_1","type":"function","function":{"name":%q,"arguments":%q}}`, tool, args)
+			if !req.Stream {
+				fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[%s]},"finish_reason":"tool_calls"}]}`, call)
+				return
+			}
+			w.Header().Set("Content-Type", "text/event-stream")
+			// 参数分两段返回
+			half := len(args) / 2
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_1\",\"type\":\"function\",\"function\":{\"name\":%q,\"arguments\":%q}}]}}]}\n\n", tool, args[:half])
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":%q}}]}}]}\n\n", args[half:])
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		reply := "查到了：" + last.Content
+		if !req.Stream {
+			fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, reply)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", reply)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func TestDeepSeekCallsTools(t *testing.T) {
+	svcCtx := newToolRoom(t)
+	srv := newFakeToolOpenAI(t, "get_blind_box_stat", `{"period":"today"}`)
+	c := *svcCtx.Config()
+	c.DeepSeek.APIUrl = srv.URL
+	c.DeepSeek.APIToken = "test"
+	svcCtx.SetConfig(&c)
+	p := deepSeekProvider{}
+
+	reply, err := p.Chat(context.Background(), svcCtx, &ChatRequest{Uid: 10, Uname: "小明", Msg: "今天盲盒亏多少"})
+	if err != nil || !strings.Contains(reply, `"profit_yuan":2`) || !strings.Contains(reply, `"count":1`) {
+		t.Fatalf("Chat = %q, %v", reply, err)
+	}
+	var deltas []string
+	reply, err = p.ChatStream(context.Background(), svcCtx, &ChatRequest{Uid: 20, Msg: "今天盲盒亏多少"}, func(d string) { deltas = append(deltas, d) })
+	if err != nil || !strings.Contains(reply, `"profit_yuan":-1`) || strings.Join(deltas, "") != reply {
+		t.Fatalf("ChatStream = %q %q, %v", reply, deltas, err)
+	}
+	if len(srv.tools) != 4 || len(srv.tools[0]) != 5 {
+		t.Fatalf("tools = %v", srv.tools)
+	}
+
+	// 关闭后不提供工具
+	c.RobotTools = false
+	svcCtx.SetConfig(&c)
+	srv.tools = nil
+	if reply, err = p.Chat(context.Background(), svcCtx, &ChatRequest{Uid: 10, Msg: "你好"}); err != nil || reply != "" {
+		t.Fatalf("Chat without tools = %q, %v", reply, err)
+	}
+	if len(srv.tools) != 1 || srv.tools[0] != nil {
+		t.Fatalf("tools sent when disabled: %v", srv.tools)
+	}
+}
@@ -1,9 +1,12 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/go-resty/resty/v2"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/credential"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/zeromicro/go-zero/core/logx"
 	"os"
@@ -14,7 +17,7 @@ import (
 func GetLoginUrl() (*entity.LoginUrl, error) {
 	var err error
 	var resp *resty.Response
-	var url = "https://passport.bilibili.com/x/passport-login/web/qrcode/generate"
+	var url = DefaultBili().url(passportHost, "/x/passport-login/web/qrcode/generate")
 
 	r := &entity.LoginUrl{}
 	if resp, err = cli.R().
@@ -33,71 +36,21 @@ func GetLoginUrl() (*entity.LoginUrl, error) {
 	return r, err
 }
 
-// 验证登录的同时，将cookie赋值
+// 扫码登录的二维码有效期
+const qrLoginTimeout = 3 * time.Minute
+
+// GetLoginInfo 等待扫码登录，登录成功时将 cookie 赋值并保存
+// 二维码失效或超时后返回错误，需要自行控制取消时使用 QRLoginSession
 func GetLoginInfo(oauthKey string) (*entity.LoginInfoData, error) {
-	var err error
-	var url = "https://passport.bilibili.com/x/passport-login/web/qrcode/poll?qrcode_key=" + oauthKey
-	var resp *resty.Response
-	var data *entity.LoginInfoData
-	var file *os.File
-	pre := &entity.LoginInfoPre{}
+	ctx, cancel := context.WithTimeout(context.Background(), qrLoginTimeout)
+	defer cancel()
+	s := &QRLoginSession{Key: oauthKey}
 	logx.Info("等待扫码登录...")
-	for {
-
-		if resp, err = cli.R().
-			SetHeader("user-agent", userAgent).
-			Get(url); err != nil {
-			logx.Error("请求getLoginInfo失败：", err)
-			return nil, err
-		}
-		if err = json.Unmarshal(resp.Body(), pre); err != nil {
-			logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
-			return nil, err
-		}
-
-		if pre.Code == 0 {
-			data = &entity.LoginInfoData{}
-			if err = json.Unmarshal(resp.Body(), data); err != nil {
-				logx.Error("Unmarshal失败：", err, "body:", string(resp.Body()))
-				return nil, err
-			}
-			if data.Data.Code == 0 {
-				logx.Info("登录成功！")
-				break
-			} else if data.Data.Code == 86038 {
-				logx.Error(data.Data.Message)
-				return nil, errors.New(data.Data.Message)
-			}
-		} else {
-			return nil, errors.New(pre.Message)
-		}
-
-		time.Sleep(5 * time.Second)
-	}
-	for _, v := range resp.Header().Values("Set-Cookie") {
-		pair := strings.Split(v, ";")
-		kv := strings.Split(pair[0], "=")
-		if _, ok := CookieList[kv[0]]; !ok {
-			CookieList[kv[0]] = kv[1]
-			CookieStr += pair[0] + ";"
-		}
-	}
-	//使用追加模式打开文件
-	file, err = os.OpenFile("token/bili_token.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		logx.Errorf("打开文件错误：", err)
-	}
-	file.WriteString(CookieStr)
-	file.Close()
-	//使用追加模式打开文件
-	file, err = os.OpenFile("token/bili_token.json", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
-		logx.Errorf("打开文件错误：", err)
+	if err := s.Poll(ctx, 5*time.Second, nil); err != nil {
+		logx.Error(err)
+		return nil, err
 	}
-	tokenstr, _ := json.Marshal(CookieList)
-	file.WriteString(string(tokenstr))
-	file.Close()
-	return data, err
+	return s.info, nil
 }
 func FileExists(path string) bool {
 	_, err := os.Stat(path) //os.Stat获取文件信息
@@ -109,25 +62,101 @@ func FileExists(path string) bool {
 	}
 	return true
 }
+
+// SetHistoryCookie 从凭据库加载保存的登录信息，没有保存过时返回 credential.ErrNotFound
+// 旧版本明文保存的 cookie 文件会先迁移到凭据库，迁移成功后删除
 func SetHistoryCookie() error {
-	var cookie []byte
-	var err error
-	cookie, err = os.ReadFile("token/bili_token.txt")
+	if err := migrateLegacyCookie(); err != nil {
+		logx.Errorf("迁移明文cookie失败：%v", err)
+	}
+	cookie, err := credential.Get(credential.KeyBiliCookie)
 	if err != nil {
-		logx.Errorf("打开文件错误：", err)
 		return err
 	}
-	CookieStr = string(cookie)
-	cookie, err = os.ReadFile("token/bili_token.json")
+	list, err := credential.Get(credential.KeyBiliCookieList)
 	if err != nil {
-		logx.Errorf("打开文件错误：", err)
 		return err
 	}
-	err = json.Unmarshal(cookie, &CookieList)
-	if err != nil {
+	m := make(map[string]string)
+	if err = json.Unmarshal([]byte(list), &m); err != nil {
+		return err
+	}
+	SetCookies(cookie, m)
+	// 重新从凭据库读取 refresh_token
+	refreshToken = ""
+	return nil
+}
+
+// HasHistoryCookie 是否保存过登录信息
+func HasHistoryCookie() bool {
+	if FileExists(cookieFile) && FileExists(cookieListFile) {
+		return true
+	}
+	_, err := credential.Get(credential.KeyBiliCookie)
+	return err == nil
+}
 
+// migrateLegacyCookie 将明文保存的 cookie 和 refresh_token 写入凭据库并删除明文文件
+func migrateLegacyCookie() error {
+	if !FileExists(cookieFile) || !FileExists(cookieListFile) {
+		return nil
+	}
+	cookie, err := os.ReadFile(cookieFile)
+	if err != nil {
 		return err
 	}
-	//CookieStr = string(cookie)
-	return err
+	list, err := os.ReadFile(cookieListFile)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(list) {
+		return errors.New(cookieListFile + " 格式错误")
+	}
+	entries := map[string]string{
+		credential.KeyBiliCookie:     string(cookie),
+		credential.KeyBiliCookieList: string(list),
+	}
+	if token, err := os.ReadFile(refreshTokenFile); err == nil {
+		entries[credential.KeyBiliRefreshToken] = strings.TrimSpace(string(token))
+	}
+	for k, v := range entries {
+		if err = credential.Set(k, v); err != nil {
+			return err
+		}
+	}
+	for _, f := range []string{cookieFile, cookieListFile, refreshTokenFile} {
+		if err = os.Remove(f); err != nil && !os.IsNotExist(err) {
+			logx.Errorf("删除明文cookie文件失败：%v", err)
+		}
+	}
+	logx.Info("已将明文保存的登录信息迁移到凭据库")
+	return nil
+}
+
+// MigrateAPITokens 将配置文件中明文的 AI 接口令牌写入凭据库，凭据库中已有令牌时以凭据库为准
+// 配置文件中仍有明文令牌时提示删除
+func MigrateAPITokens(c *config.Config) {
+	for _, t := range []struct{ name, token, key string }{
+		{"ChatGPT", c.ChatGPT.APIToken, credential.KeyChatGPTAPIToken},
+		{"DeepSeek", c.DeepSeek.APIToken, credential.KeyDeepSeekAPIToken},
+	} {
+		if t.token == "" {
+			continue
+		}
+		stored, err := credential.Get(t.key)
+		switch {
+		case errors.Is(err, credential.ErrNotFound):
+			if err = credential.Set(t.key, t.token); err != nil {
+				logx.Errorf("迁移 %s.APIToken 到凭据库失败：%v", t.name, err)
+				continue
+			}
+			logx.Infof("已将配置文件中的 %s.APIToken 迁移到凭据库", t.name)
+		case err != nil:
+			logx.Errorf("读取凭据库失败：%v", err)
+			continue
+		case stored != t.token:
+			logx.Errorf("配置文件中的 %s.APIToken 与凭据库中的不同，使用凭据库中的令牌", t.name)
+		}
+		logx.Errorf("配置文件中仍有明文的 %s.APIToken，已保存到凭据库，请从配置文件中删除", t.name)
+	}
 }
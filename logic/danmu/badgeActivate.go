@@ -17,7 +17,7 @@ func BadgeActiveCheckProcess(msg, uid, username string, svcCtx *svc.ServiceConte
 	id, err := strconv.ParseInt(uid, 10, 64)
 	if err != nil {
 		logx.Error(err)
-		logic.PushToBulletSender(info, reply...)
+		logic.PushToBulletSender(svcCtx, info, reply...)
 	}
 
 	todayDanmuCnt, err := svcCtx.DanmuCntModel.FindOne(context.Background(), id, todayDate)
@@ -25,14 +25,14 @@ func BadgeActiveCheckProcess(msg, uid, username string, svcCtx *svc.ServiceConte
 	case nil:
 		err := svcCtx.DanmuCntModel.UpdateCount(context.Background(), id)
 		if err != nil {
-			logic.PushToBulletSender(info, reply...)
+			logic.PushToBulletSender(svcCtx, info, reply...)
 			logx.Error(err)
 			return
 		}
 		todayDanmuCnt.Count = todayDanmuCnt.Count + 1
 
 		if todayDanmuCnt.Count == 10 {
-			logic.PushToBulletSender(fmt.Sprintf("好耶！今天发了%v条弹幕了耶！", todayDanmuCnt.Count), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("好耶！今天发了%v条弹幕了耶！", todayDanmuCnt.Count), reply...)
 		}
 	case model.ErrNotFound:
 		data := model.DanmuCntBase{
@@ -42,12 +42,12 @@ func BadgeActiveCheckProcess(msg, uid, username string, svcCtx *svc.ServiceConte
 		}
 		err := svcCtx.DanmuCntModel.Insert(context.Background(), nil, &data)
 		if err != nil {
-			logic.PushToBulletSender(info, reply...)
+			logic.PushToBulletSender(svcCtx, info, reply...)
 			logx.Error(err)
 			return
 		}
 	default:
-		//logic.PushToBulletSender(info, reply...)
+		//logic.PushToBulletSender(svcCtx, info, reply...)
 		logx.Error(err)
 		return
 	}
@@ -69,7 +69,7 @@ func BadgeActiveCheckProcess(msg, uid, username string, svcCtx *svc.ServiceConte
 		if err2 == nil {
 			beforeYesterdayNum = beforeyesterdayDanmuCnt.Count
 		}
-		logic.PushToBulletSender(fmt.Sprintf("今/昨/前天各发送了：%v，%v，%v条弹幕", todayNum, yesterdayNum, beforeYesterdayNum), reply...)
+		logic.PushToBulletSender(svcCtx, fmt.Sprintf("今/昨/前天各发送了：%v，%v，%v条弹幕", todayNum, yesterdayNum, beforeYesterdayNum), reply...)
 	}
 
 }
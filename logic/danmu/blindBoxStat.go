@@ -42,7 +42,7 @@ func SaveBlindBoxStat(g *entity.SendGiftText, svcCtx *svc.ServiceContext) {
 }
 
 func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) {
-	if !svcCtx.Config.BlindBoxStat {
+	if !svcCtx.Config().BlindBoxStat {
 		return
 	}
 
@@ -62,7 +62,7 @@ func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply
 		var err error
 		month, err = strconv.Atoi(match[1])
 		if err != nil || month < 1 || month > 12 {
-			logic.PushToBulletSender(fmt.Sprintf("月份「%s」不正确!", match[1]), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("月份「%s」不正确!", match[1]), reply...)
 			return
 		}
 	}
@@ -71,7 +71,7 @@ func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply
 	id, err := strconv.ParseInt(uid, 10, 64)
 	if err != nil {
 		logx.Error(err)
-		logic.PushToBulletSender(errInfo, reply...)
+		logic.PushToBulletSender(svcCtx, errInfo, reply...)
 		return
 	}
 
@@ -90,18 +90,18 @@ func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply
 		}
 		if err != nil {
 			logx.Alert("盲盒统计出错了! " + err.Error())
-			logic.PushToBulletSender(errInfo, reply...)
+			logic.PushToBulletSender(svcCtx, errInfo, reply...)
 			return
 		}
 
 		r := float64(ret.R) / 1000.0
 		switch {
 		case ret.R > 0:
-			logic.PushToBulletSender(fmt.Sprintf("今天开%d个盲盒, 赚了%.2f元", ret.C, r), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("今天开%d个盲盒, 赚了%.2f元", ret.C, r), reply...)
 		case ret.R == 0:
-			logic.PushToBulletSender(fmt.Sprintf("今天共开%d个盲盒, 没亏没赚!", ret.C), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("今天共开%d个盲盒, 没亏没赚!", ret.C), reply...)
 		default:
-			logic.PushToBulletSender(fmt.Sprintf("今天共开%d个盲盒, 亏了%.2f元", ret.C, math.Abs(r)), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("今天共开%d个盲盒, 亏了%.2f元", ret.C, math.Abs(r)), reply...)
 		}
 		return
 	}
@@ -118,7 +118,7 @@ func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply
 		}
 		if err != nil {
 			logx.Alert("盲盒统计出错了! " + err.Error())
-			logic.PushToBulletSender(errInfo, reply...)
+			logic.PushToBulletSender(svcCtx, errInfo, reply...)
 			return
 		}
 
@@ -126,11 +126,11 @@ func DoBlindBoxStat(msg, uid, username string, svcCtx *svc.ServiceContext, reply
 		monthLabel := fmt.Sprintf("%d", month)
 		switch {
 		case ret.R > 0:
-			logic.PushToBulletSender(fmt.Sprintf("%s月共开%d个, 赚了%.2f元", monthLabel, ret.C, r), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("%s月共开%d个, 赚了%.2f元", monthLabel, ret.C, r), reply...)
 		case ret.R == 0:
-			logic.PushToBulletSender(fmt.Sprintf("%s月共开%d个, 没亏没赚!", monthLabel, ret.C), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("%s月共开%d个, 没亏没赚!", monthLabel, ret.C), reply...)
 		default:
-			logic.PushToBulletSender(fmt.Sprintf("%s月共开%d个, 亏了%.2f元", monthLabel, ret.C, math.Abs(r)), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("%s月共开%d个, 亏了%.2f元", monthLabel, ret.C, math.Abs(r)), reply...)
 		}
 	}
 }
@@ -1,6 +1,7 @@
 package danmu
 
 import (
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"strconv"
@@ -10,21 +11,14 @@ func DoCMDProcess(msg, uid string, svcCtx *svc.ServiceContext) {
 	if uid == strconv.FormatInt(svcCtx.UserID, 10) {
 		switch msg {
 		case "关闭欢迎弹幕":
-			svcCtx.Config.InteractWord = false
-			svcCtx.Config.EntryEffect = false
-			svcCtx.Config.WelcomeHighWealthy = false
-			svcCtx.Autointerract.InteractWord = false
-			svcCtx.Autointerract.EntryEffect = false
-			svcCtx.Autointerract.WelcomeHighWealthy = false
-			logic.PushToBulletSender("已临时关闭欢迎弹幕")
+			svcCtx.Runtime.SetOverride(false, svc.WelcomeToggles...)
+			logic.PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityAnchor, "已临时关闭欢迎弹幕")
 		case "开启欢迎弹幕":
-			svcCtx.Config.InteractWord = true
-			svcCtx.Config.EntryEffect = true
-			svcCtx.Config.WelcomeHighWealthy = true
-			svcCtx.Autointerract.InteractWord = true
-			svcCtx.Autointerract.EntryEffect = true
-			svcCtx.Autointerract.WelcomeHighWealthy = true
-			logic.PushToBulletSender("已临时开启欢迎弹幕")
+			svcCtx.Runtime.SetOverride(true, svc.WelcomeToggles...)
+			logic.PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityAnchor, "已临时开启欢迎弹幕")
+		case "恢复欢迎弹幕":
+			svcCtx.Runtime.ClearOverrides(svc.WelcomeToggles...)
+			logic.PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityAnchor, "欢迎弹幕已恢复为配置文件的设置")
 		}
 	}
 }
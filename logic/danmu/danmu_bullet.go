@@ -2,115 +2,156 @@ package danmu
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/client"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/blivedm-go/message"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"github.com/zeromicro/go-zero/core/logx"
 )
 
-var danmuHandler *DanmuLogic
-
 type DanmuLogic struct {
-	danmuChan chan string
+	danmuChan chan *message.Danmaku
+	// 解析失败被跳过的弹幕数量
+	malformed atomic.Int64
+	// 处理弹幕的工作池，StartDanmuLogic 运行期间有效
+	pool atomic.Pointer[client.WorkerPool]
+}
+
+var (
+	danmuHandlersMu sync.Mutex
+	danmuHandlers   = make(map[*svc.ServiceContext]*DanmuLogic)
+)
+
+// danmuHandlerOf 获取直播间的弹幕处理器，不存在时创建
+func danmuHandlerOf(svcCtx *svc.ServiceContext) *DanmuLogic {
+	danmuHandlersMu.Lock()
+	defer danmuHandlersMu.Unlock()
+	h, ok := danmuHandlers[svcCtx]
+	if !ok {
+		h = &DanmuLogic{
+			danmuChan: make(chan *message.Danmaku, 1000),
+		}
+		danmuHandlers[svcCtx] = h
+	}
+	return h
 }
 
-func PushToBDanmuLogic(bullet string) {
-	danmuHandler.danmuChan <- bullet
+// RemoveRoom 释放直播间的弹幕处理器
+func RemoveRoom(svcCtx *svc.ServiceContext) {
+	danmuHandlersMu.Lock()
+	delete(danmuHandlers, svcCtx)
+	danmuHandlersMu.Unlock()
 }
 
-func StartDanmuLogic(ctx context.Context, svcCtx *svc.ServiceContext) {
-	var err error
+func PushToBDanmuLogic(svcCtx *svc.ServiceContext, danmaku *message.Danmaku) {
+	danmuHandlerOf(svcCtx).danmuChan <- danmaku
+}
 
-	danmuHandler = &DanmuLogic{
-		danmuChan: make(chan string, 1000),
+// ReportMalformed 记录一条解析失败的弹幕
+func ReportMalformed(svcCtx *svc.ServiceContext, err error) {
+	n := danmuHandlerOf(svcCtx).malformed.Add(1)
+	logx.Errorf("跳过无法解析的弹幕(累计 %d 条)：%v", n, err)
+}
+
+// MalformedCount 返回直播间解析失败被跳过的弹幕数量
+func MalformedCount(svcCtx *svc.ServiceContext) int64 {
+	return danmuHandlerOf(svcCtx).malformed.Load()
+}
+
+// PoolStats 返回直播间弹幕工作池的运行状态，未启动时返回零值
+func PoolStats(svcCtx *svc.ServiceContext) client.PoolStats {
+	if p := danmuHandlerOf(svcCtx).pool.Load(); p != nil {
+		return p.Stats()
 	}
+	return client.PoolStats{}
+}
+
+var emoticonReg = regexp.MustCompile("\\[(.*?)\\]")
+
+// StartDanmuLogic 处理弹幕，同一用户的弹幕由同一协程按顺序处理，队列满时等待
+// ctx 取消后丢弃排队的弹幕，等待正在处理的弹幕结束后才返回
+func StartDanmuLogic(ctx context.Context, svcCtx *svc.ServiceContext) {
+	danmuHandler := danmuHandlerOf(svcCtx)
+	c := svcCtx.Config()
+	pool := client.NewWorkerPool(c.EventWorkers, c.EventQueueSize)
+	danmuHandler.pool.Store(pool)
+	defer func() {
+		pool.Close()
+		pool.Wait()
+	}()
 
-	var msg string
 	for {
 		select {
 		case <-ctx.Done():
-			goto END
-		case msg = <-danmuHandler.danmuChan:
-			danmu := &entity.DanmuMsgText{}
-			err = json.Unmarshal([]byte(msg), danmu)
-			if err != nil {
-				logx.Error(err)
+			return
+		case danmaku := <-danmuHandler.danmuChan:
+			if danmaku == nil || danmaku.Sender == nil {
+				ReportMalformed(svcCtx, message.ErrMalformedDanmaku)
+				continue
 			}
+			pool.Submit(uint64(danmaku.Sender.Uid), false, func() {
+				handleDanmaku(danmaku, svcCtx)
+			})
+		}
+	}
+}
 
-			danmumsg := danmu.Info[1].(string)
-			from := danmu.Info[2].([]interface{})
-			uid := fmt.Sprintf("%.0f", from[0].(float64))
-			re := regexp.MustCompile("\\[(.*?)\\]")
-			danmumsg = re.ReplaceAllString(danmumsg, "")
-
-			// 解析Info[0]
-			extras := danmu.Info[0].([]interface{})
-			extra := extras[15].(map[string]interface{})
-			jsonExtra := strings.ReplaceAll(extra["extra"].(string), `\"`, `"`)
-			tagExtra := &entity.DanmuMsgTextInfo0Extra{}
-			e := json.Unmarshal([]byte(jsonExtra), tagExtra)
-			if e != nil {
-				logx.Alert(e.Error())
-				// } else {
-				// 	logx.Info("idStr: ", tagExtra.IdStr, " ", uid)
-			}
+func handleDanmaku(danmaku *message.Danmaku, svcCtx *svc.ServiceContext) {
+	c := svcCtx.Config()
+	uid := strconv.Itoa(danmaku.Sender.Uid)
+	uname := danmaku.Sender.Uname
+	danmumsg := emoticonReg.ReplaceAllString(danmaku.Content, "")
 
-			reply := &entity.DanmuMsgTextReplyInfo{
-				ReplyUid:   uid,
-				ReplyMsgId: tagExtra.IdStr,
-			}
+	reply := &entity.DanmuMsgTextReplyInfo{
+		ReplyUid:   uid,
+		ReplyMsgId: danmaku.ID,
+	}
 
-			cardLv := "0"
-			card := "无信仰"
-			if len(danmu.Info) > 3 {
-				cardInfo := danmu.Info[3].([]interface{})
-				if len(cardInfo) > 1 {
-					cardLv = fmt.Sprintf("%.0f", cardInfo[0].(float64))
-					card = cardInfo[1].(string)
-				}
-			}
-			if len(danmumsg) > 0 {
-				// 机器人相关
-				go DoDanmuProcess(danmumsg, svcCtx, reply)
-				// 弹幕统计
-				if svcCtx.Config.DanmuCntEnable {
-					go BadgeActiveCheckProcess(danmumsg, uid, from[1].(string), svcCtx, reply)
-				}
-				// 关键词回复
-				if svcCtx.Config.KeywordReply {
-					go KeywordReply(danmumsg, svcCtx, reply)
-				}
-				// 点歌功能
-				// go ProcessMusicRequest(danmumsg, svcCtx, reply)
-			}
-			// 签到
-			if svcCtx.Config.SignInEnable {
-				go DosignInProcess(danmumsg, uid, from[1].(string), svcCtx, reply)
-			}
-			// 抽签
-			if svcCtx.Config.DrawByLot {
-				go DodrawByLotProcess(danmumsg, from[1].(string), svcCtx, reply)
-			}
-			// 盲盒统计
-			if svcCtx.Config.BlindBoxStat {
-				go DoBlindBoxStat(danmumsg, uid, from[1].(string), svcCtx, reply)
-			}
-			if len(danmumsg) > 0 && uid == strconv.FormatInt(svcCtx.UserID, 10) {
-				// 主播指令控制
-				go DoCMDProcess(danmumsg, uid, svcCtx)
-			}
-			// 实时输出弹幕消息
-			if tagExtra.ReplyMid > 0 {
-				danmumsg = fmt.Sprintf("@%s %s", tagExtra.ReplyUname, danmumsg)
-			}
-			logx.Infof("%v 「%s %s」%s:%s", uid, cardLv, card, from[1], danmumsg)
+	cardLv := "0"
+	card := "无信仰"
+	if medal := danmaku.Sender.Medal; medal != nil && medal.Name != "" {
+		cardLv = strconv.Itoa(medal.Level)
+		card = medal.Name
+	}
+	if len(danmumsg) > 0 {
+		// 机器人相关
+		DoDanmuProcess(danmumsg, uid, uname, svcCtx, reply)
+		// 弹幕统计
+		if c.DanmuCntEnable {
+			BadgeActiveCheckProcess(danmumsg, uid, uname, svcCtx, reply)
 		}
-
+		// 关键词回复
+		if c.KeywordReply {
+			KeywordReply(danmumsg, svcCtx, reply)
+		}
+		// 点歌功能
+		// go ProcessMusicRequest(danmumsg, svcCtx, reply)
+	}
+	// 签到
+	if c.SignInEnable {
+		DosignInProcess(danmumsg, uid, uname, svcCtx, reply)
+	}
+	// 抽签
+	if c.DrawByLot {
+		DodrawByLotProcess(danmumsg, uname, svcCtx, reply)
+	}
+	// 盲盒统计
+	if c.BlindBoxStat {
+		DoBlindBoxStat(danmumsg, uid, uname, svcCtx, reply)
+	}
+	if len(danmumsg) > 0 && uid == strconv.FormatInt(svcCtx.UserID, 10) {
+		// 主播指令控制
+		DoCMDProcess(danmumsg, uid, svcCtx)
+	}
+	// 实时输出弹幕消息
+	if danmaku.Reply != nil {
+		danmumsg = fmt.Sprintf("@%s %s", danmaku.Reply.Uname, danmumsg)
 	}
-END:
+	logx.Infof("%v 「%s %s」%s:%s", uid, cardLv, card, uname, danmumsg)
 }
@@ -8,11 +8,12 @@ import (
 )
 
 func KeywordReply(danmu string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) {
-	if svcCtx.Config.KeywordReplyList != nil &&
-		len(svcCtx.Config.KeywordReplyList) > 0 {
-		for k, v := range svcCtx.Config.KeywordReplyList {
+	c := svcCtx.Config()
+	if c.KeywordReplyList != nil &&
+		len(c.KeywordReplyList) > 0 {
+		for k, v := range c.KeywordReplyList {
 			if strings.Contains(danmu, k) {
-				logic.PushToBulletSender(v, reply...)
+				logic.PushToBulletSender(svcCtx, v, reply...)
 				break
 			}
 		}
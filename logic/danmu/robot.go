@@ -5,6 +5,7 @@ import (
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/logic"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"strconv"
 	"strings"
 )
 
@@ -14,32 +15,33 @@ const (
 	hasPrefix
 )
 
-func DoDanmuProcess(msg string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) {
+func DoDanmuProcess(msg, uid, uname string, svcCtx *svc.ServiceContext, reply ...*entity.DanmuMsgTextReplyInfo) {
+	c := svcCtx.Config()
 	// @帮助 打出来关键词
 	if strings.Compare("@帮助", msg) == 0 {
 		s := ""
-		if len(svcCtx.Config.TalkRobotCmd) > 0 {
-			s = fmt.Sprintf("发送带有 %s 的弹幕和我互动", svcCtx.Config.TalkRobotCmd)
-			logic.PushToBulletSender(s)
-			logic.PushToBulletSender("请尽情调戏我吧!")
+		if len(c.TalkRobotCmd) > 0 {
+			s = fmt.Sprintf("发送带有 %s 的弹幕和我互动", c.TalkRobotCmd)
+			logic.PushToBulletSender(svcCtx, s)
+			logic.PushToBulletSender(svcCtx, "请尽情调戏我吧!")
 		} else {
 			s = "互动聊天已禁用..."
-			logic.PushToBulletSender(s)
+			logic.PushToBulletSender(svcCtx, s)
 		}
-		//logic.PushToBulletSender(" ")
+		//logic.PushToBulletSender(svcCtx, " ")
 		// logx.Info(s)
-		logic.PushToBulletSender("发送「签到/打卡」即可签到")
-		logic.PushToBulletSender("发送「查询弹幕」查询自己近三天的弹幕数")
-		logic.PushToBulletSender("发送「今日盲盒」查询在本直播间的今日盲盒盈亏")
-		logic.PushToBulletSender("发送「X月盲盒」查询在本直播间的x月盲盒盈亏")
-		logic.PushToBulletSender("发送「抽签」即可抽签")
-		logic.PushToBulletSender("主播发送「关闭欢迎弹幕」即可关闭欢迎弹幕")
-		logic.PushToBulletSender("主播发送「开启欢迎弹幕」即可开启欢迎弹幕")
-		logic.PushToBulletSender("本软件为永久免费软件")
+		logic.PushToBulletSender(svcCtx, "发送「签到/打卡」即可签到")
+		logic.PushToBulletSender(svcCtx, "发送「查询弹幕」查询自己近三天的弹幕数")
+		logic.PushToBulletSender(svcCtx, "发送「今日盲盒」查询在本直播间的今日盲盒盈亏")
+		logic.PushToBulletSender(svcCtx, "发送「X月盲盒」查询在本直播间的x月盲盒盈亏")
+		logic.PushToBulletSender(svcCtx, "发送「抽签」即可抽签")
+		logic.PushToBulletSender(svcCtx, "主播发送「关闭欢迎弹幕」即可关闭欢迎弹幕")
+		logic.PushToBulletSender(svcCtx, "主播发送「开启欢迎弹幕」即可开启欢迎弹幕")
+		logic.PushToBulletSender(svcCtx, "本软件为永久免费软件")
 	}
 	if strings.Compare("@我是谁", msg) == 0 || strings.Compare("@作者", msg) == 0 {
-		logic.PushToBulletSender("开发者: @超凶一只花酱酱@荆楚大胡子")
-		logic.PushToBulletSender("先锋队: @是琪琪星耶")
+		logic.PushToBulletSender(svcCtx, "开发者: @超凶一只花酱酱@荆楚大胡子")
+		logic.PushToBulletSender(svcCtx, "先锋队: @是琪琪星耶")
 	}
 
 	result := checkIsAtMe(&msg, svcCtx)
@@ -48,21 +50,23 @@ func DoDanmuProcess(msg string, svcCtx *svc.ServiceContext, reply ...*entity.Dan
 	}
 	content := ""
 	if result == contained {
-		content = strings.ReplaceAll(msg, svcCtx.Config.TalkRobotCmd, "")
+		content = strings.ReplaceAll(msg, c.TalkRobotCmd, "")
 	} else if result == hasPrefix {
-		content = strings.TrimPrefix(msg, svcCtx.Config.TalkRobotCmd)
+		content = strings.TrimPrefix(msg, c.TalkRobotCmd)
 	}
 	//如果发现弹幕在@我，那么调用机器人进行回复
-	if len(content) > 0 && len(svcCtx.Config.TalkRobotCmd) > 0 && msg != svcCtx.Config.EntryMsg {
-		logic.PushToBulletRobot(content, reply...)
+	if len(content) > 0 && len(c.TalkRobotCmd) > 0 && msg != c.EntryMsg {
+		id, _ := strconv.ParseInt(uid, 10, 64)
+		logic.PushToBulletRobotFrom(svcCtx, id, uname, content, reply...)
 	}
 }
 
 // 检查弹幕是否在@我，返回bool和@我要说的内容
 func checkIsAtMe(msg *string, svcCtx *svc.ServiceContext) int {
-	if strings.Contains(*msg, svcCtx.Config.TalkRobotCmd) && svcCtx.Config.FuzzyMatchCmd {
+	c := svcCtx.Config()
+	if strings.Contains(*msg, c.TalkRobotCmd) && c.FuzzyMatchCmd {
 		return contained
-	} else if strings.HasPrefix(*msg, svcCtx.Config.TalkRobotCmd) {
+	} else if strings.HasPrefix(*msg, c.TalkRobotCmd) {
 		return hasPrefix
 	} else {
 		return none
@@ -22,7 +22,7 @@ func DosignInProcess(msg, uid, username string, svcCtx *svc.ServiceContext, repl
 	id, err := strconv.ParseInt(uid, 10, 64)
 	if err != nil {
 		logx.Error(err)
-		logic.PushToBulletSender(info, reply...)
+		logic.PushToBulletSender(svcCtx, info, reply...)
 	}
 	// 获取当前时间
 	now := carbon.Now(carbon.Local)
@@ -33,13 +33,13 @@ func DosignInProcess(msg, uid, username string, svcCtx *svc.ServiceContext, repl
 		if lastdate.Year() != now.Year() || lastdate.Month() != now.Month() || lastdate.Day() != now.Day() {
 			err := svcCtx.SignInModel.UpdateCount(context.Background(), id)
 			if err != nil {
-				logic.PushToBulletSender(info, reply...)
+				logic.PushToBulletSender(svcCtx, info, reply...)
 				logx.Error(err)
 				return
 			}
-			logic.PushToBulletSender(fmt.Sprintf("已签到%v天", signInfo.Count+1), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("已签到%v天", signInfo.Count+1), reply...)
 		} else {
-			logic.PushToBulletSender(fmt.Sprintf("今天已经签到过了,已签到%v天", signInfo.Count), reply...)
+			logic.PushToBulletSender(svcCtx, fmt.Sprintf("今天已经签到过了,已签到%v天", signInfo.Count), reply...)
 		}
 	case model.ErrNotFound:
 		data := model.SingInBase{
@@ -49,13 +49,13 @@ func DosignInProcess(msg, uid, username string, svcCtx *svc.ServiceContext, repl
 		}
 		err := svcCtx.SignInModel.Insert(context.Background(), nil, &data)
 		if err != nil {
-			logic.PushToBulletSender(info, reply...)
+			logic.PushToBulletSender(svcCtx, info, reply...)
 			logx.Error(err)
 			return
 		}
-		logic.PushToBulletSender("已签到1天", reply...)
+		logic.PushToBulletSender(svcCtx, "已签到1天", reply...)
 	default:
-		logic.PushToBulletSender(info, reply...)
+		logic.PushToBulletSender(svcCtx, info, reply...)
 		logx.Error(err)
 		return
 	}
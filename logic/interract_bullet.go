@@ -12,8 +12,6 @@ import (
 	"github.com/zeromicro/go-zero/core/logx"
 )
 
-var interractGiver *InterractGiver
-
 type InterractGiver struct {
 	interractFilter map[int64]time.Time
 	locked          *sync.Mutex
@@ -22,22 +20,26 @@ type InterractGiver struct {
 }
 type InterractData struct {
 	Uid   int64
+	Uname string // 欢迎语中的用户名，用于合并同一模板的欢迎
 	Msg   string
 	Reply *entity.DanmuMsgTextReplyInfo
 }
 
-func PushToInterractChan(g *InterractData) {
-	interractGiver.interractChan <- g
-}
-
-func Interact(ctx context.Context, svcCtx *svc.ServiceContext) {
-
-	interractGiver = &InterractGiver{
+func newInterractGiver() *InterractGiver {
+	return &InterractGiver{
 		interractFilter: map[int64]time.Time{},
 		locked:          new(sync.Mutex),
 		//tableMu:         sync.RWMutex{},
 		interractChan: make(chan *InterractData, 1000),
 	}
+}
+
+func PushToInterractChan(svcCtx *svc.ServiceContext, g *InterractData) {
+	pipelinesOf(svcCtx).interractGiver.interractChan <- g
+}
+
+func Interact(ctx context.Context, svcCtx *svc.ServiceContext) {
+	interractGiver := pipelinesOf(svcCtx).interractGiver
 
 	var g *InterractData
 	var w = 10 * time.Second
@@ -75,13 +77,15 @@ func Interact(ctx context.Context, svcCtx *svc.ServiceContext) {
 			} else {
 				parts := strings.Split(g.Msg, "\n")
 				for _, s := range parts {
-					if svcCtx.Config.WelcomeUseAt {
+					if svcCtx.Config().WelcomeUseAt {
 						g.Reply = &entity.DanmuMsgTextReplyInfo{
 							ReplyUid: strconv.FormatInt(g.Uid, 10),
 						}
-						PushToBulletSender(s, g.Reply)
+						PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityWelcome, s, g.Reply)
+					} else if len(parts) == 1 && g.Uname != "" && strings.Count(s, g.Uname) == 1 {
+						PushToBulletSenderMergeable(svcCtx, entity.BulletPriorityWelcome, strings.Replace(s, g.Uname, mergePlaceholder, 1), g.Uname)
 					} else {
-						PushToBulletSender(s)
+						PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityWelcome, s)
 					}
 					logx.Debug(s)
 				}
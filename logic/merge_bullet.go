@@ -0,0 +1,111 @@
+package logic
+
+import (
+	"strings"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+const (
+	mergePlaceholder = "{user}"
+	mergeSeparator   = "、"
+)
+
+// 重复弹幕的变化后缀，依次尝试
+var repeatVariations = []string{"~", "！", "～", "♪", "。", "~~", "！！"}
+
+// PushToBulletSenderMergeable 发送可合并的弹幕，template 中的 {user} 替换为 user
+// 合并窗口内相同模板的弹幕会合并为一条，如 "欢迎 A、B、C ~"
+func PushToBulletSenderMergeable(svcCtx *svc.ServiceContext, priority entity.BulletPriority, template, user string) {
+	msg := strings.ReplaceAll(template, mergePlaceholder, user)
+	logx.Info("PushToBulletSender成功", msg)
+	pipelinesOf(svcCtx).sender.push(entity.Bullet{
+		Msg:       msg,
+		Priority:  priority,
+		Time:      time.Now(),
+		MergeKey:  template,
+		MergeArgs: []string{user},
+	})
+}
+
+// renderMerged 用合并后的用户名渲染模板
+func renderMerged(template string, users []string) string {
+	return strings.ReplaceAll(template, mergePlaceholder, strings.Join(users, mergeSeparator))
+}
+
+// mergeQueued 将 q 中与 head 模板相同、且在合并窗口内入队的弹幕合并到 head，返回剩余的队列
+// 合并后超过弹幕长度限制的留在队列中
+func mergeQueued(head entity.Bullet, q []entity.Bullet, window time.Duration, danmuLen int) (entity.Bullet, []entity.Bullet) {
+	if head.MergeKey == "" || window <= 0 {
+		return head, q
+	}
+	users := head.MergeArgs
+	rest := q[:0:0]
+	for _, b := range q {
+		if b.MergeKey == head.MergeKey && b.Time.Sub(head.Time) <= window {
+			merged := append(users[:len(users):len(users)], b.MergeArgs...)
+			if danmuLen <= 0 || len([]rune(renderMerged(head.MergeKey, merged))) <= danmuLen {
+				users = merged
+				continue
+			}
+		}
+		rest = append(rest, b)
+	}
+	if len(users) > len(head.MergeArgs) {
+		logx.Debugf("合并弹幕：%v", users)
+		head.MergeArgs = users
+		head.Msg = renderMerged(head.MergeKey, users)
+	}
+	return head, rest
+}
+
+// repeatFilter 记录最近发送的弹幕，避免短时间内发送完全相同的内容被服务器拒绝
+type repeatFilter struct {
+	sent map[string]time.Time
+}
+
+func newRepeatFilter() *repeatFilter {
+	return &repeatFilter{sent: make(map[string]time.Time)}
+}
+
+// vary 如果 msg 在 window 内发送过，返回加上变化后的内容
+func (f *repeatFilter) vary(msg string, now time.Time, window time.Duration, danmuLen int) string {
+	if window <= 0 {
+		return msg
+	}
+	for k, t := range f.sent {
+		if now.Sub(t) > window {
+			delete(f.sent, k)
+		}
+	}
+	if _, ok := f.sent[msg]; !ok {
+		return msg
+	}
+	runes := []rune(msg)
+	for _, v := range repeatVariations {
+		var candidate string
+		if danmuLen > 0 && len(runes)+len([]rune(v)) > danmuLen {
+			// 长度不够时替换末尾的字符
+			keep := danmuLen - len([]rune(v))
+			if keep <= 0 {
+				continue
+			}
+			candidate = string(runes[:keep]) + v
+		} else {
+			candidate = msg + v
+		}
+		if _, ok := f.sent[candidate]; !ok {
+			logx.Debugf("重复弹幕已变化：%s -> %s", msg, candidate)
+			return candidate
+		}
+	}
+	return msg
+}
+
+// record 记录已发送的弹幕
+func (f *repeatFilter) record(msg string, now time.Time) {
+	f.sent[msg] = now
+}
@@ -0,0 +1,95 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+)
+
+func mergeable(template, user string, t time.Time) entity.Bullet {
+	return entity.Bullet{
+		Msg:       renderMerged(template, []string{user}),
+		Priority:  entity.BulletPriorityWelcome,
+		Time:      t,
+		MergeKey:  template,
+		MergeArgs: []string{user},
+	}
+}
+
+func TestBulletSenderMerge(t *testing.T) {
+	s := newBulletSender()
+	now := time.Now()
+	window := 3 * time.Second
+
+	// 第一条没有可合并的弹幕，立即发送
+	s.push(mergeable("欢迎 {user} ~", "A", now))
+	b, ok, _ := s.pop(now, window, 20)
+	if !ok || b.Msg != "欢迎 A ~" {
+		t.Fatalf("want 欢迎 A ~ immediately, got ok=%v %q", ok, b.Msg)
+	}
+	s.done()
+
+	// 窗口内的同模板弹幕等到窗口结束再合并
+	s.push(mergeable("欢迎 {user} ~", "B", now.Add(time.Second)))
+	s.push(entity.Bullet{Msg: "other", Priority: entity.BulletPriorityWelcome, Time: now.Add(time.Second)})
+	s.push(mergeable("欢迎 {user} ~", "C", now.Add(2*time.Second)))
+	if _, ok, wait := s.pop(now.Add(2*time.Second), window, 20); ok || wait != time.Second {
+		t.Fatalf("want to wait for merge window, got ok=%v wait=%v", ok, wait)
+	}
+	b, ok, _ = s.pop(now.Add(3*time.Second), window, 20)
+	if !ok || b.Msg != "欢迎 B、C ~" {
+		t.Fatalf("unexpected merged bullet: %q", b.Msg)
+	}
+	s.done()
+	b, _, _ = s.pop(now.Add(3*time.Second), window, 20)
+	if b.Msg != "other" {
+		t.Fatalf("want other, got %q", b.Msg)
+	}
+	s.done()
+
+	// 距上次发送超过窗口后又是第一条
+	s.push(mergeable("欢迎 {user} ~", "D", now.Add(7*time.Second)))
+	b, ok, _ = s.pop(now.Add(7*time.Second), window, 20)
+	if !ok || b.Msg != "欢迎 D ~" {
+		t.Fatalf("want 欢迎 D ~, got ok=%v %q", ok, b.Msg)
+	}
+}
+
+func TestBulletSenderMergeDisabled(t *testing.T) {
+	s := newBulletSender()
+	now := time.Now()
+	s.push(mergeable("欢迎 {user} ~", "A", now))
+	s.push(mergeable("欢迎 {user} ~", "B", now))
+	for _, want := range []string{"欢迎 A ~", "欢迎 B ~"} {
+		if b, ok, _ := s.pop(now, 0, 20); !ok || b.Msg != want {
+			t.Fatalf("want %q, got ok=%v %q", want, ok, b.Msg)
+		}
+	}
+}
+
+func TestMergeRespectsDanmuLen(t *testing.T) {
+	now := time.Now()
+	head := mergeable("欢迎 {user} ~", "AAAA", now)
+	q := []entity.Bullet{mergeable("欢迎 {user} ~", "BBBB", now), mergeable("欢迎 {user} ~", "CCCC", now)}
+	head, rest := mergeQueued(head, q, time.Second, 14)
+	if head.Msg != "欢迎 AAAA、BBBB ~" || len(rest) != 1 {
+		t.Fatalf("unexpected merge: %q rest=%d", head.Msg, len(rest))
+	}
+}
+
+func TestRepeatFilterVary(t *testing.T) {
+	f := newRepeatFilter()
+	now := time.Now()
+	f.record("你好", now)
+	if got := f.vary("你好", now.Add(time.Second), 10*time.Second, 20); got != "你好~" {
+		t.Fatalf("want variation, got %q", got)
+	}
+	if got := f.vary("你好", now.Add(11*time.Second), 10*time.Second, 20); got != "你好" {
+		t.Fatalf("want original after window, got %q", got)
+	}
+	f.record("一二三", now)
+	if got := f.vary("一二三", now, 10*time.Second, 3); got != "一二~" {
+		t.Fatalf("want variation within length, got %q", got)
+	}
+}
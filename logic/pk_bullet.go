@@ -11,8 +11,6 @@ import (
 	"time"
 )
 
-var pkGiver *PKGiver
-
 type PKGiver struct {
 	pkFilter map[int]time.Time
 	locked   *sync.Mutex
@@ -20,17 +18,20 @@ type PKGiver struct {
 	pkChan   chan *int
 }
 
-func PushToPKChan(g *int) {
-	pkGiver.pkChan <- g
-}
-func PK(ctx context.Context, svcCtx *svc.ServiceContext) {
-
-	pkGiver = &PKGiver{
+func newPKGiver() *PKGiver {
+	return &PKGiver{
 		pkFilter: map[int]time.Time{},
 		locked:   new(sync.Mutex),
 		tableMu:  sync.RWMutex{},
 		pkChan:   make(chan *int, 1000),
 	}
+}
+
+func PushToPKChan(svcCtx *svc.ServiceContext, g *int) {
+	pipelinesOf(svcCtx).pkGiver.pkChan <- g
+}
+func PK(ctx context.Context, svcCtx *svc.ServiceContext) {
+	pkGiver := pipelinesOf(svcCtx).pkGiver
 
 	var g *int
 	var w = 10 * time.Second
@@ -77,22 +78,22 @@ func handlerPK(roomid int, svcCtx *svc.ServiceContext) {
 	toplistalive := 0
 	rankcount := 0
 
-	userinfo, err := http.Userinfo(roomid)
+	userinfo, err := http.BiliOf(svcCtx).Userinfo(roomid)
 	if err != nil {
 		logx.Error(err)
 		return
 	}
 	toppage := 1
-	listInfo, err := http.TopListInfo(roomid, userinfo.Data.Info.Uid, toppage)
+	listInfo, err := http.BiliOf(svcCtx).TopListInfo(roomid, userinfo.Data.Info.Uid, toppage)
 	if err != nil {
 		logx.Error(err)
-		PushToBulletSender("PK信息获取失败!")
+		PushToBulletSender(svcCtx, "PK信息获取失败!")
 		return
 	}
 
 	tmpPage := listInfo.Data.Info.Page
 	for toppage += 1; toppage <= tmpPage; toppage++ {
-		toplist, err = http.TopListInfo(roomid, userinfo.Data.Info.Uid, toppage)
+		toplist, err = http.BiliOf(svcCtx).TopListInfo(roomid, userinfo.Data.Info.Uid, toppage)
 		if err != nil {
 			logx.Error(err)
 			continue
@@ -114,9 +115,9 @@ func handlerPK(roomid int, svcCtx *svc.ServiceContext) {
 		// svcCtx.TopUid[data.Uid] = true
 		svcCtx.OtherSideUid[data.Uid] = true
 	}
-	rankListInfo, err := http.RankListInfo(roomid, userinfo.Data.Info.Uid, 1)
+	rankListInfo, err := http.BiliOf(svcCtx).RankListInfo(roomid, userinfo.Data.Info.Uid, 1)
 	if err != nil {
-		PushToBulletSender("PK信息获取失败!")
+		PushToBulletSender(svcCtx, "PK信息获取失败!")
 		logx.Error(err)
 		return
 	}
@@ -140,7 +141,7 @@ func handlerPK(roomid int, svcCtx *svc.ServiceContext) {
 
 		p := 2
 		for ; p <= totalPage; p++ {
-			rankListInfoTmp, err := http.RankListInfo(roomid, userinfo.Data.Info.Uid, 1)
+			rankListInfoTmp, err := http.BiliOf(svcCtx).RankListInfo(roomid, userinfo.Data.Info.Uid, 1)
 			if err != nil {
 				logx.Error(err)
 				continue
@@ -157,9 +158,19 @@ func handlerPK(roomid int, svcCtx *svc.ServiceContext) {
 	}
 
 	// logx.Info("TTTTT ", otherSideUid)
-	//PushToBulletSender(fmt.Sprintf("当前对手:%v，%v船，%v粉,对面有%v名船长在线，高能榜%v人，榜前50贡献%v分", userinfo.Data.Info.Uname, listInfo.Data.Info.Num, userinfo.Data.FollowerNum, toplistalive, rankListInfo.Data.OnlineNum, rankcount))
-	PushToBulletSender(fmt.Sprintf("当前对手:%v", userinfo.Data.Info.Uname))
-	PushToBulletSender(fmt.Sprintf("共%v船，%v粉", listInfo.Data.Info.Num, userinfo.Data.FollowerNum))
-	PushToBulletSender(fmt.Sprintf("当前%v船在线，高能榜%v人", toplistalive, rankListInfo.Data.OnlineNum))
-	PushToBulletSender(fmt.Sprintf("榜前50贡献%v分", rankcount))
+	//PushToBulletSender(svcCtx, fmt.Sprintf("当前对手:%v，%v船，%v粉,对面有%v名船长在线，高能榜%v人，榜前50贡献%v分", userinfo.Data.Info.Uname, listInfo.Data.Info.Num, userinfo.Data.FollowerNum, toplistalive, rankListInfo.Data.OnlineNum, rankcount))
+	svcCtx.PK.Update(svc.PKOpponent{
+		RoomID:      roomid,
+		Uid:         userinfo.Data.Info.Uid,
+		Uname:       userinfo.Data.Info.Uname,
+		GuardNum:    listInfo.Data.Info.Num,
+		FollowerNum: userinfo.Data.FollowerNum,
+		GuardOnline: toplistalive,
+		RankNum:     rankListInfo.Data.OnlineNum,
+		RankScore:   rankcount,
+	})
+	PushToBulletSender(svcCtx, fmt.Sprintf("当前对手:%v", userinfo.Data.Info.Uname))
+	PushToBulletSender(svcCtx, fmt.Sprintf("共%v船，%v粉", listInfo.Data.Info.Num, userinfo.Data.FollowerNum))
+	PushToBulletSender(svcCtx, fmt.Sprintf("当前%v船在线，高能榜%v人", toplistalive, rankListInfo.Data.OnlineNum))
+	PushToBulletSender(svcCtx, fmt.Sprintf("榜前50贡献%v分", rankcount))
 }
@@ -0,0 +1,61 @@
+package logic
+
+import (
+	"context"
+	"time"
+)
+
+// tokenBucket 令牌桶限速，只在发送弹幕的 goroutine 中使用，不加锁
+type tokenBucket struct {
+	rate   float64 // 每秒产生的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	b := &tokenBucket{last: time.Now()}
+	b.setLimit(rate, burst)
+	b.tokens = b.burst
+	return b
+}
+
+// setLimit 更新限速，配置重载后生效
+func (b *tokenBucket) setLimit(rate float64, burst int) {
+	if rate <= 0 {
+		rate = 1
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	b.rate = rate
+	b.burst = float64(burst)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait 等待并取走一个令牌
+func (b *tokenBucket) wait(ctx context.Context) error {
+	for {
+		b.refill(time.Now())
+		if b.tokens >= 1 {
+			b.tokens--
+			return nil
+		}
+		d := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
@@ -6,107 +6,114 @@ import (
 	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"github.com/zeromicro/go-zero/core/logx"
-	"strings"
 )
 
-var robot *BulletRobot
-
 type BulletRobot struct {
-	bulletRobotChan chan entity.Bullet
+	bulletRobotChan chan robotRequest
+}
+
+// robotRequest 等待机器人回复的弹幕
+type robotRequest struct {
+	chat  http.ChatRequest
+	reply []*entity.DanmuMsgTextReplyInfo
+}
+
+func newBulletRobot() *BulletRobot {
+	return &BulletRobot{
+		bulletRobotChan: make(chan robotRequest, 1000),
+	}
+}
+
+// PushToBulletRobot 请求机器人回复，不区分发送者，不使用对话记忆
+func PushToBulletRobot(svcCtx *svc.ServiceContext, content string, reply ...*entity.DanmuMsgTextReplyInfo) {
+	PushToBulletRobotFrom(svcCtx, 0, "", content, reply...)
 }
 
-func PushToBulletRobot(content string, reply ...*entity.DanmuMsgTextReplyInfo) {
+// PushToBulletRobotFrom 请求机器人回复，机器人按发送者分别记住对话
+func PushToBulletRobotFrom(svcCtx *svc.ServiceContext, uid int64, uname, content string, reply ...*entity.DanmuMsgTextReplyInfo) {
 	logx.Infof("PushToBulletRobot成功：%s", content)
-	buttle := entity.Bullet{
-		Msg:   content,
-		Reply: reply,
+	pipelinesOf(svcCtx).robot.bulletRobotChan <- robotRequest{
+		chat:  http.ChatRequest{Uid: uid, Uname: uname, Msg: content},
+		reply: reply,
 	}
-	robot.bulletRobotChan <- buttle
 }
 
 func StartBulletRobot(ctx context.Context, svcCtx *svc.ServiceContext) {
-	robot = &BulletRobot{
-		bulletRobotChan: make(chan entity.Bullet, 1000),
-	}
+	robot := pipelinesOf(svcCtx).robot
 
-	var content entity.Bullet
+	var content robotRequest
 
 	for {
 		select {
 		case <-ctx.Done():
 			goto END
 		case content = <-robot.bulletRobotChan:
-			handleRobotBullet(content, svcCtx)
+			handleRobotBullet(ctx, content, svcCtx)
 		}
 	}
 END:
 }
 
-func handleRobotBullet(content entity.Bullet, svcCtx *svc.ServiceContext) {
-	var err error
-	var reply string
-	if svcCtx.Config.RobotMode == "ChatGPT" {
-		if reply, err = http.RequestChatgptRobot(content.Msg, svcCtx); err != nil {
-			logx.Errorf("请求ChatGPT机器人失败：%v", err)
-			PushToBulletSender("不好意思，机器人坏掉了...", content.Reply...)
+// handleRobotBullet 按 RobotMode、RobotFallback 的顺序请求机器人，失败时换下一个服务，都失败时回复 RobotFailMsg
+func handleRobotBullet(ctx context.Context, content robotRequest, svcCtx *svc.ServiceContext) {
+	c := svcCtx.Config()
+	for _, p := range http.ChatChain(c) {
+		reqCtx, cancel := context.WithTimeout(ctx, p.Timeout(c))
+		reply, sent, err := askRobot(reqCtx, p, content, svcCtx)
+		cancel()
+		if err == nil {
+			logx.Infof("机器人(%s)回复：%s", p.Name(), reply)
 			return
 		}
-	} else if svcCtx.Config.RobotMode == "Qingyunke" {
-		if reply, err = http.RequestQingyunkeRobot(content.Msg); err != nil {
-			logx.Errorf("请求Qingyunke机器人失败：%v", err)
-			PushToBulletSender("不好意思，机器人坏掉了...", content.Reply...)
+		logx.Errorf("请求%s机器人失败：%v", p.Name(), err)
+		if sent || ctx.Err() != nil {
+			// 已经发出部分回复时不再换用其他服务，避免回复重复
 			return
 		}
-		bulltes := splitRobotReply(reply, svcCtx)
-		for _, v := range bulltes {
-			PushToBulletSender(v, content.Reply...)
-		}
-		return
-	} else if svcCtx.Config.RobotMode == "DeepSeek" {
-		if reply, err = http.RequestDeepSeekRobot(content.Msg, svcCtx); err != nil {
-			logx.Errorf("请求DeepSeek机器人失败：%v", err)
-			PushToBulletSender("不好意思，机器人坏掉了...", content.Reply...)
-			return
-		}
-		// 处理异常信息
-		reply = handleRobotReply(reply, svcCtx)
-	} else {
-		logx.Errorf("未知的机器人模式：%s", svcCtx.Config.RobotMode)
-		PushToBulletSender("不好意思，机器人坏掉了...", content.Reply...)
-		return
 	}
-	PushToBulletSender(reply, content.Reply...)
-	logx.Infof("机器人回复：%s", reply)
-
+	if c.RobotFailMsg != "" {
+		PushToBulletSender(svcCtx, c.RobotFailMsg, content.reply...)
+	}
 }
 
-func handleRobotReply(content string, svcCtx *svc.ServiceContext) string {
-	// 处理异常信息
-	return content
+// askRobot 请求一个机器人服务并发送回复，支持流式回复时每收到完整的一句就先发送；sent 为是否已经发出回复
+func askRobot(ctx context.Context, p http.ChatProvider, content robotRequest, svcCtx *svc.ServiceContext) (reply string, sent bool, err error) {
+	guard := newReplyGuard(svcCtx)
+	send := func(msg string) {
+		if msg = guard.check(msg); msg == "" {
+			return
+		}
+		if sent {
+			// 只有第一条弹幕@用户
+			PushToBulletSender(svcCtx, msg)
+		} else {
+			PushToBulletSender(svcCtx, msg, content.reply...)
+		}
+		sent = true
+	}
+	if sp, ok := p.(http.ChatStreamProvider); ok && svcCtx.Config().RobotStream {
+		chunker := newReplyChunker(DanmuLenOf(svcCtx), send)
+		reply, err = sp.ChatStream(ctx, svcCtx, &content.chat, chunker.write)
+		if err == nil {
+			chunker.flush()
+			safeReply(guard, sent, content, svcCtx)
+		}
+		return reply, sent, err
+	}
+	if reply, err = p.Chat(ctx, svcCtx, &content.chat); err != nil {
+		return "", false, err
+	}
+	send(reply)
+	safeReply(guard, sent, content, svcCtx)
+	return reply, sent, nil
 }
 
-// 将机器人回复语句中的 {br} 进行分割
-// b站弹幕一次只能发20个字符，需要切分
-func splitRobotReply(content string, svcCtx *svc.ServiceContext) []string {
-	//var res []string
-	reply := strings.Split(content, "{br}")
-
-	//for _, r := range reply {
-	//	// 长度大于20再分割
-	//	zh := []rune(r)
-	//	if len(zh) > 20 {
-	//		i := 0
-	//		for i < len(zh) {
-	//			if i+20 > len(zh) {
-	//				res = append(res, string(zh[i:]))
-	//			} else {
-	//				res = append(res, string(zh[i:i+20]))
-	//			}
-	//			i += 20
-	//		}
-	//	} else {
-	//		res = append(res, string(zh))
-	//	}
-	//}
-	return reply
+// safeReply 回复被过滤拒绝且还没有发出任何内容时改为发送 RobotFilter.SafeReply
+func safeReply(guard *replyGuard, sent bool, content robotRequest, svcCtx *svc.ServiceContext) {
+	if guard.rejected == nil || sent {
+		return
+	}
+	if msg := svcCtx.Config().RobotFilter.SafeReply; msg != "" {
+		PushToBulletSender(svcCtx, msg, content.reply...)
+	}
 }
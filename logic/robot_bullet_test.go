@@ -0,0 +1,128 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+type fakeChat struct {
+	name   string
+	reply  string
+	err    error
+	deltas []string
+	// 每发出一段增量后等待，用于确认回复完整之前已经发送
+	step chan struct{}
+}
+
+func (f *fakeChat) Name() string                         { return f.name }
+func (f *fakeChat) Timeout(*config.Config) time.Duration { return time.Second }
+
+func (f *fakeChat) Chat(ctx context.Context, _ *svc.ServiceContext, req *http.ChatRequest) (string, error) {
+	return f.reply, f.err
+}
+
+type fakeStreamChat struct{ fakeChat }
+
+func (f *fakeStreamChat) ChatStream(ctx context.Context, _ *svc.ServiceContext, req *http.ChatRequest, onDelta func(string)) (string, error) {
+	for _, d := range f.deltas {
+		onDelta(d)
+		if f.step != nil {
+			select {
+			case <-f.step:
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+	}
+	return strings.Join(f.deltas, ""), f.err
+}
+
+func newRobotTestRoom(t *testing.T, c config.Config) *svc.ServiceContext {
+	t.Helper()
+	if c.DanmuLen == 0 {
+		c.DanmuLen = 20
+	}
+	svcCtx := &svc.ServiceContext{}
+	svcCtx.SetConfig(&c)
+	t.Cleanup(func() { RemoveRoom(svcCtx) })
+	return svcCtx
+}
+
+// queued 取出发送队列中的弹幕
+func queued(svcCtx *svc.ServiceContext) []entity.Bullet {
+	var got []entity.Bullet
+	for {
+		b, ok, _ := pipelinesOf(svcCtx).sender.pop(time.Now(), 0, 100)
+		if !ok {
+			return got
+		}
+		got = append(got, b)
+	}
+}
+
+func TestRobotFallbackChain(t *testing.T) {
+	http.RegisterChatProvider(&fakeChat{name: "TestDown", err: errors.New("down")})
+	http.RegisterChatProvider(&fakeChat{name: "TestUp", reply: "我在"})
+
+	svcCtx := newRobotTestRoom(t, config.Config{RobotMode: "testdown", RobotFallback: []string{"Missing", "TestDown", "TestUp"}, RobotFailMsg: "坏了"})
+	reply := &entity.DanmuMsgTextReplyInfo{ReplyUid: "1"}
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "在吗"}, reply: []*entity.DanmuMsgTextReplyInfo{reply}}, svcCtx)
+	got := queued(svcCtx)
+	if len(got) != 1 || got[0].Msg != "我在" || len(got[0].Reply) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	svcCtx = newRobotTestRoom(t, config.Config{RobotMode: "TestDown", RobotFailMsg: "坏了"})
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "在吗"}}, svcCtx)
+	if got = queued(svcCtx); len(got) != 1 || got[0].Msg != "坏了" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestRobotStreamSendsFirstSentenceEarly(t *testing.T) {
+	step := make(chan struct{})
+	http.RegisterChatProvider(&fakeStreamChat{fakeChat{name: "TestStream", deltas: []string{"你好", "呀！今天", "天气不错", "。"}, step: step}})
+	svcCtx := newRobotTestRoom(t, config.Config{RobotMode: "TestStream", RobotStream: true})
+	reply := &entity.DanmuMsgTextReplyInfo{ReplyUid: "1"}
+
+	done := make(chan struct{})
+	go func() {
+		handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "你好"}, reply: []*entity.DanmuMsgTextReplyInfo{reply}}, svcCtx)
+		close(done)
+	}()
+	step <- struct{}{} // 你好
+	step <- struct{}{} // 呀！今天
+	// 第一句已经完整，回复结束前就已加入发送队列
+	got := queued(svcCtx)
+	if len(got) != 1 || got[0].Msg != "你好呀！" || len(got[0].Reply) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	step <- struct{}{}
+	step <- struct{}{}
+	<-done
+	got = queued(svcCtx)
+	if len(got) != 1 || got[0].Msg != "今天天气不错。" || len(got[0].Reply) != 0 {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestReplyChunker(t *testing.T) {
+	var got []string
+	c := newReplyChunker(10, func(s string) { got = append(got, s) })
+	for _, d := range []string{"哈哈", "！！", "这是一个", "非常非常长的句子，没有句号", "结尾", "……", "好"} {
+		c.write(d)
+	}
+	c.flush()
+	want := []string{"哈哈！！", "这是一个非常非常长的句子，", "没有句号结尾……", "好"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package logic
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// biliSensitiveWords 内置的B站敏感词表，发送时常因这些词被拒绝或被屏蔽
+var biliSensitiveWords = []string{
+	"加微信", "加vx", "加qq", "加群", "私信我", "扫码", "二维码",
+	"代练", "代充", "刷单", "返利", "兼职", "外挂", "破解版",
+	"赌博", "博彩", "彩票", "菠菜", "翻墙", "vpn",
+	"约炮", "裸聊", "黄网", "成人网站",
+}
+
+var (
+	urlPattern   = regexp.MustCompile(`(?i)(?:https?://|www\.)[\x21-\x7e]+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|cn|net|org|top|xyz|io|cc|me|tv|vip|info)\b(?:/[\x21-\x7e]*)?`)
+	phonePattern = regexp.MustCompile(`(?:\+?86[-\s]?)?\b1[3-9]\d{9}\b`)
+)
+
+// ReplyRejectedError 机器人回复被过滤拒绝
+type ReplyRejectedError struct {
+	Stage string // 拒绝的阶段
+	Match string // 命中的内容
+}
+
+func (e *ReplyRejectedError) Error() string {
+	return fmt.Sprintf("命中%s：%s", e.Stage, e.Match)
+}
+
+// replyFilter 回复过滤的一个阶段，返回过滤后的回复，拒绝时返回 *ReplyRejectedError
+type replyFilter interface {
+	filter(msg string) (string, error)
+}
+
+// patternFilter 按正则匹配的阶段：屏蔽词、正则、敏感词、网址、手机号
+type patternFilter struct {
+	stage   string
+	re      *regexp.Regexp
+	action  string
+	replace string
+}
+
+func (f patternFilter) filter(msg string) (string, error) {
+	loc := f.re.FindStringIndex(msg)
+	if loc == nil {
+		return msg, nil
+	}
+	switch strings.ToLower(f.action) {
+	case config.FilterReject:
+		return "", &ReplyRejectedError{Stage: f.stage, Match: msg[loc[0]:loc[1]]}
+	case config.FilterMask:
+		return f.re.ReplaceAllStringFunc(msg, func(s string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(s))
+		}), nil
+	}
+	return f.re.ReplaceAllLiteralString(msg, f.replace), nil
+}
+
+// sanitizeFilter 删除控制字符和超出数量的 emoji
+type sanitizeFilter struct {
+	maxEmoji int // 0 为不限制，-1 为全部删除
+}
+
+func (f sanitizeFilter) filter(msg string) (string, error) {
+	var b strings.Builder
+	emoji, dropping := 0, false
+	for _, r := range msg {
+		switch {
+		case r == '\n' || r == '\t':
+			b.WriteRune(' ')
+		case unicode.IsControl(r):
+		case r == 0x200d || r == 0xfe0f:
+			// 组合 emoji 的连接符跟随前一个 emoji 保留或删除
+			if !dropping {
+				b.WriteRune(r)
+			}
+		case isEmoji(r):
+			emoji++
+			dropping = f.maxEmoji < 0 || (f.maxEmoji > 0 && emoji > f.maxEmoji)
+			if !dropping {
+				b.WriteRune(r)
+			}
+		default:
+			dropping = false
+			b.WriteRune(r)
+		}
+	}
+	return b.String(), nil
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1f000 && r <= 0x1faff) || (r >= 0x2600 && r <= 0x27bf)
+}
+
+// wordPattern 将词表编译为一个不区分大小写的正则，长的词优先匹配
+func wordPattern(words []string) *regexp.Regexp {
+	var quoted []string
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// readWordFile 读取词表文件，每行一个词，# 开头的行为注释
+func readWordFile(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logx.Errorf("读取敏感词表 %s 失败：%v", path, err)
+		return nil
+	}
+	var words []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	return words
+}
+
+func enabledAction(action string) bool {
+	return action != "" && !strings.EqualFold(action, config.FilterOff)
+}
+
+// buildReplyFilters 按配置依次创建过滤阶段：屏蔽词和正则、B站敏感词、网址、手机号、字符清理
+func buildReplyFilters(c *config.Config) []replyFilter {
+	f := c.RobotFilter
+	var filters []replyFilter
+	add := func(stage string, re *regexp.Regexp, action string) {
+		if re != nil && enabledAction(action) {
+			filters = append(filters, patternFilter{stage: stage, re: re, action: action, replace: f.Replacement})
+		}
+	}
+	add("屏蔽词", wordPattern(append(append([]string(nil), c.DeepSeek.BlockedWords...), f.BlockedWords...)), f.BlockedAction)
+	for _, p := range f.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			logx.Errorf("屏蔽正则 %s 错误：%v", p, err)
+			continue
+		}
+		add("屏蔽正则", re, f.BlockedAction)
+	}
+	var sensitive []string
+	if f.SensitiveWords {
+		sensitive = append(sensitive, biliSensitiveWords...)
+	}
+	if f.SensitiveFile != "" {
+		sensitive = append(sensitive, readWordFile(f.SensitiveFile)...)
+	}
+	add("敏感词", wordPattern(sensitive), f.SensitiveAction)
+	add("网址", urlPattern, f.URLAction)
+	add("手机号", phonePattern, f.PhoneAction)
+	return append(filters, sanitizeFilter{maxEmoji: f.MaxEmoji})
+}
+
+// replyFilterCache 直播间号 -> *replyFilterEntry，每个直播间保存自己当前配置的过滤阶段
+var replyFilterCache sync.Map
+
+type replyFilterEntry struct {
+	c       *config.Config
+	filters []replyFilter
+}
+
+// replyFilters 当前配置的过滤阶段，配置重新加载后重新创建并替换该直播间之前的缓存
+func replyFilters(c *config.Config) []replyFilter {
+	if v, ok := replyFilterCache.Load(c.RoomId); ok {
+		if e := v.(*replyFilterEntry); e.c == c {
+			return e.filters
+		}
+	}
+	e := &replyFilterEntry{c: c, filters: buildReplyFilters(c)}
+	replyFilterCache.Store(c.RoomId, e)
+	return e.filters
+}
+
+// replyGuard 一次机器人回复的过滤状态，流式回复的每一段依次经过 check
+type replyGuard struct {
+	filters  []replyFilter
+	remain   int   // 剩余可以发送的字数，-1 为不限制
+	rejected error // 被拒绝后这次回复的后续内容都不再发送
+}
+
+func newReplyGuard(svcCtx *svc.ServiceContext) *replyGuard {
+	c := svcCtx.Config()
+	g := &replyGuard{filters: replyFilters(c), remain: -1}
+	if c.RobotFilter.MaxLen > 0 {
+		g.remain = c.RobotFilter.MaxLen
+	}
+	return g
+}
+
+// check 过滤一段回复，返回为空时不发送
+func (g *replyGuard) check(msg string) string {
+	if g.rejected != nil || g.remain == 0 {
+		return ""
+	}
+	for _, f := range g.filters {
+		out, err := f.filter(msg)
+		if err != nil {
+			g.rejected = err
+			logx.Errorf("机器人回复被拒绝，%v，回复：%s", err, msg)
+			return ""
+		}
+		msg = out
+	}
+	msg = strings.Join(strings.Fields(msg), " ")
+	if g.remain > 0 {
+		if cut := truncateReply(msg, g.remain); cut != msg {
+			// 截断后剩余的内容不再发送
+			g.remain = 0
+			return cut
+		}
+		g.remain -= utf8.RuneCountInString(msg)
+	}
+	return msg
+}
+
+// truncateReply 超过 n 个字时截断，尽量在句子结尾处截断
+func truncateReply(msg string, n int) string {
+	r := []rune(msg)
+	if len(r) <= n {
+		return msg
+	}
+	for i := n - 1; i >= n/2; i-- {
+		if strings.ContainsRune(sentenceEnds, r[i]) {
+			return string(r[:i+1])
+		}
+	}
+	return string(r[:n])
+}
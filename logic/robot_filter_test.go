@@ -0,0 +1,151 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
+)
+
+func filterConfig() config.Config {
+	var c config.Config
+	c.DeepSeek.BlockedWords = []string{"政治"}
+	c.RobotFilter.BlockedWords = []string{"坏词"}
+	c.RobotFilter.Patterns = []string{`订单号\d+`}
+	c.RobotFilter.BlockedAction = config.FilterReject
+	c.RobotFilter.SensitiveWords = true
+	c.RobotFilter.SensitiveAction = config.FilterMask
+	c.RobotFilter.URLAction = config.FilterRewrite
+	c.RobotFilter.PhoneAction = config.FilterRewrite
+	c.RobotFilter.Replacement = "[已删除]"
+	c.RobotFilter.MaxEmoji = 2
+	return c
+}
+
+func TestReplyGuard(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(file, []byte("# 注释\n自定义词\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := filterConfig()
+	c.RobotFilter.SensitiveFile = file
+	svcCtx := newRobotTestRoom(t, c)
+
+	for _, tc := range []struct{ in, want string }{
+		{"今天天气不错", "今天天气不错"},
+		{"有事加微信吧", "有事***吧"},
+		{"说个自定义词", "说个****"},
+		{"打开https://example.com/a?b=1看看", "打开[已删除]看看"},
+		{"官网bilibili.com见", "官网[已删除]见"},
+		{"电话13812345678找我", "电话[已删除]找我"},
+		{"好😀😀😀耶👍", "好😀😀耶"},
+		{"换\n行\x07了", "换 行了"},
+	} {
+		g := newReplyGuard(svcCtx)
+		if got := g.check(tc.in); got != tc.want || g.rejected != nil {
+			t.Errorf("check(%q) = %q, %v, want %q", tc.in, got, g.rejected, tc.want)
+		}
+	}
+
+	for _, in := range []string{"聊聊政治", "这是坏词", "订单号1234567"} {
+		g := newReplyGuard(svcCtx)
+		var rejected *ReplyRejectedError
+		if got := g.check(in); got != "" || !errors.As(g.rejected, &rejected) {
+			t.Errorf("check(%q) = %q, %v, want rejected", in, got, g.rejected)
+		}
+		// 被拒绝后同一次回复的后续内容也不发送
+		if got := g.check("正常的话"); got != "" {
+			t.Errorf("check after reject = %q", got)
+		}
+	}
+}
+
+func TestReplyGuardMaxLen(t *testing.T) {
+	c := filterConfig()
+	c.RobotFilter.MaxLen = 8
+	svcCtx := newRobotTestRoom(t, c)
+	g := newReplyGuard(svcCtx)
+	if got := g.check("你好呀！"); got != "你好呀！" {
+		t.Fatalf("got %q", got)
+	}
+	// 剩余 4 个字，在句子结尾处截断
+	if got := g.check("今天。天气不错哦"); got != "今天。" {
+		t.Fatalf("got %q", got)
+	}
+	if got := g.check("还有"); got != "" {
+		t.Fatalf("got %q after truncate", got)
+	}
+}
+
+func TestReplyFiltersPerRoom(t *testing.T) {
+	a, b := filterConfig(), filterConfig()
+	a.RoomId, b.RoomId = 101, 102
+	b.RobotFilter.BlockedWords = []string{"别的词"}
+	fa, fb := replyFilters(&a), replyFilters(&b)
+	// 两个直播间交替使用时各自的缓存都不会被重新创建
+	if &replyFilters(&a)[0] != &fa[0] || &replyFilters(&b)[0] != &fb[0] {
+		t.Fatal("filters rebuilt for an unchanged config")
+	}
+	reloaded := a
+	if &replyFilters(&reloaded)[0] == &fa[0] {
+		t.Fatal("filters not rebuilt after reload")
+	}
+	if v, _ := replyFilterCache.Load(a.RoomId); v.(*replyFilterEntry).c != &reloaded {
+		t.Fatal("old config still cached")
+	}
+}
+
+func TestRobotReplyRejected(t *testing.T) {
+	http.RegisterChatProvider(&fakeChat{name: "TestUnsafe", reply: "我们来聊聊政治"})
+	c := filterConfig()
+	c.RobotMode = "TestUnsafe"
+	c.RobotFilter.SafeReply = "换个话题吧"
+	svcCtx := newRobotTestRoom(t, c)
+	reply := &entity.DanmuMsgTextReplyInfo{ReplyUid: "1"}
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "聊点什么"}, reply: []*entity.DanmuMsgTextReplyInfo{reply}}, svcCtx)
+	got := queued(svcCtx)
+	if len(got) != 1 || got[0].Msg != "换个话题吧" || len(got[0].Reply) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+
+	// 流式回复已经发出部分内容后被拒绝，不再发送安全回复
+	http.RegisterChatProvider(&fakeStreamChat{fakeChat{name: "TestUnsafeStream", deltas: []string{"你好！", "我们聊政治。"}}})
+	c.RobotMode = "TestUnsafeStream"
+	c.RobotStream = true
+	svcCtx = newRobotTestRoom(t, c)
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "你好"}}, svcCtx)
+	if got = queued(svcCtx); len(got) != 1 || got[0].Msg != "你好！" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestRobotStreamFilterAcrossChunks(t *testing.T) {
+	c := filterConfig()
+	c.DanmuLen = 10
+	c.RobotStream = true
+	c.RobotFilter.SafeReply = "换个话题吧"
+
+	// 屏蔽词跨越一条弹幕的长度
+	http.RegisterChatProvider(&fakeStreamChat{fakeChat{name: "TestSplitWord", deltas: []string{"一二三四五六七八九坏", "词就是这样"}}})
+	c.RobotMode = "TestSplitWord"
+	svcCtx := newRobotTestRoom(t, c)
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "你好"}}, svcCtx)
+	if got := queued(svcCtx); len(got) != 1 || got[0].Msg != "换个话题吧" {
+		t.Fatalf("blocked word across chunks: %+v", got)
+	}
+
+	// 手机号跨越一条弹幕的长度
+	http.RegisterChatProvider(&fakeStreamChat{fakeChat{name: "TestSplitPhone", deltas: []string{"一二三四五六138", "00138000好的。", "再见"}}})
+	c.RobotMode = "TestSplitPhone"
+	svcCtx = newRobotTestRoom(t, c)
+	handleRobotBullet(context.Background(), robotRequest{chat: http.ChatRequest{Msg: "你好"}}, svcCtx)
+	got := queued(svcCtx)
+	if len(got) != 2 || got[0].Msg != "一二三四五六[已删除]好的。" || got[1].Msg != "再见" {
+		t.Fatalf("phone across chunks: %+v", got)
+	}
+}
@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sentenceEnds 句子结束的标点，流式回复在这里断开
+const sentenceEnds = "。！？!?；;…~\n"
+
+// softBreaks 句子过长时优先在这里断开
+const softBreaks = "，,、：: "
+
+// replyChunker 将流式回复切成完整的句子，收到一句就交给 emit，不必等待完整的回复
+type replyChunker struct {
+	buf    []rune
+	maxLen int
+	emit   func(string)
+}
+
+func newReplyChunker(maxLen int, emit func(string)) *replyChunker {
+	if maxLen <= 0 {
+		maxLen = 20
+	}
+	return &replyChunker{maxLen: maxLen, emit: emit}
+}
+
+// write 追加增量文本，发出已经完整的句子
+func (c *replyChunker) write(delta string) {
+	c.buf = append(c.buf, []rune(delta)...)
+	for {
+		n := c.cut()
+		if n == 0 {
+			return
+		}
+		c.send(c.buf[:n])
+		c.buf = c.buf[n:]
+	}
+}
+
+// flush 发出剩余的文本
+func (c *replyChunker) flush() {
+	c.send(c.buf)
+	c.buf = nil
+}
+
+func (c *replyChunker) send(r []rune) {
+	if s := strings.TrimFunc(string(r), unicode.IsSpace); s != "" {
+		c.emit(s)
+	}
+}
+
+// cut 返回可以发出的长度：不超过一条弹幕的最后一个句子结尾，没有时等待更多文本；
+// 超过一条弹幕仍没有句子结尾时在标点处断开，没有标点时继续等待，不在文字中间硬拆，
+// 否则跨越断开处的屏蔽词、网址和手机号在每一段中都不完整，会绕过回复过滤；过长的一段由发送时再拆分
+func (c *replyChunker) cut() int {
+	limit := len(c.buf)
+	if limit > c.maxLen {
+		limit = c.maxLen
+	}
+	// 连续的结束标点一起发出，如 "！！"、"……"
+	for i := limit - 1; i >= 0; i-- {
+		if strings.ContainsRune(sentenceEnds, c.buf[i]) {
+			n := i + 1
+			for n < len(c.buf) && strings.ContainsRune(sentenceEnds, c.buf[n]) {
+				n++
+			}
+			if n < len(c.buf) {
+				return n
+			}
+			// 结束标点在末尾时后面可能还有结束标点，先发出前面的句子
+		}
+	}
+	if len(c.buf) <= c.maxLen {
+		return 0
+	}
+	for i := c.maxLen - 1; i > 0; i-- {
+		if strings.ContainsRune(softBreaks, c.buf[i]) {
+			return i + 1
+		}
+	}
+	// 一条弹幕内没有标点时在之后的第一个标点处断开
+	for i := c.maxLen; i < len(c.buf)-1; i++ {
+		if strings.ContainsRune(sentenceEnds, c.buf[i]) || strings.ContainsRune(softBreaks, c.buf[i]) {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"sync"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+// 每个直播间独立的一组处理管线，以房间的 ServiceContext 区分
+type roomPipelines struct {
+	sender         *BulletSender
+	robot          *BulletRobot
+	thanksGiver    *GiftThanksGiver
+	pkGiver        *PKGiver
+	interractGiver *InterractGiver
+}
+
+var (
+	roomsMu sync.Mutex
+	rooms   = make(map[*svc.ServiceContext]*roomPipelines)
+)
+
+// pipelinesOf 获取直播间的处理管线，不存在时创建
+// 管线在 Start 之前就可以接收消息，避免启动顺序导致的空指针
+func pipelinesOf(svcCtx *svc.ServiceContext) *roomPipelines {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	p, ok := rooms[svcCtx]
+	if !ok {
+		p = &roomPipelines{
+			sender:         newBulletSender(),
+			robot:          newBulletRobot(),
+			thanksGiver:    newGiftThanksGiver(),
+			pkGiver:        newPKGiver(),
+			interractGiver: newInterractGiver(),
+		}
+		rooms[svcCtx] = p
+	}
+	return p
+}
+
+// RemoveRoom 释放直播间的处理管线，需在该房间的所有 goroutine 退出后调用
+func RemoveRoom(svcCtx *svc.ServiceContext) {
+	roomsMu.Lock()
+	delete(rooms, svcCtx)
+	roomsMu.Unlock()
+}
+
+// resumeAuthPaused 重新登录成功，所有直播间恢复发送
+func resumeAuthPaused() {
+	roomsMu.Lock()
+	defer roomsMu.Unlock()
+	for _, p := range rooms {
+		p.sender.resumeAuth()
+	}
+}
@@ -2,69 +2,320 @@ package logic
 
 import (
 	"context"
+	"sync"
+	"time"
+
 	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/http"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"github.com/zeromicro/go-zero/core/logx"
-	"time"
 )
 
-var sender *BulletSender
+// 每个优先级队列的最大长度，超出时丢弃最早的弹幕
+const bulletQueueSize = 200
+
+// 各优先级弹幕在队列中的最长等待时间，超时未发送的直接丢弃，0 表示不丢弃
+var bulletMaxAge = [entity.BulletPriorityCount]time.Duration{
+	entity.BulletPriorityReply:   2 * time.Minute,
+	entity.BulletPriorityWelcome: 30 * time.Second,
+	entity.BulletPriorityCron:    time.Minute,
+}
 
+const (
+	mutedPause = 10 * time.Minute // 被禁言后暂停发送的时间
+	authPause  = time.Minute      // 登录失效后暂停发送的时间，重新登录成功时提前恢复
+)
+
+// BulletSender 按优先级发送弹幕，同一优先级先进先出
 type BulletSender struct {
-	bulletChan chan entity.Bullet
+	locked sync.Mutex
+	queues [entity.BulletPriorityCount][]entity.Bullet
+	notify chan struct{}
+	// 被禁言时暂停发送
+	pausedUntil time.Time
+	// 登录失效时暂停发送，重新登录成功后清除并通过 resumed 唤醒
+	authUntil time.Time
+	resumed   chan struct{}
+	// 取出的弹幕正在发送
+	busy bool
+	// 只在发送弹幕的 goroutine 中使用
+	repeat *repeatFilter
+	// 每个合并模板上次发送的时间，窗口内再次出现的同模板弹幕才等待合并
+	mergedAt map[string]time.Time
+}
+
+func newBulletSender() *BulletSender {
+	return &BulletSender{
+		notify:   make(chan struct{}, 1),
+		resumed:  make(chan struct{}, 1),
+		repeat:   newRepeatFilter(),
+		mergedAt: make(map[string]time.Time),
+	}
+}
+
+// PushToBulletSender 以普通互动的优先级发送弹幕
+func PushToBulletSender(svcCtx *svc.ServiceContext, msg string, reply ...*entity.DanmuMsgTextReplyInfo) {
+	PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityReply, msg, reply...)
 }
 
-func PushToBulletSender(msg string, reply ...*entity.DanmuMsgTextReplyInfo) {
+// PushToBulletSenderWithPriority 以指定优先级发送弹幕
+func PushToBulletSenderWithPriority(svcCtx *svc.ServiceContext, priority entity.BulletPriority, msg string, reply ...*entity.DanmuMsgTextReplyInfo) {
 	logx.Info("PushToBulletSender成功", msg)
-	bullet := entity.Bullet{
-		Msg:   msg,
-		Reply: reply,
+	pipelinesOf(svcCtx).sender.push(entity.Bullet{
+		Msg:      msg,
+		Reply:    reply,
+		Priority: priority,
+		Time:     time.Now(),
+	})
+}
+
+func (s *BulletSender) push(bullet entity.Bullet) {
+	if bullet.Priority < 0 || bullet.Priority >= entity.BulletPriorityCount {
+		bullet.Priority = entity.BulletPriorityReply
+	}
+	s.locked.Lock()
+	q := append(s.queues[bullet.Priority], bullet)
+	if len(q) > bulletQueueSize {
+		logx.Errorf("弹幕发送队列已满，丢弃弹幕：%s", q[0].Msg)
+		q = q[1:]
+	}
+	s.queues[bullet.Priority] = q
+	s.locked.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop 取出优先级最高的弹幕，同时丢弃等待过久的弹幕
+// 同一模板的第一条弹幕立即发送，距上一条同模板弹幕发送不到合并窗口时等到窗口结束再合并发送，
+// 因此连续的欢迎、感谢最多延迟一个窗口；队列中没有可发送的弹幕时返回需要等待的时间
+func (s *BulletSender) pop(now time.Time, window time.Duration, danmuLen int) (entity.Bullet, bool, time.Duration) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	var wait time.Duration
+	for p := range s.queues {
+		q := s.queues[p]
+		if maxAge := bulletMaxAge[p]; maxAge > 0 {
+			for len(q) > 0 && now.Sub(q[0].Time) > maxAge {
+				logx.Infof("弹幕等待超过 %v 已丢弃：%s", maxAge, q[0].Msg)
+				q = q[1:]
+			}
+		}
+		if len(q) == 0 {
+			s.queues[p] = nil
+			continue
+		}
+		s.queues[p] = q
+		bullet := q[0]
+		if last, ok := s.mergedAt[bullet.MergeKey]; ok && bullet.MergeKey != "" && window > 0 {
+			if ready := last.Add(window); now.Before(ready) {
+				if d := ready.Sub(now); wait == 0 || d < wait {
+					wait = d
+				}
+				continue
+			}
+		}
+		bullet, s.queues[p] = mergeQueued(bullet, q[1:], window, danmuLen)
+		if bullet.MergeKey != "" && window > 0 {
+			for key, last := range s.mergedAt {
+				if now.Sub(last) >= window {
+					delete(s.mergedAt, key)
+				}
+			}
+			s.mergedAt[bullet.MergeKey] = now
+		}
+		s.busy = true
+		return bullet, true, 0
 	}
-	sender.bulletChan <- bullet
+	return entity.Bullet{}, false, wait
 }
 
 func StartSendBullet(ctx context.Context, svcCtx *svc.ServiceContext) {
+	sender := pipelinesOf(svcCtx).sender
+	c := svcCtx.Config()
+	bucket := newTokenBucket(c.DanmuRate, c.DanmuBurst)
 
-	sender = &BulletSender{
-		bulletChan: make(chan entity.Bullet, 1000),
+	for {
+		window := time.Duration(svcCtx.Config().DanmuMergeWindow) * time.Second
+		danmuLen := DanmuLenOf(svcCtx)
+		bullet, ok, wait := sender.pop(time.Now(), window, danmuLen)
+		if !ok {
+			var timer <-chan time.Time
+			if wait > 0 {
+				timer = time.After(wait)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-sender.notify:
+			case <-timer:
+			}
+			continue
+		}
+		// 同一条弹幕拆分出的多段连续发送，不被更高优先级的弹幕打断，只有第一段带上回复
+		reply := bullet.Reply
+		for _, msg := range SplitBullet(bullet.Msg, danmuLen) {
+			if err := sender.send(ctx, svcCtx, bucket, msg, reply...); err != nil && ctx.Err() != nil {
+				sender.done()
+				return
+			}
+			reply = nil
+		}
+		sender.done()
 	}
+}
 
-	var msg string
-	for {
+// done 取出的弹幕发送结束
+func (s *BulletSender) done() {
+	s.locked.Lock()
+	s.busy = false
+	s.locked.Unlock()
+}
+
+// idle 队列为空且没有正在发送的弹幕
+func (s *BulletSender) idle() bool {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	for _, q := range s.queues {
+		if len(q) > 0 {
+			return false
+		}
+	}
+	return !s.busy
+}
+
+// FlushBulletSender 等待直播间队列中的弹幕全部发送完，需要 StartSendBullet 正在运行，ctx 取消时返回 ctx.Err()
+func FlushBulletSender(ctx context.Context, svcCtx *svc.ServiceContext) error {
+	sender := pipelinesOf(svcCtx).sender
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !sender.idle() {
 		select {
 		case <-ctx.Done():
-			goto END
-		case bullet := <-sender.bulletChan:
-			msg = bullet.Msg
-			var danmuLen = svcCtx.Config.DanmuLen
-			var msgdata []string
-			msgrun := []rune(msg)
-			msgLen := len(msgrun)
-			msgcount := msgLen / danmuLen
-			tmpmsgcount := msgLen % danmuLen
-			if tmpmsgcount != 0 {
-				msgcount += 1
-			}
-			for m := 1; m <= msgcount; m++ {
-				if msgLen < m*danmuLen {
-					msgdata = append(msgdata, string(msgrun[(m-1)*danmuLen:msgLen]))
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// send 限速发送一段弹幕，根据发送结果退避重试、改写、暂停发送或重新登录，失败的弹幕直接丢弃
+func (s *BulletSender) send(ctx context.Context, svcCtx *svc.ServiceContext, bucket *tokenBucket, msg string, reply ...*entity.DanmuMsgTextReplyInfo) error {
+	repeatWindow := time.Duration(svcCtx.Config().DanmuRepeatWindow) * time.Second
+	msg = s.repeat.vary(msg, time.Now(), repeatWindow, DanmuLenOf(svcCtx))
+	rewritten := false
+	retries := 0
+	for {
+		c := svcCtx.Config()
+		if err := s.waitPause(ctx); err != nil {
+			return err
+		}
+		bucket.setLimit(c.DanmuRate, c.DanmuBurst)
+		if err := bucket.wait(ctx); err != nil {
+			return err
+		}
+		r, err := http.Send(msg, svcCtx, reply...)
+		var backoff time.Duration
+		switch r.Status {
+		case http.SendAccepted:
+			s.repeat.record(msg, time.Now())
+			logx.Infof("弹幕发送成功：%s", msg)
+			return nil
+		case http.SendSensitive, http.SendShadowFiltered:
+			// 内容问题重试没有意义，只尝试改写一次
+			if !rewritten {
+				if m, ok := rewriteBullet(svcCtx, msg); ok && m != msg {
+					logx.Infof("弹幕%v，改写后重新发送：%s -> %s", r.Status, msg, m)
+					msg, rewritten = m, true
 					continue
 				}
-				msgdata = append(msgdata, string(msgrun[(m-1)*danmuLen:danmuLen*m]))
 			}
-			for _, msgs := range msgdata {
-				if err := http.Send(msgs, svcCtx, bullet.Reply...); err != nil {
-					logx.Errorf("弹幕发送失败：%s msg: %s", err, msgs)
-					PushToBulletSender("回复弹幕失败："+err.Error()+" msg: "+msgs, bullet.Reply...)
-				} else {
-					logx.Infof("弹幕发送成功：%s", msgs)
-				}
-				//fmt.Println(msgs)
-				time.Sleep(1 * time.Second) // 防止弹幕发送过快
+			logx.Errorf("弹幕%v，已丢弃：%s", r.Status, msg)
+			return err
+		case http.SendMuted:
+			logx.Errorf("账号在直播间 %v 被禁言，暂停发送 %v", c.RoomId, mutedPause)
+			s.pause(mutedPause)
+			return err
+		case http.SendAuthExpired:
+			// 重新登录可能要等待扫码，不能阻塞发送循环，暂停发送后在后台进行
+			logx.Errorf("登录已失效，暂停发送 %v 并重新登录", authPause)
+			s.pauseAuth(authPause)
+			startRelogin()
+		case http.SendRateLimited:
+			backoff = r.RetryAfter
+		default:
+			backoff = time.Duration(retries+1) * 2 * time.Second
+		}
+		retries++
+		if retries > c.DanmuMaxRetry {
+			logx.Errorf("弹幕发送失败，已丢弃：%s", msg)
+			return err
+		}
+		logx.Errorf("弹幕发送失败(第%d次)：%s msg: %s", retries, err, msg)
+		if backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
 			}
 		}
+	}
+}
+
+// pause 暂停发送直到 d 之后
+func (s *BulletSender) pause(d time.Duration) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	if until := time.Now().Add(d); until.After(s.pausedUntil) {
+		s.pausedUntil = until
+	}
+}
+
+// pauseAuth 登录失效时暂停发送直到 d 之后，重新登录成功时由 resumeAuth 提前恢复
+func (s *BulletSender) pauseAuth(d time.Duration) {
+	s.locked.Lock()
+	defer s.locked.Unlock()
+	if until := time.Now().Add(d); until.After(s.authUntil) {
+		s.authUntil = until
+	}
+}
+
+// resumeAuth 重新登录成功，结束登录失效的暂停
+func (s *BulletSender) resumeAuth() {
+	s.locked.Lock()
+	s.authUntil = time.Time{}
+	s.locked.Unlock()
+	select {
+	case s.resumed <- struct{}{}:
+	default:
+	}
+}
 
+// waitPause 等待暂停结束
+func (s *BulletSender) waitPause(ctx context.Context) error {
+	for {
+		s.locked.Lock()
+		until := s.pausedUntil
+		if s.authUntil.After(until) {
+			until = s.authUntil
+		}
+		s.locked.Unlock()
+		d := time.Until(until)
+		if d <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+			return nil
+		case <-s.resumed:
+		}
 	}
-END:
+}
+
+// PauseBulletSender 暂停直播间的弹幕发送，期间进入队列的弹幕照常排队，等待过久的会被丢弃
+func PauseBulletSender(svcCtx *svc.ServiceContext, d time.Duration) {
+	pipelinesOf(svcCtx).sender.pause(d)
 }
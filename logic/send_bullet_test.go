@@ -0,0 +1,62 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+)
+
+func TestBulletSenderPopOrder(t *testing.T) {
+	s := newBulletSender()
+	now := time.Now()
+	s.push(entity.Bullet{Msg: "cron", Priority: entity.BulletPriorityCron, Time: now})
+	s.push(entity.Bullet{Msg: "welcome", Priority: entity.BulletPriorityWelcome, Time: now})
+	s.push(entity.Bullet{Msg: "old welcome", Priority: entity.BulletPriorityWelcome, Time: now.Add(-time.Hour)})
+	s.push(entity.Bullet{Msg: "gift1", Priority: entity.BulletPriorityGift, Time: now.Add(-time.Hour)})
+	s.push(entity.Bullet{Msg: "anchor", Priority: entity.BulletPriorityAnchor, Time: now})
+	s.push(entity.Bullet{Msg: "gift2", Priority: entity.BulletPriorityGift, Time: now})
+
+	var got []string
+	for {
+		b, ok, _ := s.pop(now, 0, 20)
+		if !ok {
+			break
+		}
+		got = append(got, b.Msg)
+	}
+	want := []string{"anchor", "gift1", "gift2", "welcome", "cron"}
+	if len(got) != len(want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("want %v, got %v", want, got)
+		}
+	}
+}
+
+func TestBulletSenderQueueBound(t *testing.T) {
+	s := newBulletSender()
+	for i := 0; i < bulletQueueSize+10; i++ {
+		s.push(entity.Bullet{Msg: "w", Priority: entity.BulletPriorityWelcome, Time: time.Now()})
+	}
+	if n := len(s.queues[entity.BulletPriorityWelcome]); n != bulletQueueSize {
+		t.Fatalf("want queue bounded to %d, got %d", bulletQueueSize, n)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10, 2)
+	now := b.last
+	b.refill(now)
+	b.tokens -= 2
+	b.refill(now.Add(50 * time.Millisecond))
+	if b.tokens < 0.49 || b.tokens > 0.51 {
+		t.Fatalf("want 0.5 tokens, got %v", b.tokens)
+	}
+	b.refill(now.Add(10 * time.Second))
+	if b.tokens != 2 {
+		t.Fatalf("want tokens capped at burst, got %v", b.tokens)
+	}
+}
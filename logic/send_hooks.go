@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// BulletRewriter 弹幕因敏感词被拒绝或被屏蔽时改写内容，返回 false 表示放弃发送
+type BulletRewriter func(svcCtx *svc.ServiceContext, msg string) (string, bool)
+
+var (
+	hooksMu        sync.RWMutex
+	bulletRewriter BulletRewriter
+	reloginHook    func() error
+	// 后台重新登录正在进行
+	reloginRunning atomic.Bool
+)
+
+// SetBulletRewriter 设置弹幕改写函数，为 nil 时被拒绝的弹幕直接丢弃
+func SetBulletRewriter(r BulletRewriter) {
+	hooksMu.Lock()
+	bulletRewriter = r
+	hooksMu.Unlock()
+}
+
+// SetReloginHook 设置登录失效时的重新登录函数，在后台 goroutine 中调用，可能等待扫码，期间各直播间暂停发送
+func SetReloginHook(f func() error) {
+	hooksMu.Lock()
+	reloginHook = f
+	hooksMu.Unlock()
+}
+
+func rewriteBullet(svcCtx *svc.ServiceContext, msg string) (string, bool) {
+	hooksMu.RLock()
+	r := bulletRewriter
+	hooksMu.RUnlock()
+	if r == nil {
+		return "", false
+	}
+	return r(svcCtx, msg)
+}
+
+func relogin() error {
+	hooksMu.RLock()
+	f := reloginHook
+	hooksMu.RUnlock()
+	if f == nil {
+		return errors.New("未设置重新登录方式")
+	}
+	return f()
+}
+
+// startRelogin 在后台重新登录，已经在进行时直接返回；成功后所有直播间恢复发送，失败时等待暂停结束
+func startRelogin() {
+	if !reloginRunning.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer reloginRunning.Store(false)
+		if err := relogin(); err != nil {
+			logx.Errorf("登录已失效且重新登录失败，%v 后重试发送：%v", authPause, err)
+			return
+		}
+		logx.Info("登录已失效，重新登录成功")
+		resumeAuthPaused()
+	}()
+}
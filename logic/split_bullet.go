@@ -0,0 +1,275 @@
+package logic
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
+)
+
+// 拆分后非最后一段的续接标记
+const continuationMarker = "…"
+
+// 颜文字等括号内容不超过该长度时视为一个整体
+const maxKaomojiLen = 12
+
+// 适合断开的标点，断在标点之后
+const breakPunct = "，。！？；：、,.!?;:~～…）)】」』》"
+
+type splitUnitKind int
+
+const (
+	unitChar  splitUnitKind = iota // 单个字素簇，如汉字、emoji
+	unitWord                       // 字母、数字、URL 等不应拆开的连续字符
+	unitSpace                      // 空白，可以断开且断开时丢弃
+	unitPunct                      // 标点，可以在其后断开
+)
+
+type splitUnit struct {
+	text  string
+	width int // 字符数
+	kind  splitUnitKind
+}
+
+// DanmuLenOf 返回直播间实际可用的弹幕长度，取配置和机器人账号等级限制中较小的一个
+func DanmuLenOf(svcCtx *svc.ServiceContext) int {
+	l := svcCtx.Config().DanmuLen
+	if svcCtx.DanmuLenLimit > 0 && (l <= 0 || svcCtx.DanmuLenLimit < l) {
+		l = svcCtx.DanmuLenLimit
+	}
+	return l
+}
+
+// SplitBullet 将文本拆分为不超过 maxLen 个字符的多条弹幕
+//
+// {br} 和换行强制分段；优先在标点和空白处断开，不拆开 emoji 等字素簇、颜文字、URL 和数字；
+// 同一段被拆开时，除最后一条外在末尾加上续接标记
+func SplitBullet(text string, maxLen int) []string {
+	var res []string
+	text = strings.ReplaceAll(text, "{br}", "\n")
+	for _, para := range strings.Split(text, "\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		if maxLen <= 0 || runeLen(para) <= maxLen {
+			res = append(res, para)
+			continue
+		}
+		res = append(res, splitParagraph(para, maxLen)...)
+	}
+	return res
+}
+
+func splitParagraph(para string, maxLen int) []string {
+	units := splitUnits(para, maxLen)
+	// 需要续接标记时给标记留出位置
+	limit := maxLen
+	if maxLen > runeLen(continuationMarker) {
+		limit = maxLen - runeLen(continuationMarker)
+	}
+
+	var chunks []string
+	var cur []splitUnit
+	width := 0
+	flush := func(cont bool) {
+		if chunk := joinUnits(cur, cont, maxLen); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		cur, width = nil, 0
+	}
+	for len(units) > 0 {
+		u := units[0]
+		if len(cur) == 0 && (u.kind == unitSpace || u.width == 0) {
+			// 每条开头的空白和空单元直接丢弃
+			units = units[1:]
+			continue
+		}
+		// 最后一个单元不需要续接标记；单独一个单元不超过 maxLen 时也不拆开，放不下标记时不加
+		if width+u.width <= limit || ((len(units) == 1 || len(cur) == 0) && width+u.width <= maxLen) {
+			cur = append(cur, u)
+			width += u.width
+			units = units[1:]
+			continue
+		}
+		if len(cur) == 0 {
+			// 单个单元超长，只能按字素簇硬拆
+			head, tail := cutUnit(u, limit)
+			cur = append(cur, head)
+			if tail.text == "" {
+				units = units[1:]
+			} else {
+				units[0] = tail
+			}
+		} else if i := lastBreak(cur); i > 0 && unitsWidth(cur[:i]) >= limit/2 {
+			// 退回到最近的断点，断点之后的内容放到下一条
+			units = append(append([]splitUnit{}, cur[i:]...), units...)
+			cur = cur[:i]
+		}
+		flush(len(units) > 0)
+	}
+	flush(false)
+	return chunks
+}
+
+// splitUnits 将段落切分为不可拆分的单元
+func splitUnits(para string, maxLen int) []splitUnit {
+	clusters := graphemes(para)
+	var units []splitUnit
+	for i := 0; i < len(clusters); {
+		c := clusters[i]
+		r := []rune(c)[0]
+		switch {
+		case unicode.IsSpace(r):
+			units = append(units, splitUnit{text: c, width: 1, kind: unitSpace})
+			i++
+		case r == '(' || r == '（':
+			// 颜文字，如 (´・ω・`)
+			if j := closingParen(clusters, i, maxLen); j > i {
+				units = append(units, splitUnit{text: strings.Join(clusters[i:j+1], ""), width: runeLen(strings.Join(clusters[i:j+1], "")), kind: unitWord})
+				i = j + 1
+				continue
+			}
+			units = append(units, splitUnit{text: c, width: runeLen(c), kind: unitChar})
+			i++
+		case isWordRune(r):
+			j := i
+			for j < len(clusters) && isWordRune([]rune(clusters[j])[0]) {
+				j++
+			}
+			word := strings.Join(clusters[i:j], "")
+			units = append(units, splitUnit{text: word, width: runeLen(word), kind: unitWord})
+			i = j
+		case strings.ContainsRune(breakPunct, r):
+			units = append(units, splitUnit{text: c, width: runeLen(c), kind: unitPunct})
+			i++
+		default:
+			units = append(units, splitUnit{text: c, width: runeLen(c), kind: unitChar})
+			i++
+		}
+	}
+	return units
+}
+
+// closingParen 查找与 clusters[i] 配对的右括号，括号内容过长时不视为颜文字
+func closingParen(clusters []string, i, maxLen int) int {
+	limit := maxKaomojiLen
+	if maxLen > 0 && maxLen/2 < limit {
+		limit = maxLen / 2
+	}
+	for j := i + 1; j < len(clusters) && j-i < limit; j++ {
+		switch clusters[j] {
+		case ")", "）":
+			return j
+		case "(", "（":
+			return -1
+		}
+	}
+	return -1
+}
+
+// isWordRune 字母、数字以及 URL 中常见的符号
+func isWordRune(r rune) bool {
+	if r < unicode.MaxASCII {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("/:.?=&%#_-+@", r)
+	}
+	return false
+}
+
+// lastBreak 返回最后一个可断开的位置，断在该下标之前
+func lastBreak(units []splitUnit) int {
+	for i := len(units) - 1; i > 0; i-- {
+		switch units[i-1].kind {
+		case unitPunct, unitSpace:
+			return i
+		}
+	}
+	return 0
+}
+
+// cutUnit 将超长的单元按字素簇切为两部分
+func cutUnit(u splitUnit, limit int) (splitUnit, splitUnit) {
+	clusters := graphemes(u.text)
+	var head strings.Builder
+	width := 0
+	i := 0
+	for ; i < len(clusters); i++ {
+		w := runeLen(clusters[i])
+		if width+w > limit && i > 0 {
+			break
+		}
+		head.WriteString(clusters[i])
+		width += w
+	}
+	tail := strings.Join(clusters[i:], "")
+	return splitUnit{text: head.String(), width: width, kind: u.kind},
+		splitUnit{text: tail, width: runeLen(tail), kind: u.kind}
+}
+
+func unitsWidth(units []splitUnit) int {
+	w := 0
+	for _, u := range units {
+		w += u.width
+	}
+	return w
+}
+
+// joinUnits 拼接单元，cont 为 true 时表示后面还有内容，加上续接标记后不超过 maxLen 时才加
+func joinUnits(units []splitUnit, cont bool, maxLen int) string {
+	var b strings.Builder
+	for _, u := range units {
+		b.WriteString(u.text)
+	}
+	s := strings.TrimSpace(b.String())
+	if cont && s != "" && runeLen(s)+runeLen(continuationMarker) <= maxLen {
+		last := []rune(s)[len([]rune(s))-1]
+		if !strings.ContainsRune(breakPunct, last) {
+			s += continuationMarker
+		}
+	}
+	return s
+}
+
+// graphemes 按字素簇切分，处理组合字符、变体选择符、肤色修饰、零宽连接和国旗
+func graphemes(s string) []string {
+	var res []string
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		// 国旗由两个区域指示符组成
+		if isRegionalIndicator(runes[i]) && j < len(runes) && isRegionalIndicator(runes[j]) {
+			j++
+		}
+		for j < len(runes) {
+			r := runes[j]
+			if isExtend(r) {
+				j++
+				continue
+			}
+			// 零宽连接符连接下一个字符
+			if r == '\u200d' && j+1 < len(runes) {
+				j += 2
+				continue
+			}
+			break
+		}
+		res = append(res, string(runes[i:j]))
+		i = j
+	}
+	return res
+}
+
+func isExtend(r rune) bool {
+	return unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) ||
+		(r >= 0xfe00 && r <= 0xfe0f) || // 变体选择符
+		(r >= 0x1f3fb && r <= 0x1f3ff) || // 肤色修饰
+		(r >= 0xe0020 && r <= 0xe007f) // 标签字符
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+func runeLen(s string) int {
+	return len([]rune(s))
+}
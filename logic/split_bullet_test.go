@@ -0,0 +1,90 @@
+package logic
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitBulletShort(t *testing.T) {
+	got := SplitBullet("你好{br}  世界  \n", 20)
+	if len(got) != 2 || got[0] != "你好" || got[1] != "世界" {
+		t.Fatalf("unexpected split: %q", got)
+	}
+}
+
+func TestSplitBulletPunctuation(t *testing.T) {
+	got := SplitBullet("今天天气很好，我们一起去公园散步吧，顺便买点好吃的", 20)
+	want := []string{"今天天气很好，我们一起去公园散步吧，", "顺便买点好吃的"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("want %q, got %q", want, got)
+	}
+}
+
+func TestSplitBulletKeepsUnits(t *testing.T) {
+	cases := []struct {
+		text string
+		keep string
+	}{
+		{"快来看看这个直播间吧链接是 https://b23.tv/x1 哦", "https://b23.tv/x1"},
+		{"一二三四五六七八九十一二三四五👨‍👩‍👧‍👦后面还有字", "👨‍👩‍👧‍👦"},
+		{"一二三四五六七八九十一二三四五🇨🇳后面还有字", "🇨🇳"},
+		{"一二三四五六七八九十一二三四(´・ω・`)后面还有字", "(´・ω・`)"},
+		{"一二三四五六七八九十一二三四五六123456后面还有字", "123456"},
+	}
+	for _, c := range cases {
+		got := SplitBullet(c.text, 20)
+		found := false
+		for _, s := range got {
+			if runeLen(s) > 20 {
+				t.Errorf("%q: chunk too long: %q", c.text, s)
+			}
+			if strings.Contains(s, c.keep) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%q: %q was split: %q", c.text, c.keep, got)
+		}
+	}
+}
+
+func TestSplitBulletContinuation(t *testing.T) {
+	got := SplitBullet(strings.Repeat("啊", 45), 20)
+	if len(got) != 3 {
+		t.Fatalf("unexpected split: %q", got)
+	}
+	for i, s := range got {
+		if runeLen(s) > 20 {
+			t.Fatalf("chunk too long: %q", s)
+		}
+		if last := i == len(got)-1; strings.HasSuffix(s, continuationMarker) == last {
+			t.Fatalf("continuation marker misplaced: %q", got)
+		}
+	}
+}
+
+func TestSplitBulletTinyLimit(t *testing.T) {
+	cases := []struct {
+		text   string
+		maxLen int
+		want   []string
+	}{
+		// 单个字素簇超过长度限制时整体发送，放不下续接标记
+		{"👨‍👩‍👧‍👦", 3, []string{"👨‍👩‍👧‍👦"}},
+		{"👨‍👩‍👧‍👦后面", 3, []string{"👨‍👩‍👧‍👦", "后面"}},
+		{"a b", 1, []string{"a", "b"}},
+		{"a  b c", 1, []string{"a", "b", "c"}},
+		{"ab cd", 2, []string{"ab", "cd"}},
+	}
+	for _, c := range cases {
+		got := SplitBullet(c.text, c.maxLen)
+		if strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("SplitBullet(%q, %d) = %q, want %q", c.text, c.maxLen, got, c.want)
+		}
+		for _, s := range got {
+			if s == "" {
+				t.Errorf("SplitBullet(%q, %d): empty chunk in %q", c.text, c.maxLen, got)
+			}
+		}
+	}
+}
@@ -3,11 +3,11 @@ package logic
 import (
 	"context"
 	"fmt"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"math"
 	"strconv"
 	"strings"
-	"github.com/xbclub/BilibiliDanmuRobot-Core/entity"
-	"github.com/xbclub/BilibiliDanmuRobot-Core/svc"
 	"sync"
 	"time"
 )
@@ -15,8 +15,6 @@ import (
 // 检测到礼物，push [uname]->[giftName]->[cost]，number+1
 // 每3s统计一次礼物，并进行感谢，礼物价值高于x元加一句大气
 
-var thanksGiver *GiftThanksGiver
-
 type GiftThanksGiver struct {
 	giftNameUidTable     map[string]int
 	giftNotBlindBoxTable map[string]map[string]map[string]int
@@ -27,34 +25,36 @@ type GiftThanksGiver struct {
 	giftChan             chan *entity.SendGiftText
 }
 
-func PushToGiftChan(g *entity.SendGiftText) {
-	thanksGiver.giftChan <- g
+func newGiftThanksGiver() *GiftThanksGiver {
+	return &GiftThanksGiver{
+		giftNameUidTable:     make(map[string]int),
+		giftNotBlindBoxTable: make(map[string]map[string]map[string]int),
+		giftBlindBoxTable:    make(map[string]map[string]map[string]int),
+		giftBlindBoxTimer:    make(map[int]*time.Timer),
+		locked:               new(sync.Mutex),
+		tableMu:              sync.RWMutex{},
+		giftChan:             make(chan *entity.SendGiftText, 1000),
+	}
 }
 
-func PushToGuardChan(g *entity.GuardBuyText, reply ...*entity.DanmuMsgTextReplyInfo) {
+func PushToGiftChan(svcCtx *svc.ServiceContext, g *entity.SendGiftText) {
+	pipelinesOf(svcCtx).thanksGiver.giftChan <- g
+}
+
+func PushToGuardChan(svcCtx *svc.ServiceContext, g *entity.GuardBuyText, reply ...*entity.DanmuMsgTextReplyInfo) {
 	if reply != nil {
 		msg := "感谢" + g.Data.GiftName
-		PushToBulletSender(msg, reply...)
+		PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityGift, msg, reply...)
 	} else {
-		msg := "感谢 " + g.Data.Username + " 的 " + g.Data.GiftName
-		PushToBulletSender(msg)
+		PushToBulletSenderMergeable(svcCtx, entity.BulletPriorityGift, "感谢 {user} 的 "+g.Data.GiftName, g.Data.Username)
 	}
 }
 
 func ThanksGift(ctx context.Context, svcCtx *svc.ServiceContext) {
-
-	thanksGiver = &GiftThanksGiver{
-		giftNameUidTable:     make(map[string]int),
-		giftNotBlindBoxTable: make(map[string]map[string]map[string]int),
-		giftBlindBoxTable:    make(map[string]map[string]map[string]int),
-		giftBlindBoxTimer:    make(map[int]*time.Timer),
-		locked:               new(sync.Mutex),
-		tableMu:              sync.RWMutex{},
-		giftChan:             make(chan *entity.SendGiftText, 1000),
-	}
+	thanksGiver := pipelinesOf(svcCtx).thanksGiver
 
 	var g *entity.SendGiftText
-	var w = time.Duration(svcCtx.Config.ThanksGiftTimeout) * time.Second
+	var w = time.Duration(svcCtx.Config().ThanksGiftTimeout) * time.Second
 	var t = time.NewTimer(w)
 	defer t.Stop()
 
@@ -64,13 +64,14 @@ func ThanksGift(ctx context.Context, svcCtx *svc.ServiceContext) {
 			goto END
 		case <-t.C:
 			thanksGiver.locked.Lock()
-			summarizeGift(svcCtx.Config.DanmuLen, svcCtx.Config.ThanksMinCost, svcCtx)
+			thanksGiver.summarizeGift(svcCtx.Config().ThanksMinCost, svcCtx)
 			thanksGiver.locked.Unlock()
 			t.Reset(w)
 		case g = <-thanksGiver.giftChan:
+			c := svcCtx.Config()
 			thanksGiver.locked.Lock()
 
-			if svcCtx.Config.ThanksGiftUseAt {
+			if c.ThanksGiftUseAt {
 				thanksGiver.giftNameUidTable[g.Data.Uname] = g.Data.UID
 			}
 
@@ -89,15 +90,15 @@ func ThanksGift(ctx context.Context, svcCtx *svc.ServiceContext) {
 
 			t.Reset(w)
 
-			if svcCtx.Config.BlindBoxProfitLossStat && g.Data.BlindGift.OriginalGiftName != "" {
+			if c.BlindBoxProfitLossStat && g.Data.BlindGift.OriginalGiftName != "" {
 				//fmt.Printf("盲盒: ")
 				if t, ok := thanksGiver.giftBlindBoxTimer[g.Data.UID]; !ok || t == nil {
-					thanksGiver.giftBlindBoxTimer[g.Data.UID] = time.NewTimer(time.Duration(svcCtx.Config.ThanksGiftTimeout) * time.Second)
+					thanksGiver.giftBlindBoxTimer[g.Data.UID] = time.NewTimer(time.Duration(c.ThanksGiftTimeout) * time.Second)
 					go func(t *time.Timer) {
 						for {
 							<-t.C
 							thanksGiver.locked.Lock()
-							summarizeBlindGift(svcCtx.Config.DanmuLen, svcCtx)
+							thanksGiver.summarizeBlindGift(svcCtx)
 							thanksGiver.locked.Unlock()
 							t.Stop()
 							thanksGiver.giftBlindBoxTimer[g.Data.UID] = nil
@@ -106,7 +107,7 @@ func ThanksGift(ctx context.Context, svcCtx *svc.ServiceContext) {
 				}
 
 				if thanksGiver.giftBlindBoxTimer[g.Data.UID] != nil {
-					thanksGiver.giftBlindBoxTimer[g.Data.UID].Reset(time.Duration(svcCtx.Config.ThanksGiftTimeout) * time.Second)
+					thanksGiver.giftBlindBoxTimer[g.Data.UID].Reset(time.Duration(c.ThanksGiftTimeout) * time.Second)
 				}
 
 				if _, ok := thanksGiver.giftBlindBoxTable[g.Data.Uname]; !ok {
@@ -124,7 +125,8 @@ func ThanksGift(ctx context.Context, svcCtx *svc.ServiceContext) {
 END:
 }
 
-func summarizeBlindGift(danmuLen int, svcCtx *svc.ServiceContext) {
+func (thanksGiver *GiftThanksGiver) summarizeBlindGift(svcCtx *svc.ServiceContext) {
+	c := svcCtx.Config()
 	// 盲盒礼物
 	for name, m := range thanksGiver.giftBlindBoxTable {
 		giftstring := []string{}
@@ -143,7 +145,7 @@ func summarizeBlindGift(danmuLen int, svcCtx *svc.ServiceContext) {
 
 		msgShort := ""
 
-		if !svcCtx.Config.ThanksGiftUseAt {
+		if !c.ThanksGiftUseAt {
 			msg = name + "的"
 		}
 		for k, v := range giftstring {
@@ -156,33 +158,21 @@ func summarizeBlindGift(danmuLen int, svcCtx *svc.ServiceContext) {
 			}
 		}
 
-		ms := []rune(msg)
-
-		if len(ms) > danmuLen {
-			if !svcCtx.Config.ThanksGiftUseAt {
-				PushToBulletSender(name + "的")
-				PushToBulletSender(msgShort)
-			} else {
-				PushToBulletSender(msgShort, &entity.DanmuMsgTextReplyInfo{
-					ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
-					ReplyMsgId: "",
-				})
-			}
+		// 超长时由发送队列统一拆分
+		if !c.ThanksGiftUseAt {
+			PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityGift, msg)
 		} else {
-			if !svcCtx.Config.ThanksGiftUseAt {
-				PushToBulletSender(msg)
-			} else {
-				PushToBulletSender(msg, &entity.DanmuMsgTextReplyInfo{
-					ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
-					ReplyMsgId: "",
-				})
-			}
+			PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityGift, msgShort, &entity.DanmuMsgTextReplyInfo{
+				ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
+				ReplyMsgId: "",
+			})
 		}
 		delete(thanksGiver.giftBlindBoxTable, name)
 	}
 }
 
-func summarizeGift(danmuLen int, minCost int, svcCtx *svc.ServiceContext) {
+func (thanksGiver *GiftThanksGiver) summarizeGift(minCost int, svcCtx *svc.ServiceContext) {
+	c := svcCtx.Config()
 	for name, m := range thanksGiver.giftNotBlindBoxTable {
 		sumCost := 0
 		giftstring := []string{}
@@ -198,7 +188,7 @@ func summarizeGift(danmuLen int, minCost int, svcCtx *svc.ServiceContext) {
 
 		msgShort := ""
 
-		if !svcCtx.Config.ThanksGiftUseAt {
+		if !c.ThanksGiftUseAt {
 			msg = "感谢" + name + "的"
 		} else {
 			msg = "感谢"
@@ -213,34 +203,23 @@ func summarizeGift(danmuLen int, minCost int, svcCtx *svc.ServiceContext) {
 			}
 		}
 
-		ms := []rune(msg)
+		// 超长时由发送队列统一拆分
 		if sumCost < minCost {
 			// discard
-		} else if len(ms) > danmuLen {
-			if !svcCtx.Config.ThanksGiftUseAt {
-				PushToBulletSender("感谢 " + name + " 的")
-				PushToBulletSender(msgShort)
-			} else {
-				PushToBulletSender(msgShort, &entity.DanmuMsgTextReplyInfo{
-					ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
-					ReplyMsgId: "",
-				})
-			}
+		} else if !c.ThanksGiftUseAt {
+			// 不同用户送了相同的礼物时合并感谢
+			PushToBulletSenderMergeable(svcCtx, entity.BulletPriorityGift, "感谢{user}的"+msgShort, name)
 		} else {
-			if !svcCtx.Config.ThanksGiftUseAt {
-				PushToBulletSender(msg)
-			} else {
-				PushToBulletSender(msg, &entity.DanmuMsgTextReplyInfo{
-					ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
-					ReplyMsgId: "",
-				})
-			}
+			PushToBulletSenderWithPriority(svcCtx, entity.BulletPriorityGift, msg, &entity.DanmuMsgTextReplyInfo{
+				ReplyUid:   strconv.Itoa(thanksGiver.giftNameUidTable[name]),
+				ReplyMsgId: "",
+			})
 		}
 
 		//fmt.Println("礼物-----", name, giftstring)
 		// 总打赏高于x元，加一句大气
 		if sumCost >= 50000 { // 50元
-			PushToBulletSender(name + "老板大气大气")
+			PushToBulletSenderMergeable(svcCtx, entity.BulletPriorityGift, "{user}老板大气大气", name)
 		}
 		delete(thanksGiver.giftNotBlindBoxTable, name)
 	}
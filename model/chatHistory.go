@@ -0,0 +1,124 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+)
+
+type (
+	ChatHistoryModel interface {
+		// Append 在一个事务中追加多条消息，全部成功或全部失败
+		Append(ctx context.Context, data ...*ChatHistoryBase) error
+		// Import 在一个事务中导入多条消息，跳过用户、时间、角色和内容都相同的已有消息，返回实际写入的条数，可重复导入
+		Import(ctx context.Context, data ...*ChatHistoryBase) (int64, error)
+		// FindRecent 用户最近的 limit 条消息，按时间从早到晚排列
+		FindRecent(ctx context.Context, uid int64, limit int) ([]ChatHistoryBase, error)
+		// FindAll 所有消息，按用户和时间排列，用于导出
+		FindAll(ctx context.Context) ([]ChatHistoryBase, error)
+		// Prune 删除 before 之前的消息，并且每个用户只保留最近的 perUser 条；参数为零值时不按该条件删除
+		Prune(ctx context.Context, before time.Time, perUser int) (int64, error)
+		DeleteUser(ctx context.Context, uid int64) error
+	}
+	defaultChatHistoryModel struct {
+		conn  *gorm.DB
+		table string
+	}
+	ChatHistoryBase struct {
+		ID      int64 `gorm:"primaryKey;autoIncrement"`
+		Uid     int64 `gorm:"index:idx_uid_id,priority:1"` // 0 为不区分用户的旧记录
+		Uname   string
+		Role    string // user 或 assistant
+		Content string
+		Time    int64 `gorm:"index"` // unix 秒
+	}
+)
+
+func NewChatHistoryModel(conn *gorm.DB, RoomID int64) ChatHistoryModel {
+	err := conn.Table(fmt.Sprintf("chat_%v", RoomID)).AutoMigrate(&ChatHistoryBase{})
+	if err != nil {
+		logx.Error(err)
+	}
+	return &defaultChatHistoryModel{
+		conn:  conn,
+		table: fmt.Sprintf("chat_%v", RoomID),
+	}
+}
+
+func (m *defaultChatHistoryModel) Append(ctx context.Context, data ...*ChatHistoryBase) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Table(m.table).Create(data).Error
+	})
+}
+
+func (m *defaultChatHistoryModel) Import(ctx context.Context, data ...*ChatHistoryBase) (int64, error) {
+	var inserted int64
+	err := m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := fmt.Sprintf(`INSERT INTO %[1]s (uid, uname, role, content, time) SELECT ?, ?, ?, ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM %[1]s WHERE uid = ? AND time = ? AND role = ? AND content = ?)`, m.table)
+		for _, d := range data {
+			res := tx.Exec(query, d.Uid, d.Uname, d.Role, d.Content, d.Time, d.Uid, d.Time, d.Role, d.Content)
+			if res.Error != nil {
+				return res.Error
+			}
+			inserted += res.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return inserted, nil
+}
+
+func (m *defaultChatHistoryModel) FindRecent(ctx context.Context, uid int64, limit int) ([]ChatHistoryBase, error) {
+	var resp []ChatHistoryBase
+	err := m.conn.WithContext(ctx).Table(m.table).Model(&ChatHistoryBase{}).Where("uid = ?", uid).Order("id desc").Limit(limit).Find(&resp).Error
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(resp)-1; i < j; i, j = i+1, j-1 {
+		resp[i], resp[j] = resp[j], resp[i]
+	}
+	return resp, nil
+}
+
+func (m *defaultChatHistoryModel) FindAll(ctx context.Context) ([]ChatHistoryBase, error) {
+	var resp []ChatHistoryBase
+	err := m.conn.WithContext(ctx).Table(m.table).Model(&ChatHistoryBase{}).Order("uid asc, id asc").Find(&resp).Error
+	return resp, err
+}
+
+func (m *defaultChatHistoryModel) Prune(ctx context.Context, before time.Time, perUser int) (int64, error) {
+	var deleted int64
+	err := m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !before.IsZero() {
+			res := tx.Table(m.table).Where("time < ?", before.Unix()).Delete(&ChatHistoryBase{})
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+		if perUser > 0 {
+			res := tx.Exec(fmt.Sprintf(`DELETE FROM %[1]s WHERE id IN (
+				SELECT id FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY uid ORDER BY id DESC) AS rn FROM %[1]s) WHERE rn > ?
+			)`, m.table), perUser)
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+		return nil
+	})
+	return deleted, err
+}
+
+func (m *defaultChatHistoryModel) DeleteUser(ctx context.Context, uid int64) error {
+	return m.conn.WithContext(ctx).Table(m.table).Where("uid = ?", uid).Delete(&ChatHistoryBase{}).Error
+}
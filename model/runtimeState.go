@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zeromicro/go-zero/core/logx"
+	"gorm.io/gorm"
+)
+
+const (
+	RuntimeStateOverride    = "override"    // 主播指令覆盖的开关，Name 为开关名称，Value 为 true 或 false
+	RuntimeStateSuppression = "suppression" // 临时关闭的开关，Name 为原因，Value 为逗号分隔的开关名称
+)
+
+type (
+	RuntimeStateModel interface {
+		FindAll(ctx context.Context) ([]RuntimeStateBase, error)
+		Save(ctx context.Context, data *RuntimeStateBase) error
+		Delete(ctx context.Context, kind, name string) error
+	}
+	defaultRuntimeStateModel struct {
+		conn  *gorm.DB
+		table string
+	}
+	RuntimeStateBase struct {
+		ID    int64 `gorm:"primaryKey;autoIncrement"`
+		Kind  string
+		Name  string
+		Value string
+		Until int64 // 到期时间(unix 秒)，0 为不过期
+	}
+)
+
+func NewRuntimeStateModel(conn *gorm.DB, RoomID int64) RuntimeStateModel {
+	err := conn.Table(fmt.Sprintf("runtime_%v", RoomID)).AutoMigrate(&RuntimeStateBase{})
+	if err != nil {
+		logx.Error(err)
+	}
+	return &defaultRuntimeStateModel{
+		conn:  conn,
+		table: fmt.Sprintf("runtime_%v", RoomID),
+	}
+}
+
+func (m *defaultRuntimeStateModel) FindAll(ctx context.Context) ([]RuntimeStateBase, error) {
+	var resp []RuntimeStateBase
+	err := m.conn.WithContext(ctx).Table(m.table).Model(&RuntimeStateBase{}).Order("id asc").Find(&resp).Error
+	return resp, err
+}
+
+// Save 按 Kind 和 Name 覆盖保存
+func (m *defaultRuntimeStateModel) Save(ctx context.Context, data *RuntimeStateBase) error {
+	return m.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(m.table).Where("kind = ? AND name = ?", data.Kind, data.Name).Delete(&RuntimeStateBase{}).Error
+		if err != nil {
+			return err
+		}
+		data.ID = 0
+		return tx.Table(m.table).Create(data).Error
+	})
+}
+
+func (m *defaultRuntimeStateModel) Delete(ctx context.Context, kind, name string) error {
+	return m.conn.WithContext(ctx).Table(m.table).Where("kind = ? AND name = ?", kind, name).Delete(&RuntimeStateBase{}).Error
+}
@@ -0,0 +1,23 @@
+package svc
+
+import "github.com/xbclub/BilibiliDanmuRobot-Core/entity"
+
+// BiliAPI 机器人用到的 B 站接口
+//
+// 默认实现为 http.BiliClient，测试时可以指向 http/bilitest 的本地模拟服务
+type BiliAPI interface {
+	// SendDanmu 在直播间发送弹幕，返回接口原始响应，HTTP 状态码不是 200 时返回 *http.StatusError
+	SendDanmu(roomID int, msg string, reply ...*entity.DanmuMsgTextReplyInfo) (*entity.DanmuResp, error)
+	// RoomInit 获取直播间的主播 uid 和开播状态
+	RoomInit(roomID int) (*entity.RoomInitInfo, error)
+	// DanmuLength 当前登录用户在直播间的弹幕长度限制
+	DanmuLength(roomID int) (int, error)
+	// Userinfo 直播间主播的信息
+	Userinfo(roomID int) (*entity.Userinfo, error)
+	// TopListInfo 大航海列表
+	TopListInfo(roomID int, ruid int64, page int) (*entity.TopListInfo, error)
+	// RankListInfo 高能榜
+	RankListInfo(roomID int, ruid int64, page int) (*entity.RankListInfo, error)
+	// Nav 当前登录用户的信息
+	Nav() (*entity.UserInfo, error)
+}
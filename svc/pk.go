@@ -0,0 +1,72 @@
+package svc
+
+import (
+	"sync"
+	"time"
+)
+
+// PKOpponent 当前 PK 对手，PK 开始时只有直播间号，获取到对手信息后补全
+type PKOpponent struct {
+	RoomID      int
+	Uid         int64
+	Uname       string
+	GuardNum    int // 大航海人数
+	FollowerNum int
+	GuardOnline int // 在线的大航海人数
+	RankNum     int // 高能榜人数
+	RankScore   int // 高能榜贡献
+	Since       time.Time
+}
+
+// PKState 直播间当前的 PK 状态
+type PKState struct {
+	mu       sync.Mutex
+	opponent *PKOpponent
+}
+
+// Start PK 开始，记录对手的直播间
+func (p *PKState) Start(roomID int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opponent = &PKOpponent{RoomID: roomID, Since: time.Now()}
+}
+
+// Update 补全对手信息，PK 已经结束或对手已经变化时忽略
+func (p *PKState) Update(o PKOpponent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opponent == nil || p.opponent.RoomID != o.RoomID {
+		return
+	}
+	o.Since = p.opponent.Since
+	p.opponent = &o
+}
+
+// End PK 结束
+func (p *PKState) End() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.opponent = nil
+}
+
+// Opponent 当前 PK 对手，不在 PK 中时返回 false
+func (p *PKState) Opponent() (PKOpponent, bool) {
+	if p == nil {
+		return PKOpponent{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.opponent == nil {
+		return PKOpponent{}, false
+	}
+	return *p.opponent, true
+}
@@ -0,0 +1,238 @@
+package svc
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"github.com/zeromicro/go-zero/core/logx"
+)
+
+// Toggle 运行时可以临时开关的功能，名称与配置项相同
+type Toggle string
+
+const (
+	ToggleInteractWord       Toggle = "InteractWord"
+	ToggleEntryEffect        Toggle = "EntryEffect"
+	ToggleWelcomeHighWealthy Toggle = "WelcomeHighWealthy"
+	ToggleLottery            Toggle = "LotteryEnable"
+)
+
+// WelcomeToggles 所有欢迎弹幕相关的开关
+var WelcomeToggles = []Toggle{ToggleInteractWord, ToggleEntryEffect, ToggleWelcomeHighWealthy}
+
+// baseline 配置文件中开关的值
+func (t Toggle) baseline(c *config.Config) bool {
+	if c == nil {
+		return false
+	}
+	switch t {
+	case ToggleInteractWord:
+		return c.InteractWord
+	case ToggleEntryEffect:
+		return c.EntryEffect
+	case ToggleWelcomeHighWealthy:
+		return c.WelcomeHighWealthy
+	case ToggleLottery:
+		return c.LotteryEnable
+	}
+	return false
+}
+
+// Suppression 因为某个事件临时关闭的开关，事件结束或到期后恢复
+type Suppression struct {
+	Reason  string
+	Toggles []Toggle
+	Until   time.Time // 零值为不过期，只能由 Lift 恢复
+}
+
+func (s Suppression) active(now time.Time) bool {
+	return s.Until.IsZero() || now.Before(s.Until)
+}
+
+// RuntimeState 直播间运行时的开关状态，按层叠加：配置文件为基础，主播指令覆盖配置，事件临时关闭优先级最高
+// 覆盖和临时关闭保存到数据库，重启后恢复
+type RuntimeState struct {
+	mu           sync.Mutex
+	overrides    map[Toggle]bool
+	suppressions map[string]Suppression
+	model        model.RuntimeStateModel // 为空时不保存
+	now          func() time.Time
+}
+
+// NewRuntimeState 创建运行时状态并从数据库恢复，已过期的临时关闭被丢弃；m 为空时只保存在内存中
+func NewRuntimeState(m model.RuntimeStateModel) *RuntimeState {
+	r := &RuntimeState{
+		overrides:    make(map[Toggle]bool),
+		suppressions: make(map[string]Suppression),
+		model:        m,
+		now:          time.Now,
+	}
+	if m == nil {
+		return r
+	}
+	rows, err := m.FindAll(context.Background())
+	if err != nil {
+		logx.Errorf("读取运行时状态失败：%v", err)
+		return r
+	}
+	for _, row := range rows {
+		switch row.Kind {
+		case model.RuntimeStateOverride:
+			r.overrides[Toggle(row.Name)], _ = strconv.ParseBool(row.Value)
+		case model.RuntimeStateSuppression:
+			s := Suppression{Reason: row.Name}
+			for _, t := range strings.Split(row.Value, ",") {
+				if t != "" {
+					s.Toggles = append(s.Toggles, Toggle(t))
+				}
+			}
+			if row.Until > 0 {
+				s.Until = time.Unix(row.Until, 0)
+			}
+			r.suppressions[s.Reason] = s
+		}
+	}
+	r.mu.Lock()
+	r.prune()
+	r.mu.Unlock()
+	return r
+}
+
+// Enabled 开关的实际值，c 为当前配置
+func (r *RuntimeState) Enabled(c *config.Config, t Toggle) bool {
+	if r == nil {
+		return t.baseline(c)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	for _, s := range r.suppressions {
+		if !s.active(now) {
+			continue
+		}
+		for _, st := range s.Toggles {
+			if st == t {
+				return false
+			}
+		}
+	}
+	if v, ok := r.overrides[t]; ok {
+		return v
+	}
+	return t.baseline(c)
+}
+
+// SetOverride 用主播指令覆盖配置文件中的开关，直到 ClearOverrides
+func (r *RuntimeState) SetOverride(v bool, toggles ...Toggle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range toggles {
+		r.overrides[t] = v
+		r.save(&model.RuntimeStateBase{Kind: model.RuntimeStateOverride, Name: string(t), Value: strconv.FormatBool(v)})
+	}
+}
+
+// ClearOverrides 取消主播指令的覆盖，恢复使用配置文件中的值
+func (r *RuntimeState) ClearOverrides(toggles ...Toggle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range toggles {
+		if _, ok := r.overrides[t]; !ok {
+			continue
+		}
+		delete(r.overrides, t)
+		r.delete(model.RuntimeStateOverride, string(t))
+	}
+}
+
+// Suppress 因为 reason 临时关闭开关，d 后自动恢复，d 不大于 0 时只能由 Lift 恢复
+// 相同原因再次调用时替换之前的开关和到期时间
+func (r *RuntimeState) Suppress(reason string, d time.Duration, toggles ...Toggle) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+	s := Suppression{Reason: reason, Toggles: toggles}
+	var until int64
+	if d > 0 {
+		s.Until = r.now().Add(d)
+		until = s.Until.Unix()
+	}
+	r.suppressions[reason] = s
+	names := make([]string, len(toggles))
+	for i, t := range toggles {
+		names[i] = string(t)
+	}
+	r.save(&model.RuntimeStateBase{Kind: model.RuntimeStateSuppression, Name: reason, Value: strings.Join(names, ","), Until: until})
+}
+
+// Lift 恢复因为 reason 临时关闭的开关，返回之前是否被关闭
+func (r *RuntimeState) Lift(reason string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.suppressions[reason]
+	if !ok {
+		return false
+	}
+	delete(r.suppressions, reason)
+	r.delete(model.RuntimeStateSuppression, reason)
+	return s.active(r.now())
+}
+
+// Suppressions 当前生效的临时关闭，按原因排序
+func (r *RuntimeState) Suppressions() []Suppression {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.prune()
+	list := make([]Suppression, 0, len(r.suppressions))
+	for _, s := range r.suppressions {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Reason < list[j].Reason })
+	return list
+}
+
+// Overrides 当前主播指令覆盖的开关
+func (r *RuntimeState) Overrides() map[Toggle]bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := make(map[Toggle]bool, len(r.overrides))
+	for t, v := range r.overrides {
+		m[t] = v
+	}
+	return m
+}
+
+// prune 删除已过期的临时关闭，调用方持有锁
+func (r *RuntimeState) prune() {
+	now := r.now()
+	for reason, s := range r.suppressions {
+		if !s.active(now) {
+			delete(r.suppressions, reason)
+			r.delete(model.RuntimeStateSuppression, reason)
+		}
+	}
+}
+
+func (r *RuntimeState) save(data *model.RuntimeStateBase) {
+	if r.model == nil {
+		return
+	}
+	if err := r.model.Save(context.Background(), data); err != nil {
+		logx.Errorf("保存运行时状态失败：%v", err)
+	}
+}
+
+func (r *RuntimeState) delete(kind, name string) {
+	if r.model == nil {
+		return
+	}
+	if err := r.model.Delete(context.Background(), kind, name); err != nil {
+		logx.Errorf("删除运行时状态失败：%v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package svc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
+	"github.com/xbclub/BilibiliDanmuRobot-Core/model"
+	"gorm.io/gorm"
+)
+
+func TestRuntimeStateLayers(t *testing.T) {
+	c := &config.Config{InteractWord: true}
+	r := NewRuntimeState(nil)
+	now := time.Unix(1000, 0)
+	r.now = func() time.Time { return now }
+
+	if !r.Enabled(c, ToggleInteractWord) || r.Enabled(c, ToggleEntryEffect) {
+		t.Fatal("baseline not used")
+	}
+	r.SetOverride(true, ToggleEntryEffect)
+	if !r.Enabled(c, ToggleEntryEffect) {
+		t.Fatal("override not applied")
+	}
+
+	r.Suppress("红包", time.Minute, WelcomeToggles...)
+	r.Suppress("天选", 0, ToggleInteractWord)
+	if r.Enabled(c, ToggleInteractWord) || r.Enabled(c, ToggleEntryEffect) {
+		t.Fatal("suppression not applied")
+	}
+
+	// 红包到期后特效欢迎恢复为主播指令的值，天选没有到期时间
+	now = now.Add(2 * time.Minute)
+	if !r.Enabled(c, ToggleEntryEffect) || r.Enabled(c, ToggleInteractWord) {
+		t.Fatal("expired suppression still applied")
+	}
+	if s := r.Suppressions(); len(s) != 1 || s[0].Reason != "天选" {
+		t.Fatalf("suppressions = %+v", s)
+	}
+	if r.Lift("红包") || !r.Lift("天选") {
+		t.Fatal("Lift reported wrong state")
+	}
+	if !r.Enabled(c, ToggleInteractWord) {
+		t.Fatal("lift did not restore config value")
+	}
+
+	r.ClearOverrides(WelcomeToggles...)
+	if r.Enabled(c, ToggleEntryEffect) || len(r.Overrides()) != 0 {
+		t.Fatal("override not cleared")
+	}
+}
+
+func TestRuntimeStatePersist(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := model.NewRuntimeStateModel(db, 1)
+	c := &config.Config{InteractWord: true, LotteryEnable: true}
+
+	r := NewRuntimeState(m)
+	r.SetOverride(false, ToggleInteractWord)
+	r.SetOverride(true, ToggleInteractWord)
+	r.Suppress("红包", time.Hour, ToggleLottery)
+	r.Suppress("已过期", time.Second, ToggleEntryEffect)
+	r.Suppress("红包", time.Hour, ToggleLottery, ToggleEntryEffect)
+
+	restored := NewRuntimeState(m)
+	restored.now = func() time.Time { return time.Now().Add(time.Minute) }
+	if v, ok := restored.Overrides()[ToggleInteractWord]; !ok || !v || len(restored.Overrides()) != 1 {
+		t.Fatalf("overrides = %v", restored.Overrides())
+	}
+	s := restored.Suppressions()
+	if len(s) != 1 || s[0].Reason != "红包" || len(s[0].Toggles) != 2 {
+		t.Fatalf("suppressions = %+v", s)
+	}
+	if restored.Enabled(c, ToggleLottery) {
+		t.Fatal("restored suppression not applied")
+	}
+
+	// 到期的临时关闭在下次读取时从数据库删除
+	rows, _ := m.FindAll(t.Context())
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v", rows)
+	}
+}
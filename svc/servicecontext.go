@@ -2,6 +2,7 @@ package svc
 
 import (
 	"fmt"
+	"sync/atomic"
 
 	"github.com/glebarez/sqlite"
 	"github.com/xbclub/BilibiliDanmuRobot-Core/config"
@@ -10,32 +11,86 @@ import (
 )
 
 type ServiceContext struct {
-	Config       *config.Config
-	OtherSideUid map[int64]bool
+	// 当前配置，热更新时整体替换，通过 Config 读取
+	config            *atomic.Pointer[config.Config]
+	Db                *gorm.DB // 多个直播间共用同一个数据库连接
+	OtherSideUid      map[int64]bool
 	SignInModel       model.SignInModel
 	DanmuCntModel     model.DanmuCntModel
 	BlindBoxStatModel model.BlindBoxStatModel
-	UserID            int64 //主播id
-	Autointerract     struct {
-		EntryEffect        bool
-		WelcomeHighWealthy bool
-		InteractWord       bool
+	ChatHistoryModel  model.ChatHistoryModel // 机器人的对话记录
+	Bili              BiliAPI                // B站接口，为空时使用默认接口
+	Runtime           *RuntimeState          // 运行时开关状态，通过 Enabled 读取开关的实际值
+	PK                *PKState               // 当前 PK 对手
+	UserID            int64                  //主播id
+	RobotID           string                 //机器人uid
+	DanmuLenLimit     int                    // 机器人账号在直播间的弹幕长度限制，0 为未知
+}
+
+func newConfigPointer(c *config.Config) *atomic.Pointer[config.Config] {
+	p := new(atomic.Pointer[config.Config])
+	p.Store(c)
+	return p
+}
+
+// Config 返回当前配置，配置热更新后返回新的配置，已返回的配置不会被修改
+// 一次处理中多次读取时应保存返回值，避免前后读到不同的配置
+func (s ServiceContext) Config() *config.Config {
+	if s.config == nil {
+		return nil
 	}
-	RobotID string //机器人uid
+	return s.config.Load()
 }
 
-func NewServiceContext(c config.Config) *ServiceContext {
+// SetConfig 原子地替换配置，返回替换前的配置；c 替换后不应再被修改
+func (s *ServiceContext) SetConfig(c *config.Config) *config.Config {
+	if s.config == nil {
+		s.config = newConfigPointer(c)
+		return nil
+	}
+	return s.config.Swap(c)
+}
+
+// Enabled 开关的实际值：配置文件的值叠加主播指令和事件临时关闭
+func (s ServiceContext) Enabled(t Toggle) bool {
+	return s.Runtime.Enabled(s.Config(), t)
+}
+
+// OpenDB 打开sqlite数据库
+func OpenDB(c config.Config) (*gorm.DB, error) {
 	dbFile := fmt.Sprintf("%s/%s?_pragma=busy_timeout(5000)", c.DBPath, c.DBName)
-	db, err := gorm.Open(sqlite.Open(dbFile), &gorm.Config{})
+	return gorm.Open(sqlite.Open(dbFile), &gorm.Config{})
+}
+
+// CloseDB 关闭数据库连接
+func CloseDB(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+func NewServiceContext(c config.Config) *ServiceContext {
+	db, err := OpenDB(c)
 	if err != nil {
 		panic(err)
 	}
+	return NewRoomServiceContext(c, db)
+}
+
+// NewRoomServiceContext 使用已打开的数据库连接创建单个直播间的上下文
+func NewRoomServiceContext(c config.Config, db *gorm.DB) *ServiceContext {
 	return &ServiceContext{
-		OtherSideUid: make(map[int64]bool),
+		Db:                db,
+		OtherSideUid:      make(map[int64]bool),
 		SignInModel:       model.NewSignInModel(db, int64(c.RoomId)),
 		DanmuCntModel:     model.NewDanmuCntModel(db, int64(c.RoomId)),
 		BlindBoxStatModel: model.NewBlindBoxStatModel(db, int64(c.RoomId)),
-		Config:            &c,
+		ChatHistoryModel:  model.NewChatHistoryModel(db, int64(c.RoomId)),
+		Runtime:           NewRuntimeState(model.NewRuntimeStateModel(db, int64(c.RoomId))),
+		PK:                &PKState{},
+		config:            newConfigPointer(&c),
 		UserID:            0,
 	}
 }